@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrAlatNotFound dikembalikan repository jika kode atau nama alat tidak ada di katalog.
+var ErrAlatNotFound = errors.New("alat tidak ditemukan di katalog")
+
+var errTanggalTidakValid = errors.New("tanggal pinjam/kembali tidak valid")
+
+// Alat adalah satu jenis barang di katalog lab.
+type Alat struct {
+	Kode    string `json:"kode"`
+	Nama    string `json:"nama"`
+	Jumlah  int    `json:"jumlah"`
+	Lokasi  string `json:"lokasi"`
+	Kondisi string `json:"kondisi"`
+	// Kategori menentukan rantai persetujuan, lihat approvalChains.
+	Kategori string `json:"kategori"`
+}
+
+// AlatRepository menyimpan katalog alat di tempat yang sama dengan data peminjaman.
+type AlatRepository interface {
+	ListAlat() ([]Alat, error)
+	// FindAlat mencari berdasarkan kode, lalu nama (tanpa membedakan huruf besar/kecil).
+	FindAlat(kodeAtauNama string) (*Alat, error)
+	// SaveAlat menambah alat baru atau memperbarui alat dengan kode yang sama.
+	SaveAlat(a *Alat) error
+}
+
+var alatRepo AlatRepository
+
+func findAlatIn(list []Alat, kodeAtauNama string) (*Alat, error) {
+	key := strings.TrimSpace(kodeAtauNama)
+	for i := range list {
+		if strings.EqualFold(list[i].Kode, key) {
+			return &list[i], nil
+		}
+	}
+	for i := range list {
+		if strings.EqualFold(list[i].Nama, key) {
+			return &list[i], nil
+		}
+	}
+	return nil, ErrAlatNotFound
+}
+
+// matches memeriksa apakah isian NamaAlat peminjaman menunjuk alat ini.
+func (a *Alat) matches(namaAlat string) bool {
+	namaAlat = strings.TrimSpace(namaAlat)
+	return strings.EqualFold(namaAlat, a.Nama) || strings.EqualFold(namaAlat, a.Kode)
+}
+
+// holdsStock menandai status peminjaman yang alatnya sedang/akan dipakai.
+func holdsStock(status LoanStatus) bool {
+	switch status {
+	case StatusDisetujui, StatusDipinjam, StatusTerlambat:
+		return true
+	}
+	return false
+}
+
+// loanPeriod mengembalikan rentang hari pemakaian alat. Peminjaman terlambat
+// dianggap memakai alat sampai hari ini.
+func loanPeriod(p Peminjaman, now time.Time) (from, to time.Time, ok bool) {
+	from, errFrom := time.Parse("2006-01-02", p.Form.TanggalPinjam)
+	to, errTo := time.Parse("2006-01-02", p.Form.TanggalKembali)
+	if errFrom != nil || errTo != nil {
+		return from, to, false
+	}
+	if p.Status == StatusTerlambat {
+		if t := truncateDay(now); t.After(to) {
+			to = t
+		}
+	}
+	return from, to, true
+}
+
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// usedOn menjumlahkan alat yang dipakai peminjaman lain pada tanggal day.
+func usedOn(alat *Alat, day time.Time, loans []Peminjaman, excludeID int, now time.Time) int {
+	return sumOn(alat, day, loans, excludeID, now, holdsStock)
+}
+
+// sumOn menjumlahkan alat pada tanggal day dari peminjaman yang statusnya lolos include.
+func sumOn(alat *Alat, day time.Time, loans []Peminjaman, excludeID int, now time.Time, include func(LoanStatus) bool) int {
+	total := 0
+	for _, p := range loans {
+		if p.ID == excludeID || !include(p.Status) {
+			continue
+		}
+		from, to, ok := loanPeriod(p, now)
+		if !ok || day.Before(from) || day.After(to) {
+			continue
+		}
+		// Alat yang sudah dikembalikan sebagian tidak lagi memakai stok.
+		for _, it := range p.sisa() {
+			if alat.matches(it.NamaAlat) {
+				total += it.Jumlah
+			}
+		}
+	}
+	return total
+}
+
+// availableQuantity adalah stok yang bisa dipinjam setiap hari dalam rentang
+// from..to: jumlah total dikurangi pemakaian tertinggi dari peminjaman yang
+// sudah disetujui.
+func availableQuantity(alat *Alat, from, to time.Time, loans []Peminjaman, excludeID int) int {
+	now := time.Now()
+	maxUsed := 0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if used := usedOn(alat, day, loans, excludeID, now); used > maxUsed {
+			maxUsed = used
+		}
+	}
+	if free := alat.Jumlah - maxUsed; free > 0 {
+		return free
+	}
+	return 0
+}
+
+// StockError dikembalikan jika jumlah yang diminta melebihi stok tersedia.
+type StockError struct {
+	Alat     string
+	Diminta  int
+	Tersedia int
+	From, To string
+}
+
+func (e *StockError) Error() string {
+	return fmt.Sprintf("stok %s tidak cukup untuk %s s.d. %s: diminta %d, tersedia %d", e.Alat, e.From, e.To, e.Diminta, e.Tersedia)
+}
+
+// checkStock memastikan setiap alat dalam form tidak melebihi stok. excludeID
+// diisi saat memeriksa ulang peminjaman yang sudah tersimpan. Alat yang belum
+// ada di katalog tidak bisa diperiksa; namanya dikembalikan lewat unknown.
+func checkStock(form FormData, excludeID int) (unknown []string, err error) {
+	catalog, err := alatRepo.ListAlat()
+	if err != nil {
+		return nil, err
+	}
+	// Item dengan alat yang sama (misalnya ditulis dengan kode dan nama)
+	// dijumlahkan dulu.
+	var requested []*Alat
+	diminta := map[*Alat]int{}
+	for _, it := range form.items() {
+		alat, err := findAlatIn(catalog, it.NamaAlat)
+		if err != nil {
+			unknown = append(unknown, it.NamaAlat)
+			continue
+		}
+		if _, ok := diminta[alat]; !ok {
+			requested = append(requested, alat)
+		}
+		diminta[alat] += it.Jumlah
+	}
+	if len(requested) == 0 {
+		return unknown, nil
+	}
+
+	from, errFrom := time.Parse("2006-01-02", form.TanggalPinjam)
+	to, errTo := time.Parse("2006-01-02", form.TanggalKembali)
+	if errFrom != nil || errTo != nil || to.Before(from) {
+		return unknown, errTanggalTidakValid
+	}
+	loans, err := loanRepo.ListLoans()
+	if err != nil {
+		return unknown, err
+	}
+	for _, alat := range requested {
+		if free := availableQuantity(alat, from, to, loans, excludeID); diminta[alat] > free {
+			return unknown, &StockError{Alat: alat.Nama, Diminta: diminta[alat], Tersedia: free, From: form.TanggalPinjam, To: form.TanggalKembali}
+		}
+	}
+	return unknown, nil
+}
+
+// writeStockError menerjemahkan error checkStock ke status HTTP.
+func writeStockError(w http.ResponseWriter, err error) {
+	var se *StockError
+	if errors.As(err, &se) {
+		http.Error(w, "❌ "+se.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, errTanggalTidakValid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Println("Stock check error:", err)
+	http.Error(w, "Gagal memeriksa stok alat", http.StatusInternalServerError)
+}
+
+// DailyAvailability adalah stok satu alat pada satu tanggal.
+type DailyAvailability struct {
+	Tanggal  string `json:"tanggal"`
+	Dipakai  int    `json:"dipakai"`  // peminjaman disetujui, dipinjam, atau terlambat
+	Diajukan int    `json:"diajukan"` // pengajuan yang belum diputuskan
+	Tersedia int    `json:"tersedia"`
+}
+
+// AvailabilityResponse adalah jawaban GET /alat/availability.
+type AvailabilityResponse struct {
+	Alat       Alat                `json:"alat"`
+	From       string              `json:"from"`
+	To         string              `json:"to"`
+	Tersedia   int                 `json:"tersedia"` // jumlah yang bisa dipinjam untuk seluruh rentang
+	PerTanggal []DailyAvailability `json:"perTanggal"`
+}
+
+// maxAvailabilityDays membatasi rentang GET /alat/availability.
+const maxAvailabilityDays = 366
+
+func dailyAvailability(alat *Alat, from, to time.Time, loans []Peminjaman) []DailyAvailability {
+	now := time.Now()
+	isPending := func(s LoanStatus) bool { return s == StatusDiajukan }
+	var days []DailyAvailability
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		used := usedOn(alat, day, loans, 0, now)
+		free := alat.Jumlah - used
+		if free < 0 {
+			free = 0
+		}
+		days = append(days, DailyAvailability{
+			Tanggal:  day.Format("2006-01-02"),
+			Dipakai:  used,
+			Diajukan: sumOn(alat, day, loans, 0, now, isPending),
+			Tersedia: free,
+		})
+	}
+	return days
+}
+
+// handleAlatAvailability menjawab GET /alat/availability?alat=...&from=...&to=...
+// supaya frontend bisa menampilkan stok sebelum siswa mengirim /pinjam.
+func handleAlatAvailability(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("alat") == "" {
+		http.Error(w, "Parameter alat harus diisi", http.StatusBadRequest)
+		return
+	}
+	from, errFrom := time.Parse("2006-01-02", q.Get("from"))
+	to, errTo := time.Parse("2006-01-02", q.Get("to"))
+	if errFrom != nil || errTo != nil || to.Before(from) {
+		http.Error(w, "Parameter from dan to harus berformat YYYY-MM-DD dan from <= to", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > maxAvailabilityDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("Rentang tanggal maksimal %d hari", maxAvailabilityDays), http.StatusBadRequest)
+		return
+	}
+
+	alat, err := alatRepo.FindAlat(q.Get("alat"))
+	if errors.Is(err, ErrAlatNotFound) {
+		http.Error(w, "Alat tidak ditemukan di katalog", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Find alat error:", err)
+		http.Error(w, "Gagal mengambil katalog alat", http.StatusInternalServerError)
+		return
+	}
+	loans, err := loanRepo.ListLoans()
+	if err != nil {
+		log.Println("List loans error:", err)
+		http.Error(w, "Gagal mengambil data peminjaman", http.StatusInternalServerError)
+		return
+	}
+
+	resp := AvailabilityResponse{
+		Alat:       *alat,
+		From:       from.Format("2006-01-02"),
+		To:         to.Format("2006-01-02"),
+		PerTanggal: dailyAvailability(alat, from, to, loans),
+	}
+	resp.Tersedia = alat.Jumlah
+	for _, d := range resp.PerTanggal {
+		if d.Tersedia < resp.Tersedia {
+			resp.Tersedia = d.Tersedia
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleAlat: GET menampilkan katalog, POST menambah atau memperbarui satu alat
+// (khusus admin lab).
+func handleAlat(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if _, ok := authorize(w, r, RoleAdminLab); !ok {
+			return
+		}
+	}
+	switch r.Method {
+	case http.MethodGet:
+		list, err := alatRepo.ListAlat()
+		if err != nil {
+			log.Println("List alat error:", err)
+			http.Error(w, "Gagal mengambil katalog alat", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	case http.MethodPost:
+		r.ParseMultipartForm(10 << 20)
+		jumlah, err := strconv.Atoi(r.FormValue("jumlah"))
+		if err != nil || jumlah < 0 {
+			http.Error(w, "Jumlah alat tidak valid", http.StatusBadRequest)
+			return
+		}
+		a := &Alat{
+			Kode:     strings.TrimSpace(r.FormValue("kode")),
+			Nama:     strings.TrimSpace(r.FormValue("nama")),
+			Jumlah:   jumlah,
+			Lokasi:   r.FormValue("lokasi"),
+			Kondisi:  r.FormValue("kondisi"),
+			Kategori: strings.TrimSpace(r.FormValue("kategori")),
+		}
+		if a.Kode == "" || a.Nama == "" {
+			http.Error(w, "Kode dan nama alat harus diisi", http.StatusBadRequest)
+			return
+		}
+		if err := alatRepo.SaveAlat(a); err != nil {
+			log.Println("Save alat error:", err)
+			http.Error(w, "Gagal menyimpan alat", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "✅ Alat %s (%s) disimpan", a.Nama, a.Kode)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
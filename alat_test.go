@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testLoan(id int, status LoanStatus, from, to string, items ...ItemPinjam) Peminjaman {
+	p := Peminjaman{ID: id, Status: status, Form: FormData{TanggalPinjam: from, TanggalKembali: to}}
+	p.Form.setItems(items)
+	return p
+}
+
+func mustDate(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestAvailableQuantity(t *testing.T) {
+	kamera := &Alat{Kode: "KAM", Nama: "Kamera", Jumlah: 5}
+	loans := []Peminjaman{
+		testLoan(1, StatusDisetujui, "2026-03-01", "2026-03-03", ItemPinjam{"Kamera", 2}),
+		testLoan(2, StatusDipinjam, "2026-03-03", "2026-03-05", ItemPinjam{"kam", 1}, ItemPinjam{"Tripod", 4}),
+		testLoan(3, StatusDiajukan, "2026-03-01", "2026-03-10", ItemPinjam{"Kamera", 5}),
+		testLoan(4, StatusDikembalikan, "2026-03-01", "2026-03-10", ItemPinjam{"Kamera", 5}),
+		testLoan(5, StatusDitolak, "2026-03-01", "2026-03-10", ItemPinjam{"Kamera", 5}),
+		testLoan(6, StatusDisetujui, "bukan tanggal", "2026-03-10", ItemPinjam{"Kamera", 5}),
+	}
+	// Peminjaman 7 sudah mengembalikan 2 dari 3 kamera.
+	sebagian := testLoan(7, StatusDipinjam, "2026-03-08", "2026-03-09", ItemPinjam{"Kamera", 3})
+	sebagian.Kembali = []ItemPinjam{{"Kamera", 2}}
+	loans = append(loans, sebagian)
+
+	tests := []struct {
+		name      string
+		from, to  string
+		excludeID int
+		want      int
+	}{
+		{"sebelum semua peminjaman", "2026-02-01", "2026-02-28", 0, 5},
+		{"satu hari", "2026-03-01", "2026-03-01", 0, 3},
+		{"hari bertumpuk", "2026-03-01", "2026-03-05", 0, 2},
+		{"tanpa peminjaman sendiri", "2026-03-01", "2026-03-05", 1, 4},
+		{"sisa pengembalian sebagian", "2026-03-08", "2026-03-09", 0, 4},
+		{"setelah selesai", "2026-03-11", "2026-03-12", 0, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := availableQuantity(kamera, mustDate(t, tt.from), mustDate(t, tt.to), loans, tt.excludeID); got != tt.want {
+				t.Errorf("availableQuantity = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	habis := &Alat{Nama: "Kamera", Jumlah: 1}
+	if got := availableQuantity(habis, mustDate(t, "2026-03-03"), mustDate(t, "2026-03-03"), loans, 0); got != 0 {
+		t.Errorf("availableQuantity stok kurang = %d, want 0", got)
+	}
+}
+
+func TestAvailableQuantityTerlambat(t *testing.T) {
+	kamera := &Alat{Nama: "Kamera", Jumlah: 2}
+	today := truncateDay(time.Now())
+	lewat := today.AddDate(0, 0, -3).Format("2006-01-02")
+	loans := []Peminjaman{testLoan(1, StatusTerlambat, lewat, lewat, ItemPinjam{"Kamera", 1})}
+	// Peminjaman terlambat dianggap memakai alat sampai hari ini.
+	if got := availableQuantity(kamera, today, today, loans, 0); got != 1 {
+		t.Errorf("availableQuantity hari ini = %d, want 1", got)
+	}
+	if got := availableQuantity(kamera, today.AddDate(0, 0, 1), today.AddDate(0, 0, 1), loans, 0); got != 2 {
+		t.Errorf("availableQuantity besok = %d, want 2", got)
+	}
+}
+
+func TestCheckStock(t *testing.T) {
+	newTestStorage(t)
+	alatRepo.SaveAlat(&Alat{Kode: "KAM", Nama: "Kamera", Jumlah: 3})
+	alatRepo.SaveAlat(&Alat{Kode: "TRP", Nama: "Tripod", Jumlah: 1})
+	dipakai := createTestLoan(t, StatusDisetujui, "Kamera", 2, "2026-04-01", "2026-04-02")
+
+	tests := []struct {
+		name        string
+		items       []ItemPinjam
+		from, to    string
+		excludeID   int
+		wantUnknown int
+		wantErr     error
+		tersedia    int // untuk StockError
+	}{
+		{"cukup", []ItemPinjam{{"Kamera", 1}, {"TRP", 1}}, "2026-04-01", "2026-04-02", 0, 0, nil, 0},
+		{"kurang", []ItemPinjam{{"Kamera", 2}}, "2026-04-02", "2026-04-03", 0, 0, &StockError{}, 1},
+		{"kode dan nama dijumlahkan", []ItemPinjam{{"Kamera", 1}, {"kam", 1}}, "2026-04-01", "2026-04-01", 0, 0, &StockError{}, 1},
+		{"periksa ulang diri sendiri", []ItemPinjam{{"Kamera", 3}}, "2026-04-01", "2026-04-02", dipakai.ID, 0, nil, 0},
+		{"alat belum di katalog", []ItemPinjam{{"Drone", 1}}, "2026-04-01", "2026-04-02", 0, 1, nil, 0},
+		{"tanggal terbalik", []ItemPinjam{{"Kamera", 1}}, "2026-04-03", "2026-04-01", 0, 0, errTanggalTidakValid, 0},
+		{"tanggal kosong", []ItemPinjam{{"Kamera", 1}, {"Drone", 1}}, "", "", 0, 1, errTanggalTidakValid, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := FormData{TanggalPinjam: tt.from, TanggalKembali: tt.to}
+			form.setItems(tt.items)
+			unknown, err := checkStock(form, tt.excludeID)
+			if len(unknown) != tt.wantUnknown {
+				t.Errorf("unknown = %v, want %d alat", unknown, tt.wantUnknown)
+			}
+			var se *StockError
+			switch {
+			case tt.wantErr == nil:
+				if err != nil {
+					t.Errorf("err = %v", err)
+				}
+			case errors.As(tt.wantErr, &se):
+				if !errors.As(err, &se) || se.Tersedia != tt.tersedia {
+					t.Errorf("err = %v, want StockError tersedia %d", err, tt.tersedia)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleAlatAvailability(t *testing.T) {
+	newTestStorage(t)
+	alatRepo.SaveAlat(&Alat{Kode: "KAM", Nama: "Kamera", Jumlah: 3})
+	createTestLoan(t, StatusDisetujui, "Kamera", 2, "2026-04-02", "2026-04-02")
+	createTestLoan(t, StatusDiajukan, "Kamera", 1, "2026-04-01", "2026-04-02")
+
+	tests := []struct {
+		name         string
+		query        string
+		wantCode     int
+		wantTersedia int
+	}{
+		{"rentang", "?alat=kam&from=2026-04-01&to=2026-04-03", http.StatusOK, 1},
+		{"alat tidak ada", "?alat=Drone&from=2026-04-01&to=2026-04-03", http.StatusNotFound, 0},
+		{"tanpa alat", "?from=2026-04-01&to=2026-04-03", http.StatusBadRequest, 0},
+		{"tanggal terbalik", "?alat=kam&from=2026-04-03&to=2026-04-01", http.StatusBadRequest, 0},
+		{"rentang terlalu panjang", "?alat=kam&from=2026-01-01&to=2027-06-01", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handleAlatAvailability(w, httptest.NewRequest(http.MethodGet, "/alat/availability"+tt.query, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("kode %d %q, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp AvailabilityResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Tersedia != tt.wantTersedia || len(resp.PerTanggal) != 3 {
+				t.Fatalf("tersedia %d, %d hari, want %d, 3 hari", resp.Tersedia, len(resp.PerTanggal), tt.wantTersedia)
+			}
+			if d := resp.PerTanggal[1]; d.Dipakai != 2 || d.Diajukan != 1 || d.Tersedia != 1 {
+				t.Errorf("2026-04-02 = %+v", d)
+			}
+		})
+	}
+}
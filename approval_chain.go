@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Error keputusan pada rantai persetujuan.
+var (
+	ErrBukanGiliran   = errors.New("tahap persetujuan ini bukan untuk akun Anda")
+	ErrTahapTerlewati = errors.New("tahap persetujuan ini sudah diputuskan")
+)
+
+// ApprovalStep adalah satu tahap persetujuan. Approver adalah username akun
+// yang memutuskan tahap ini; kosong berarti approver mana pun, dengan
+// notifikasi ke APPROVER_NO. Eskalasi adalah username yang menerima permohonan
+// jika tahap ini terlalu lama belum diputuskan (lihat APPROVAL_ESKALASI_KE).
+type ApprovalStep struct {
+	Nama     string `json:"nama"`
+	Approver string `json:"approver"`
+	Eskalasi string `json:"eskalasi,omitempty"`
+}
+
+// ApprovalChains memetakan kategori alat ke tahap persetujuannya. Alat tanpa
+// kategori, di luar katalog, atau dengan kategori yang tidak terdaftar memakai
+// Default.
+type ApprovalChains struct {
+	Default  []ApprovalStep            `json:"default"`
+	Kategori map[string][]ApprovalStep `json:"kategori"`
+}
+
+var approvalChains *ApprovalChains
+
+// newApprovalChainsFromEnv membaca APPROVAL_CHAIN_PATH (default
+// config/approval_chain.json), misalnya:
+//
+//	{
+//	  "default": [{"nama": "Guru Lab", "approver": "guru.lab"}],
+//	  "kategori": {
+//	    "Elektronik": [
+//	      {"nama": "Guru Lab", "approver": "guru.lab"},
+//	      {"nama": "Wakil Kepala Sekolah", "approver": "wakasek", "eskalasi": "kepsek"}
+//	    ]
+//	  }
+//	}
+//
+// Tanpa file, setiap peminjaman cukup satu persetujuan seperti sebelumnya, oleh
+// akun APPROVER_USERNAME jika diisi atau oleh approver mana pun.
+func newApprovalChainsFromEnv() (*ApprovalChains, error) {
+	path := getEnv("APPROVAL_CHAIN_PATH", filepath.Join("config", "approval_chain.json"))
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &ApprovalChains{Default: defaultApprovalSteps()}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca %s: %v", path, err)
+	}
+	var c ApprovalChains
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("file rantai persetujuan %s rusak: %v", path, err)
+	}
+	if len(c.Default) == 0 {
+		c.Default = defaultApprovalSteps()
+	}
+	if err := validateSteps("default", c.Default); err != nil {
+		return nil, err
+	}
+	for kategori, steps := range c.Kategori {
+		if err := validateSteps(kategori, steps); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("INFO: Rantai persetujuan dimuat dari %s (%d kategori)", path, len(c.Kategori))
+	return &c, nil
+}
+
+func defaultApprovalSteps() []ApprovalStep {
+	return []ApprovalStep{{Nama: "Approver", Approver: getEnv("APPROVER_USERNAME", "")}}
+}
+
+func validateSteps(kategori string, steps []ApprovalStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("rantai persetujuan %q kosong", kategori)
+	}
+	for _, st := range steps {
+		if strings.TrimSpace(st.Nama) == "" {
+			return fmt.Errorf("setiap tahap pada rantai persetujuan %q harus punya nama", kategori)
+		}
+	}
+	return nil
+}
+
+func (c *ApprovalChains) forKategori(kategori string) []ApprovalStep {
+	for k, steps := range c.Kategori {
+		if kategori != "" && strings.EqualFold(k, kategori) {
+			return steps
+		}
+	}
+	return c.Default
+}
+
+// chainFor menggabungkan rantai semua kategori alat pada peminjaman. Tahap
+// dengan nama yang sama hanya muncul sekali, di urutan pertama kali muncul,
+// sehingga Elektronik [Guru Lab, Wakasek] + Habis Pakai [Guru Lab] menjadi
+// [Guru Lab, Wakasek].
+func (c *ApprovalChains) chainFor(loan *Peminjaman) ([]ApprovalStep, error) {
+	katalog, err := alatRepo.ListAlat()
+	if err != nil {
+		return nil, err
+	}
+	return c.chainIn(katalog, loan), nil
+}
+
+// chainIn seperti chainFor dengan katalog alat yang sudah dibaca.
+func (c *ApprovalChains) chainIn(katalog []Alat, loan *Peminjaman) []ApprovalStep {
+	var chain []ApprovalStep
+	seen := map[string]bool{}
+	for _, it := range loan.Form.items() {
+		kategori := ""
+		if a, err := findAlatIn(katalog, it.NamaAlat); err == nil {
+			kategori = a.Kategori
+		}
+		for _, st := range c.forKategori(kategori) {
+			key := strings.ToLower(strings.TrimSpace(st.Nama))
+			if !seen[key] {
+				seen[key] = true
+				chain = append(chain, st)
+			}
+		}
+	}
+	if len(chain) == 0 {
+		chain = c.Default
+	}
+	return chain
+}
+
+// approvalActor adalah orang yang memutuskan satu tahap, dari sesi login atau
+// dari link approval.
+type approvalActor struct {
+	Username string
+	Nama     string
+	TTD      string // link tanda tangan untuk surat persetujuan
+	Super    bool
+}
+
+func actorFromUser(u *User) approvalActor {
+	return approvalActor{Username: u.Username, Nama: u.Nama, TTD: u.TTD, Super: u.Role == RoleSuperAdmin}
+}
+
+// stepAllows memeriksa apakah actor boleh memutuskan tahap st pada peminjaman
+// id: approver tahap itu, wakilnya yang sedang berlaku, atau penerima eskalasi
+// (beserta wakilnya) setelah tahap itu dieskalasi.
+func stepAllows(id int, st ApprovalStep, a approvalActor, now time.Time) (bool, error) {
+	if st.Approver == "" || a.Super {
+		return true, nil
+	}
+	usernames := []string{st.Approver}
+	if target, ok, err := escalatedTo(id, st); err != nil {
+		return false, err
+	} else if ok && target != "" {
+		usernames = append(usernames, target)
+	}
+	for _, username := range usernames {
+		path, err := delegationPath(username, now)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range path {
+			if strings.EqualFold(p, a.Username) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// currentStep mengembalikan rantai peminjaman dan index tahap yang sedang
+// menunggu keputusan. Tahap dianggap selesai jika keputusan Disetujui dengan
+// nama tahap yang sama sudah tercatat, berurutan dari tahap pertama.
+func currentStep(loan *Peminjaman) (chain []ApprovalStep, index int, err error) {
+	chain, err = approvalChains.chainFor(loan)
+	if err != nil {
+		return nil, 0, err
+	}
+	approvals, err := loanRepo.ListApprovals(loan.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return chain, stepIndex(chain, approvals), nil
+}
+
+// stepIndex adalah index tahap chain yang menunggu keputusan menurut riwayat
+// approvals satu peminjaman.
+func stepIndex(chain []ApprovalStep, approvals []Approval) (index int) {
+	for _, a := range approvals {
+		if index < len(chain) && loanStatusFromStorage(a.Status) == StatusDisetujui && strings.EqualFold(a.Tahap, chain[index].Nama) {
+			index++
+		}
+	}
+	if index >= len(chain) {
+		index = len(chain) - 1
+	}
+	return index
+}
+
+// approvalSnapshot menyimpan katalog alat dan semua riwayat approval yang
+// dibaca sekali, supaya pemeriksaan berkala atas banyak peminjaman tidak
+// membaca sheet untuk setiap peminjaman.
+type approvalSnapshot struct {
+	katalog   []Alat
+	approvals map[int][]Approval
+}
+
+func loadApprovalSnapshot() (*approvalSnapshot, error) {
+	katalog, err := alatRepo.ListAlat()
+	if err != nil {
+		return nil, err
+	}
+	all, err := loanRepo.ListAllApprovals()
+	if err != nil {
+		return nil, err
+	}
+	s := &approvalSnapshot{katalog: katalog, approvals: map[int][]Approval{}}
+	for _, a := range all {
+		s.approvals[a.IDPinjam] = append(s.approvals[a.IDPinjam], a)
+	}
+	return s, nil
+}
+
+// currentStep seperti fungsi currentStep dengan data snapshot.
+func (s *approvalSnapshot) currentStep(loan *Peminjaman) ([]ApprovalStep, int) {
+	chain := approvalChains.chainIn(s.katalog, loan)
+	return chain, stepIndex(chain, s.approvals[loan.ID])
+}
+
+// ApprovalResult adalah hasil satu keputusan pada rantai persetujuan.
+type ApprovalResult struct {
+	Loan  *Peminjaman
+	Chain []ApprovalStep
+	Index int // tahap yang baru diputuskan
+	// Final bernilai true jika status peminjaman sudah berubah: ditolak, atau
+	// tahap terakhir disetujui.
+	Final bool
+}
+
+// decideApproval mencatat keputusan actor untuk tahap yang sedang berjalan.
+// tahap diisi index tahap dari link approval supaya link lama tidak bisa
+// dipakai untuk tahap berikutnya; -1 berarti tahap yang sedang berjalan.
+// Penolakan di tahap mana pun langsung mengakhiri rantai.
+func decideApproval(id int, actor approvalActor, status LoanStatus, tahap int) (*ApprovalResult, error) {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+
+	loan, err := loanRepo.FindLoan(id)
+	if err != nil {
+		return nil, err
+	}
+	if loan.Status != StatusDiajukan {
+		return nil, &TransitionError{ID: id, From: loan.Status, To: status}
+	}
+	chain, index, err := currentStep(loan)
+	if err != nil {
+		return nil, err
+	}
+	if tahap >= 0 && tahap != index {
+		return nil, ErrTahapTerlewati
+	}
+	step := chain[index]
+	if ok, err := stepAllows(id, step, actor, time.Now()); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrBukanGiliran
+	}
+
+	res := &ApprovalResult{Loan: loan, Chain: chain, Index: index}
+	res.Final = status == StatusDitolak || index == len(chain)-1
+	if res.Final {
+		if err := transitionLoanLocked(loan, status, actor.Nama); err != nil {
+			return nil, err
+		}
+	}
+	err = loanRepo.RecordApproval(&Approval{
+		NamaPeminjam: loan.Form.Nama,
+		Approver:     actor.Nama,
+		IDPinjam:     id,
+		Status:       string(status),
+		Tahap:        step.Nama,
+		Username:     actor.Username,
+		TTD:          actor.TTD,
+	})
+	if err != nil {
+		// Status peminjaman dan riwayat approval harus berubah bersama; jika
+		// riwayat gagal ditulis, status dikembalikan ke Diajukan supaya
+		// keputusan bisa diulang.
+		if res.Final {
+			if rerr := loanRepo.UpdateStatus(id, status, StatusDiajukan, ""); rerr != nil {
+				log.Printf("❌ Gagal mengembalikan status peminjaman %s setelah approval gagal dicatat: %v", formatLoanID(id), rerr)
+			}
+		}
+		return nil, err
+	}
+	log.Printf("INFO: Peminjaman %s tahap %d/%d (%s): %s oleh %s", formatLoanID(id), index+1, len(chain), step.Nama, status, actor.Nama)
+	return res, nil
+}
+
+// stepPenerima mengembalikan tujuan notifikasi dan identitas approver satu
+// tahap pada now, setelah memperhitungkan delegasi. Identitas itu yang ditulis
+// di token link approval; mewakili berisi nama approver asli jika permohonan
+// dialihkan ke wakilnya.
+func stepPenerima(st ApprovalStep, now time.Time) (p Penerima, identitas, mewakili string, err error) {
+	if st.Approver == "" {
+		p := approverPenerima()
+		return p, approverIdentity(p), "", nil
+	}
+	return usernamePenerima(st.Approver, now)
+}
+
+// loanApproverPenerima adalah tujuan notifikasi approver setelah peminjaman
+// diputuskan, misalnya pengembalian dan pengingat: approver tahap terakhir
+// rantai peminjaman atau wakilnya pada now. APPROVER_NO hanya dipakai jika
+// approver itu tidak bisa ditentukan.
+func loanApproverPenerima(loan *Peminjaman, now time.Time) Penerima {
+	chain, index, err := currentStep(loan)
+	if err == nil {
+		var p Penerima
+		if p, _, _, err = stepPenerima(chain[index], now); err == nil {
+			return p
+		}
+	}
+	log.Printf("⚠️ Approver peminjaman %s tidak bisa ditentukan, memakai APPROVER_NO: %v", formatLoanID(loan.ID), err)
+	return approverPenerima()
+}
+
+// usernamePenerima seperti stepPenerima untuk satu username akun.
+func usernamePenerima(username string, now time.Time) (Penerima, string, string, error) {
+	u, mewakili, err := resolveApprover(username, now)
+	if err != nil {
+		return Penerima{}, "", "", fmt.Errorf("approver %s: %v", username, err)
+	}
+	return userPenerima(u), u.Username, mewakili, nil
+}
+
+func userPenerima(u *User) Penerima {
+	return Penerima{Nama: u.Nama, NoWA: u.NoWA, Email: u.Email, Kanal: u.Kanal}
+}
+
+// approvalRequestData mengisi pesan permohonan persetujuan tahap ke-index,
+// termasuk link setujui/tolak atas nama identitas.
+func approvalRequestData(loan *Peminjaman, chain []ApprovalStep, index int, penerima Penerima, identitas string, now time.Time) (PesanData, error) {
+	data := newPesanData(loan.ID, loan.Form)
+	data.Approver = penerima.Nama
+	data.DokumenURL = loan.PDFURL
+	data.Langkah, data.LangkahKe, data.JumlahLangkah = chain[index].Nama, index+1, len(chain)
+	var err error
+	data.SetujuURL, data.TolakURL, err = approvalLinks.links(loan.ID, identitas, index, now)
+	if err != nil {
+		return data, fmt.Errorf("gagal membuat link approval: %v", err)
+	}
+	return data, nil
+}
+
+// notifyApprovalStep mengirim permohonan persetujuan ke approver tahap
+// ke-index (atau wakilnya), lalu mencatat waktunya di riwayat pengingat sebagai
+// awal hitungan eskalasi. Error hanya dikembalikan jika pesan gagal dikirim.
+func notifyApprovalStep(loan *Peminjaman, chain []ApprovalStep, index int) error {
+	now := time.Now()
+	penerima, identitas, mewakili, err := stepPenerima(chain[index], now)
+	if err != nil {
+		return err
+	}
+	data, err := approvalRequestData(loan, chain, index, penerima, identitas, now)
+	if err != nil {
+		return err
+	}
+	data.Mewakili = mewakili
+	if err := kirimPesan(penerima, PesanPinjamApprover, data); err != nil {
+		return err
+	}
+	// Pesan sudah masuk antrean, jadi riwayat yang gagal dicatat tidak membuat
+	// notifikasinya dianggap gagal; runApprovalEscalation mencatatnya nanti.
+	if err := reminderRepo.RecordReminder(&Reminder{
+		IDPinjam: loan.ID,
+		Jenis:    jenisPermohonan + chain[index].Nama,
+		Tanggal:  now.Format("2006-01-02 15:04:05"),
+		Penerima: penerimaTujuan(penerima),
+	}); err != nil {
+		log.Printf("⚠️ Gagal mencatat permohonan peminjaman %s tahap %s: %v", formatLoanID(loan.ID), chain[index].Nama, err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// useTestChains memakai rantai persetujuan c selama test.
+func useTestChains(t *testing.T, c *ApprovalChains) {
+	t.Helper()
+	old := approvalChains
+	approvalChains = c
+	t.Cleanup(func() { approvalChains = old })
+}
+
+var testChains = &ApprovalChains{
+	Default: []ApprovalStep{{Nama: "Guru Lab", Approver: "guru.lab"}},
+	Kategori: map[string][]ApprovalStep{
+		"Elektronik":  {{Nama: "Guru Lab", Approver: "guru.lab"}, {Nama: "Wakasek", Approver: "wakasek"}},
+		"Habis Pakai": {{Nama: "guru lab", Approver: "guru.lab"}},
+	},
+}
+
+func TestChainFor(t *testing.T) {
+	newTestStorage(t)
+	for _, a := range []Alat{
+		{Kode: "KAM", Nama: "Kamera", Jumlah: 2, Kategori: "elektronik"},
+		{Kode: "KTS", Nama: "Kertas", Jumlah: 50, Kategori: "Habis Pakai"},
+		{Kode: "MJA", Nama: "Meja", Jumlah: 5},
+	} {
+		if err := alatRepo.SaveAlat(&a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name  string
+		items []ItemPinjam
+		want  []string
+	}{
+		{"kategori terdaftar", []ItemPinjam{{"Kamera", 1}}, []string{"Guru Lab", "Wakasek"}},
+		{"tanpa kategori", []ItemPinjam{{"Meja", 1}}, []string{"Guru Lab"}},
+		{"di luar katalog", []ItemPinjam{{"Drone", 1}}, []string{"Guru Lab"}},
+		{"tahap sama digabung", []ItemPinjam{{"Kertas", 5}, {"Kamera", 1}}, []string{"guru lab", "Wakasek"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := &Peminjaman{}
+			loan.Form.setItems(tt.items)
+			chain, err := testChains.chainFor(loan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, st := range chain {
+				got = append(got, st.Nama)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("chainFor = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("chainFor = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecideApproval(t *testing.T) {
+	newTestStorage(t)
+	useTestChains(t, testChains)
+	if err := alatRepo.SaveAlat(&Alat{Kode: "KAM", Nama: "Kamera", Jumlah: 2, Kategori: "Elektronik"}); err != nil {
+		t.Fatal(err)
+	}
+	guru := approvalActor{Username: "guru.lab", Nama: "Pak Guru"}
+	wakasek := approvalActor{Username: "wakasek", Nama: "Bu Wakasek"}
+	admin := approvalActor{Username: "admin", Nama: "Admin", Super: true}
+
+	t.Run("dua tahap", func(t *testing.T) {
+		loan := createTestLoan(t, StatusDiajukan, "Kamera", 1, "2026-05-11", "2026-05-12")
+		if _, err := decideApproval(loan.ID, wakasek, StatusDisetujui, -1); !errors.Is(err, ErrBukanGiliran) {
+			t.Errorf("wakasek di tahap 1 err = %v, want ErrBukanGiliran", err)
+		}
+		res, err := decideApproval(loan.ID, guru, StatusDisetujui, 0)
+		if err != nil || res.Final || res.Index != 0 {
+			t.Fatalf("tahap 1 = %+v, %v", res, err)
+		}
+		if got, _ := loanRepo.FindLoan(loan.ID); got.Status != StatusDiajukan {
+			t.Errorf("status setelah tahap 1 = %s, want Diajukan", got.Status)
+		}
+		// Link tahap 1 tidak bisa dipakai lagi untuk tahap 2.
+		if _, err := decideApproval(loan.ID, admin, StatusDisetujui, 0); !errors.Is(err, ErrTahapTerlewati) {
+			t.Errorf("link tahap lama err = %v, want ErrTahapTerlewati", err)
+		}
+		res, err = decideApproval(loan.ID, wakasek, StatusDisetujui, 1)
+		if err != nil || !res.Final || res.Index != 1 {
+			t.Fatalf("tahap 2 = %+v, %v", res, err)
+		}
+		got, _ := loanRepo.FindLoan(loan.ID)
+		if got.Status != StatusDisetujui || got.Approver != "Bu Wakasek" {
+			t.Errorf("status akhir = %s oleh %q", got.Status, got.Approver)
+		}
+		approvals, _ := loanRepo.ListApprovals(loan.ID)
+		if len(approvals) != 2 || approvals[0].Tahap != "Guru Lab" || approvals[1].Tahap != "Wakasek" {
+			t.Errorf("riwayat persetujuan = %+v", approvals)
+		}
+		var terr *TransitionError
+		if _, err := decideApproval(loan.ID, admin, StatusDitolak, -1); !errors.As(err, &terr) {
+			t.Errorf("keputusan setelah selesai err = %v, want TransitionError", err)
+		}
+	})
+
+	t.Run("ditolak di tahap pertama", func(t *testing.T) {
+		loan := createTestLoan(t, StatusDiajukan, "Kamera", 1, "2026-05-11", "2026-05-12")
+		res, err := decideApproval(loan.ID, admin, StatusDitolak, -1)
+		if err != nil || !res.Final || res.Index != 0 {
+			t.Fatalf("tolak = %+v, %v", res, err)
+		}
+		if got, _ := loanRepo.FindLoan(loan.ID); got.Status != StatusDitolak {
+			t.Errorf("status = %s, want Ditolak", got.Status)
+		}
+	})
+}
+
+// approvalGagal menggagalkan setiap RecordApproval.
+type approvalGagal struct{ LoanRepository }
+
+func (approvalGagal) RecordApproval(*Approval) error { return errors.New("sheet penuh") }
+
+func TestDecideApprovalRiwayatGagal(t *testing.T) {
+	db := newTestStorage(t)
+	useTestChains(t, &ApprovalChains{Default: []ApprovalStep{{Nama: "Approver"}}})
+	loan := createTestLoan(t, StatusDiajukan, "Kamera", 1, "2026-05-11", "2026-05-12")
+	loanRepo = approvalGagal{db}
+
+	if _, err := decideApproval(loan.ID, approvalActor{Username: "guru1", Nama: "Pak Guru"}, StatusDisetujui, -1); err == nil {
+		t.Fatal("decideApproval berhasil padahal riwayat gagal dicatat")
+	}
+	// Status dikembalikan supaya keputusan bisa diulang.
+	if got, _ := db.FindLoan(loan.ID); got.Status != StatusDiajukan {
+		t.Errorf("status = %s, want Diajukan", got.Status)
+	}
+	loanRepo = db
+	if res, err := decideApproval(loan.ID, approvalActor{Username: "guru1", Nama: "Pak Guru"}, StatusDisetujui, -1); err != nil || !res.Final {
+		t.Errorf("keputusan ulang = %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Error validasi token approval.
+var (
+	ErrTokenInvalid = errors.New("link persetujuan tidak valid")
+	ErrTokenExpired = errors.New("link persetujuan sudah kedaluwarsa")
+)
+
+// approvalClaims adalah isi token approval: satu keputusan untuk satu tahap
+// persetujuan peminjaman oleh satu approver, berlaku sampai Exp (unix detik).
+type approvalClaims struct {
+	ID       int        `json:"id"`
+	Approver string     `json:"approver"`
+	Tahap    int        `json:"tahap"`
+	Status   LoanStatus `json:"status"`
+	Exp      int64      `json:"exp"`
+}
+
+// approvalSigner membuat dan memeriksa token approval yang ditandatangani
+// HMAC-SHA256. Token tidak disimpan; yang mencegah keputusan ganda adalah
+// loanTransitions, karena peminjaman hanya bisa diputuskan saat Diajukan.
+type approvalSigner struct {
+	secret  []byte
+	ttl     time.Duration
+	baseURL string
+}
+
+var approvalLinks *approvalSigner
+
+// newApprovalSignerFromEnv membaca konfigurasi link approval:
+//
+//	APPROVAL_SECRET (jika kosong dibuat acak dan disimpan di APPROVAL_SECRET_PATH, default data/approval_secret)
+//	APPROVAL_LINK_TTL (default 72h)
+//	PUBLIC_URL, alamat backend yang bisa dibuka approver (default http://localhost:8080)
+func newApprovalSignerFromEnv() (*approvalSigner, error) {
+	ttl, err := time.ParseDuration(getEnv("APPROVAL_LINK_TTL", "72h"))
+	if err != nil || ttl <= 0 {
+		return nil, fmt.Errorf("APPROVAL_LINK_TTL tidak valid: %q", getEnv("APPROVAL_LINK_TTL", ""))
+	}
+	secret := os.Getenv("APPROVAL_SECRET")
+	if secret == "" {
+		secret, err = loadOrCreateSecret(getEnv("APPROVAL_SECRET_PATH", filepath.Join("data", "approval_secret")))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &approvalSigner{
+		secret:  []byte(secret),
+		ttl:     ttl,
+		baseURL: strings.TrimRight(getEnv("PUBLIC_URL", "http://localhost:8080"), "/"),
+	}, nil
+}
+
+// loadOrCreateSecret membaca secret dari file, atau membuat secret acak jika
+// file belum ada, supaya link dan sesi yang sudah dibagikan tetap berlaku
+// setelah restart.
+func loadOrCreateSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err == nil && len(strings.TrimSpace(string(b))) > 0 {
+		return strings.TrimSpace(string(b)), nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("gagal membaca %s: %v", path, err)
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(raw)
+	if err := writeFileAtomic(path, []byte(secret)); err != nil {
+		return "", fmt.Errorf("gagal menyimpan secret ke %s: %v", path, err)
+	}
+	log.Printf("INFO: Secret baru dibuat di %s", path)
+	return secret, nil
+}
+
+func (s *approvalSigner) sign(c approvalClaims) (string, error) {
+	return signToken(s.secret, c)
+}
+
+func (s *approvalSigner) verify(token string, now time.Time) (*approvalClaims, error) {
+	var c approvalClaims
+	if err := verifyToken(s.secret, token, &c); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if c.ID <= 0 || c.Approver == "" || c.Tahap < 0 || (c.Status != StatusDisetujui && c.Status != StatusDitolak) {
+		return nil, ErrTokenInvalid
+	}
+	if now.Unix() > c.Exp {
+		return nil, ErrTokenExpired
+	}
+	return &c, nil
+}
+
+// signToken menghasilkan token "<payload JSON>.<HMAC-SHA256>", keduanya
+// base64url. Dipakai untuk link approval dan sesi login.
+func signToken(secret []byte, v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	p := base64.RawURLEncoding.EncodeToString(payload)
+	return p + "." + base64.RawURLEncoding.EncodeToString(tokenMAC(secret, p)), nil
+}
+
+// verifyToken memeriksa tanda tangan token lalu mengisi v dari payload-nya.
+func verifyToken(secret []byte, token string, v interface{}) error {
+	p, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrTokenInvalid
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, tokenMAC(secret, p)) {
+		return ErrTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return ErrTokenInvalid
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+func tokenMAC(secret []byte, payload string) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+// links membuat link setujui dan tolak untuk satu tahap peminjaman dan satu approver.
+func (s *approvalSigner) links(id int, approver string, tahap int, now time.Time) (setuju, tolak string, err error) {
+	exp := now.Add(s.ttl).Unix()
+	for _, l := range []struct {
+		status LoanStatus
+		dst    *string
+	}{{StatusDisetujui, &setuju}, {StatusDitolak, &tolak}} {
+		token, err := s.sign(approvalClaims{ID: id, Approver: approver, Tahap: tahap, Status: l.status, Exp: exp})
+		if err != nil {
+			return "", "", err
+		}
+		*l.dst = s.baseURL + "/approval/link?token=" + url.QueryEscape(token)
+	}
+	return setuju, tolak, nil
+}
+
+// approverIdentity adalah nama yang dicatat sebagai approver. Jika
+// APPROVER_NAMA kosong, nomor WA approver yang dipakai.
+func approverIdentity(p Penerima) string {
+	if p.Nama != "" {
+		return p.Nama
+	}
+	return p.NoWA
+}
+
+var approvalPage = template.Must(template.New("approval").Parse(`<!DOCTYPE html>
+<html lang="id">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Persetujuan Peminjaman {{.ID}}</title></head>
+<body style="font-family: sans-serif; max-width: 32rem; margin: 2rem auto; padding: 0 1rem">
+<h2>Peminjaman {{.ID}}</h2>
+<table>
+<tr><td>Nama</td><td>: {{.Loan.Form.Nama}} ({{.Loan.Form.Kelas}})</td></tr>
+<tr><td>Alat</td><td>: {{.Alat}}</td></tr>
+<tr><td>Tgl Pinjam</td><td>: {{.Loan.Form.TanggalPinjam}}</td></tr>
+<tr><td>Tgl Kembali</td><td>: {{.Loan.Form.TanggalKembali}}</td></tr>
+<tr><td>Keterangan</td><td>: {{.Loan.Form.Keterangan}}</td></tr>
+<tr><td>Status</td><td>: {{.Loan.Status}}</td></tr>
+<tr><td>Tahap</td><td>: {{.Tahap}}</td></tr>
+{{with .Loan.PDFURL}}<tr><td>Dokumen</td><td>: <a href="{{.}}">Formulir peminjaman</a></td></tr>{{end}}
+</table>
+{{if .Bisa}}
+<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<p>{{.Nama}}, keputusan Anda: <b>{{.Claims.Status}}</b></p>
+<button type="submit">Konfirmasi {{.Claims.Status}}</button>
+</form>
+{{else}}
+<p>Tahap ini sudah diputuskan.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// handleApprovalLink membuka link dari pesan approver. GET menampilkan
+// ringkasan peminjaman dan tombol konfirmasi; keputusan baru dicatat pada POST
+// supaya pratinjau link di WA tidak ikut menyetujui.
+func handleApprovalLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	token := r.FormValue("token")
+	claims, err := approvalLinks.verify(token, time.Now())
+	if errors.Is(err, ErrTokenExpired) {
+		http.Error(w, "❌ "+err.Error(), http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Approver pada token adalah username akun, atau nama/nomor dari env untuk
+	// tahap tanpa akun.
+	actor := approvalActor{Username: claims.Approver, Nama: claims.Approver}
+	if u, err := userRepo.FindUser(claims.Approver); err == nil {
+		if !u.Aktif {
+			http.Error(w, "❌ Akun approver sudah nonaktif", http.StatusForbidden)
+			return
+		}
+		actor.Nama = u.Nama
+		actor.TTD = u.TTD
+	}
+
+	if r.Method == http.MethodPost {
+		prosesApproval(w, claims.ID, actor, claims.Status, claims.Tahap)
+		return
+	}
+
+	loan, err := loanRepo.FindLoan(claims.ID)
+	if err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+	chain, index, err := currentStep(loan)
+	if err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+	tahap := fmt.Sprintf("%d/%d", claims.Tahap+1, len(chain))
+	if claims.Tahap < len(chain) {
+		tahap += " " + chain[claims.Tahap].Nama
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = approvalPage.Execute(w, struct {
+		ID     string
+		Loan   *Peminjaman
+		Alat   string
+		Claims *approvalClaims
+		Nama   string
+		Tahap  string
+		Token  string
+		Bisa   bool
+	}{formatLoanID(loan.ID), loan, itemSummary(loan.Form.items()), claims, actor.Nama, tahap, token,
+		loan.Status == StatusDiajukan && index == claims.Tahap})
+	if err != nil {
+		log.Println("Render halaman approval error:", err)
+	}
+}
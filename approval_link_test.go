@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyToken(t *testing.T) {
+	secret := []byte("rahasia")
+	token, err := signToken(secret, approvalClaims{ID: 7, Approver: "guru1", Status: StatusDisetujui, Exp: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, sig, _ := strings.Cut(token, ".")
+	palsu := base64.RawURLEncoding.EncodeToString([]byte(`{"id":8,"approver":"guru1","status":"Disetujui","exp":100}`))
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		token   string
+		wantErr bool
+	}{
+		{"asli", secret, token, false},
+		{"secret lain", []byte("rahasia lain"), token, true},
+		{"payload diganti", secret, palsu + "." + sig, true},
+		{"tanda tangan diganti", secret, payload + "." + sig[:len(sig)-2] + "AA", true},
+		{"tanpa tanda tangan", secret, payload, true},
+		{"tanda tangan bukan base64", secret, payload + ".!!", true},
+		{"kosong", secret, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c approvalClaims
+			err := verifyToken(tt.secret, tt.token, &c)
+			if tt.wantErr {
+				if !errors.Is(err, ErrTokenInvalid) {
+					t.Errorf("err = %v, want ErrTokenInvalid", err)
+				}
+				return
+			}
+			if err != nil || c.ID != 7 || c.Approver != "guru1" {
+				t.Errorf("verifyToken = %+v, %v", c, err)
+			}
+		})
+	}
+}
+
+func TestApprovalSignerVerify(t *testing.T) {
+	now := time.Date(2026, 5, 10, 9, 0, 0, 0, time.UTC)
+	s := &approvalSigner{secret: []byte("rahasia"), ttl: time.Hour}
+	valid := approvalClaims{ID: 7, Approver: "guru1", Tahap: 1, Status: StatusDitolak, Exp: now.Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name    string
+		claims  func(c *approvalClaims)
+		at      time.Time
+		wantErr error
+	}{
+		{"berlaku", func(*approvalClaims) {}, now, nil},
+		{"tepat saat kedaluwarsa", func(*approvalClaims) {}, now.Add(time.Hour), nil},
+		{"kedaluwarsa", func(*approvalClaims) {}, now.Add(time.Hour + time.Second), ErrTokenExpired},
+		{"tanpa approver", func(c *approvalClaims) { c.Approver = "" }, now, ErrTokenInvalid},
+		{"status bukan keputusan", func(c *approvalClaims) { c.Status = StatusDipinjam }, now, ErrTokenInvalid},
+		{"tahap negatif", func(c *approvalClaims) { c.Tahap = -1 }, now, ErrTokenInvalid},
+		{"id kosong", func(c *approvalClaims) { c.ID = 0 }, now, ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.claims(&c)
+			token, err := s.sign(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.verify(token, tt.at)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && *got != c {
+				t.Errorf("claims = %+v, want %+v", *got, c)
+			}
+		})
+	}
+}
+
+func TestApprovalSignerTampering(t *testing.T) {
+	now := time.Date(2026, 5, 10, 9, 0, 0, 0, time.UTC)
+	s := &approvalSigner{secret: []byte("rahasia"), ttl: time.Hour}
+	token, err := s.sign(approvalClaims{ID: 7, Approver: "guru1", Status: StatusDisetujui, Exp: now.Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, sig, _ := strings.Cut(token, ".")
+	palsu := base64.RawURLEncoding.EncodeToString([]byte(`{"id":8,"approver":"guru1","status":"Disetujui","exp":9999999999}`))
+
+	tests := []struct {
+		name   string
+		signer *approvalSigner
+		token  string
+	}{
+		{"secret lain", &approvalSigner{secret: []byte("rahasia lain")}, token},
+		{"payload diganti", s, palsu + "." + sig},
+		{"tanda tangan diganti", s, payload + "." + sig[:len(sig)-2] + "AA"},
+		{"tanpa tanda tangan", s, payload},
+		{"tanda tangan bukan base64", s, payload + ".!!"},
+		{"kosong", s, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.signer.verify(tt.token, now); !errors.Is(err, ErrTokenInvalid) {
+				t.Errorf("err = %v, want ErrTokenInvalid", err)
+			}
+		})
+	}
+}
+
+func TestLoadOrCreateSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	first, err := loadOrCreateSecret(path)
+	if err != nil || len(first) != 64 {
+		t.Fatalf("loadOrCreateSecret = %q, %v", first, err)
+	}
+	if again, err := loadOrCreateSecret(path); err != nil || again != first {
+		t.Errorf("secret berubah setelah dibaca ulang: %q, %v", again, err)
+	}
+}
+
+func TestHandleApprovalLinkPage(t *testing.T) {
+	newTestStorage(t)
+	useTestChains(t, &ApprovalChains{Default: []ApprovalStep{{Nama: "Approver"}}})
+	loan := createTestLoan(t, StatusDiajukan, "Kamera", 1, "2026-05-11", "2026-05-12")
+	s := &approvalSigner{secret: []byte("rahasia"), ttl: time.Hour, baseURL: "http://backend"}
+	old := approvalLinks
+	approvalLinks = s
+	t.Cleanup(func() { approvalLinks = old })
+
+	setuju, _, err := s.links(loan.ID, "guru1", 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(setuju)
+	basi, _ := s.sign(approvalClaims{ID: loan.ID, Approver: "guru1", Status: StatusDisetujui, Exp: time.Now().Add(-time.Minute).Unix()})
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{"berlaku", u.Query().Get("token"), http.StatusOK, "Kamera"},
+		{"kedaluwarsa", basi, http.StatusGone, "kedaluwarsa"},
+		{"palsu", "abc.def", http.StatusForbidden, "tidak valid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handleApprovalLink(w, httptest.NewRequest(http.MethodGet, "/approval/link?token="+url.QueryEscape(tt.token), nil))
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("kode %d %q, want %d berisi %q", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+	// Membuka halaman tidak mengubah status; keputusan baru diambil lewat POST.
+	if stored, _ := loanRepo.FindLoan(loan.ID); stored.Status != StatusDiajukan {
+		t.Errorf("status berubah menjadi %s setelah GET", stored.Status)
+	}
+}
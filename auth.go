@@ -0,0 +1,554 @@
+package main
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role menentukan endpoint yang boleh dipakai seorang pengguna.
+type Role string
+
+const (
+	RoleSiswa      Role = "siswa"
+	RoleApprover   Role = "approver"
+	RoleAdminLab   Role = "admin_lab"
+	RoleSuperAdmin Role = "super_admin" // lolos semua pemeriksaan role
+)
+
+func parseRole(s string) (Role, error) {
+	switch r := Role(strings.ToLower(strings.TrimSpace(s))); r {
+	case RoleSiswa, RoleApprover, RoleAdminLab, RoleSuperAdmin:
+		return r, nil
+	}
+	return "", fmt.Errorf("role harus siswa, approver, admin_lab, atau super_admin, bukan %q", s)
+}
+
+// ErrUserNotFound dikembalikan repository jika username tidak ada.
+var ErrUserNotFound = errors.New("pengguna tidak ditemukan")
+
+// User adalah satu akun login. Nama dipakai sebagai nama approver di surat
+// dan riwayat persetujuan, TTD adalah link gambar tanda tangannya.
+type User struct {
+	Username     string `json:"username"`
+	Nama         string `json:"nama"`
+	Role         Role   `json:"role"`
+	NoWA         string `json:"noWa,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Kanal        string `json:"kanal,omitempty"` // kanal notifikasi seperti Penerima.Kanal
+	Aktif        bool   `json:"aktif"`
+	TTD          string `json:"ttd,omitempty"`
+	PasswordHash string `json:"-"`
+}
+
+func (u *User) hasRole(roles ...Role) bool {
+	if u.Role == RoleSuperAdmin {
+		return true
+	}
+	for _, r := range roles {
+		if u.Role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// UserRepository menyimpan akun pengguna.
+type UserRepository interface {
+	ListUsers() ([]User, error)
+	// FindUser mencari username tanpa membedakan huruf besar/kecil.
+	FindUser(username string) (*User, error)
+	// SaveUser menambah atau memperbarui akun berdasarkan username.
+	SaveUser(u *User) error
+}
+
+var userRepo UserRepository
+
+// newUserRepoFromEnv memakai database SQLite jika backend penyimpanan sqlite,
+// selain itu file USERS_PATH (default data/users.json). Akun tidak disimpan di
+// Google Sheets karena berisi hash password.
+func newUserRepoFromEnv(storage Storage) UserRepository {
+	switch s := storage.(type) {
+	case *sqliteLoanRepository:
+		return s
+	case *mirrorLoanRepository:
+		if db, ok := s.primary.(*sqliteLoanRepository); ok {
+			return db
+		}
+	}
+	return newFileUserRepository(getEnv("USERS_PATH", filepath.Join("data", "users.json")))
+}
+
+// ensureAdminFromEnv membuat akun super admin dari ADMIN_USERNAME dan
+// ADMIN_PASSWORD jika akun itu belum ada, supaya server baru bisa dipakai
+// login pertama kali.
+func ensureAdminFromEnv() error {
+	username := strings.TrimSpace(os.Getenv("ADMIN_USERNAME"))
+	password := os.Getenv("ADMIN_PASSWORD")
+	if username == "" || password == "" {
+		users, err := userRepo.ListUsers()
+		if err == nil && len(users) == 0 {
+			log.Println("⚠️ Belum ada akun pengguna; isi ADMIN_USERNAME dan ADMIN_PASSWORD untuk membuat super admin")
+		}
+		return err
+	}
+	_, err := userRepo.FindUser(username)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	u := &User{
+		Username:     username,
+		Nama:         getEnv("ADMIN_NAMA", username),
+		Role:         RoleSuperAdmin,
+		Aktif:        true,
+		PasswordHash: hash,
+	}
+	if err := userRepo.SaveUser(u); err != nil {
+		return err
+	}
+	log.Printf("INFO: Akun super admin %s dibuat", username)
+	return nil
+}
+
+// Password disimpan sebagai "pbkdf2-sha256$<iterasi>$<salt>$<hash>".
+const passwordIterations = 600000
+
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter <= 0 {
+		return false
+	}
+	salt, err1 := base64.RawStdEncoding.DecodeString(parts[2])
+	want, err2 := base64.RawStdEncoding.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// sessionClaims adalah isi token sesi. Role tidak disimpan di token; akun
+// dibaca ulang setiap request supaya perubahan role dan akun nonaktif langsung
+// berlaku.
+type sessionClaims struct {
+	Username string `json:"u"`
+	Exp      int64  `json:"exp"`
+}
+
+const sessionCookie = "sesi_peminjaman"
+
+// sessionManager menerbitkan token sesi bertanda tangan. Token dikirim sebagai
+// cookie dan juga di body login supaya frontend di domain lain bisa memakainya
+// lewat header Authorization: Bearer.
+type sessionManager struct {
+	secret []byte
+	ttl    time.Duration
+	secure bool
+}
+
+var sessions *sessionManager
+
+// newSessionManagerFromEnv membaca konfigurasi sesi:
+//
+//	SESSION_SECRET (jika kosong dibuat acak dan disimpan di SESSION_SECRET_PATH, default data/session_secret)
+//	SESSION_TTL (default 12h)
+//
+// Cookie diberi atribut Secure jika PUBLIC_URL memakai https.
+func newSessionManagerFromEnv() (*sessionManager, error) {
+	ttl, err := time.ParseDuration(getEnv("SESSION_TTL", "12h"))
+	if err != nil || ttl <= 0 {
+		return nil, fmt.Errorf("SESSION_TTL tidak valid: %q", getEnv("SESSION_TTL", ""))
+	}
+	secret := os.Getenv("SESSION_SECRET")
+	if secret == "" {
+		secret, err = loadOrCreateSecret(getEnv("SESSION_SECRET_PATH", filepath.Join("data", "session_secret")))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &sessionManager{
+		secret: []byte(secret),
+		ttl:    ttl,
+		secure: strings.HasPrefix(getEnv("PUBLIC_URL", ""), "https://"),
+	}, nil
+}
+
+func (m *sessionManager) issue(w http.ResponseWriter, u *User, now time.Time) (string, error) {
+	exp := now.Add(m.ttl)
+	token, err := signToken(m.secret, sessionClaims{Username: u.Username, Exp: exp.Unix()})
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  exp,
+		HttpOnly: true,
+		Secure:   m.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
+
+func (m *sessionManager) clear(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, Secure: m.secure})
+}
+
+// currentUser membaca sesi dari header Authorization atau cookie. Hasilnya nil
+// jika tidak ada sesi yang berlaku atau akunnya sudah nonaktif.
+func (m *sessionManager) currentUser(r *http.Request, now time.Time) (*User, error) {
+	token := ""
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	} else if c, err := r.Cookie(sessionCookie); err == nil {
+		token = c.Value
+	}
+	if token == "" {
+		return nil, nil
+	}
+	var c sessionClaims
+	if err := verifyToken(m.secret, token, &c); err != nil || now.Unix() > c.Exp {
+		return nil, nil
+	}
+	u, err := userRepo.FindUser(c.Username)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !u.Aktif {
+		return nil, nil
+	}
+	return u, nil
+}
+
+type userContextKey struct{}
+
+// userFrom mengembalikan pengguna yang sudah diperiksa requireRole.
+func userFrom(r *http.Request) *User {
+	u, _ := r.Context().Value(userContextKey{}).(*User)
+	return u
+}
+
+// authorize memastikan request punya sesi dengan salah satu role. Jika tidak,
+// response 401/403 sudah ditulis dan ok bernilai false.
+func authorize(w http.ResponseWriter, r *http.Request, roles ...Role) (u *User, ok bool) {
+	u, err := sessions.currentUser(r, time.Now())
+	if err != nil {
+		log.Println("Session error:", err)
+		http.Error(w, "Gagal memeriksa sesi login", http.StatusInternalServerError)
+		return nil, false
+	}
+	if u == nil {
+		http.Error(w, "Silakan login terlebih dahulu", http.StatusUnauthorized)
+		return nil, false
+	}
+	if !u.hasRole(roles...) {
+		http.Error(w, "Akun Anda tidak punya akses ke fitur ini", http.StatusForbidden)
+		return nil, false
+	}
+	return u, true
+}
+
+// requireRole membungkus handler yang hanya boleh dipakai role tertentu.
+// Handler bisa membaca penggunanya lewat userFrom.
+func requireRole(h http.HandlerFunc, roles ...Role) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authorize(w, r, roles...)
+		if !ok {
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, u)))
+	}
+}
+
+// LoginResponse adalah hasil POST /auth/login.
+type LoginResponse struct {
+	Token string `json:"token"`
+	User  *User  `json:"user"`
+}
+
+// handleLogin: POST /auth/login dengan username dan password.
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseMultipartForm(10 << 20)
+	username := strings.TrimSpace(r.FormValue("username"))
+	password := r.FormValue("password")
+	if username == "" || password == "" {
+		http.Error(w, "Username dan password harus diisi", http.StatusBadRequest)
+		return
+	}
+	u, err := userRepo.FindUser(username)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		log.Println("Find user error:", err)
+		http.Error(w, "Gagal membaca akun", http.StatusInternalServerError)
+		return
+	}
+	if u == nil || !u.Aktif || !checkPassword(u.PasswordHash, password) {
+		http.Error(w, "Username atau password salah", http.StatusUnauthorized)
+		return
+	}
+	token, err := sessions.issue(w, u, time.Now())
+	if err != nil {
+		log.Println("Issue session error:", err)
+		http.Error(w, "Gagal membuat sesi login", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("INFO: %s (%s) login", u.Username, u.Role)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LoginResponse{Token: token, User: u})
+}
+
+// handleLogout menghapus cookie sesi. Token yang dipegang frontend tetap
+// berlaku sampai kedaluwarsa, jadi frontend juga harus membuangnya.
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sessions.clear(w)
+	w.Write([]byte("✅ Logout berhasil"))
+}
+
+// handleMe mengembalikan akun yang sedang login.
+func handleMe(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userFrom(r))
+}
+
+// handleUsers: GET menampilkan semua akun, POST menambah atau memperbarui satu
+// akun. Password boleh dikosongkan saat memperbarui akun. Field kanal memilih
+// notifikasi ("wa", "email", atau keduanya) untuk approver; kosong berarti wa.
+func handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := userRepo.ListUsers()
+		if err != nil {
+			log.Println("List users error:", err)
+			http.Error(w, "Gagal membaca akun", http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = []User{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	case http.MethodPost:
+		r.ParseMultipartForm(10 << 20)
+		username := strings.TrimSpace(r.FormValue("username"))
+		if username == "" || strings.ContainsAny(username, " \t") {
+			http.Error(w, "Username harus diisi dan tidak boleh mengandung spasi", http.StatusBadRequest)
+			return
+		}
+		role, err := parseRole(r.FormValue("role"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		u, err := userRepo.FindUser(username)
+		if errors.Is(err, ErrUserNotFound) {
+			u = &User{Username: username}
+		} else if err != nil {
+			log.Println("Find user error:", err)
+			http.Error(w, "Gagal membaca akun", http.StatusInternalServerError)
+			return
+		}
+		u.Nama = strings.TrimSpace(r.FormValue("nama"))
+		u.Role = role
+		u.NoWA = strings.TrimSpace(r.FormValue("noWa"))
+		u.Aktif = r.FormValue("aktif") != "false"
+		if u.Nama == "" {
+			http.Error(w, "Nama harus diisi", http.StatusBadRequest)
+			return
+		}
+		if u.Email, err = parseEmail(r.FormValue("email")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if u.Kanal, err = parseKanal(r.FormValue("kanal")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.Contains(u.Kanal, KanalEmail) && u.Email == "" {
+			http.Error(w, "Email harus diisi jika memilih notifikasi email", http.StatusBadRequest)
+			return
+		}
+		if password := r.FormValue("password"); password != "" {
+			if len(password) < 8 {
+				http.Error(w, "Password minimal 8 karakter", http.StatusBadRequest)
+				return
+			}
+			if u.PasswordHash, err = hashPassword(password); err != nil {
+				log.Println("Hash password error:", err)
+				http.Error(w, "Gagal menyimpan akun", http.StatusInternalServerError)
+				return
+			}
+		} else if u.PasswordHash == "" {
+			http.Error(w, "Password harus diisi untuk akun baru", http.StatusBadRequest)
+			return
+		}
+		if self := userFrom(r); self != nil && strings.EqualFold(self.Username, u.Username) && (u.Role != RoleSuperAdmin || !u.Aktif) {
+			http.Error(w, "Tidak bisa menurunkan role atau menonaktifkan akun sendiri", http.StatusBadRequest)
+			return
+		}
+		if err := userRepo.SaveUser(u); err != nil {
+			log.Println("Save user error:", err)
+			http.Error(w, "Gagal menyimpan akun", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "✅ Akun %s (%s) disimpan", u.Username, u.Role)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// fileUserRepository menyimpan akun di satu file JSON untuk backend sheets.
+type fileUserRepository struct {
+	path string
+
+	mu     sync.Mutex
+	users  []User
+	loaded bool
+}
+
+// fileUser menyertakan hash password yang disembunyikan dari JSON API.
+type fileUser struct {
+	User
+	PasswordHash string `json:"passwordHash"`
+}
+
+func newFileUserRepository(path string) *fileUserRepository {
+	return &fileUserRepository{path: path}
+}
+
+func (f *fileUserRepository) load() error {
+	if f.loaded {
+		return nil
+	}
+	b, err := os.ReadFile(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("gagal membaca %s: %v", f.path, err)
+	}
+	if err == nil {
+		var list []fileUser
+		if err := json.Unmarshal(b, &list); err != nil {
+			return fmt.Errorf("file akun %s rusak: %v", f.path, err)
+		}
+		for _, fu := range list {
+			u := fu.User
+			u.PasswordHash = fu.PasswordHash
+			f.users = append(f.users, u)
+		}
+	}
+	f.loaded = true
+	return nil
+}
+
+func (f *fileUserRepository) save() error {
+	list := make([]fileUser, len(f.users))
+	for i, u := range f.users {
+		list[i] = fileUser{User: u, PasswordHash: u.PasswordHash}
+	}
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(f.path, b); err != nil {
+		return fmt.Errorf("gagal menyimpan akun: %v", err)
+	}
+	return nil
+}
+
+func (f *fileUserRepository) ListUsers() ([]User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return append([]User(nil), f.users...), nil
+}
+
+func (f *fileUserRepository) FindUser(username string) (*User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	for _, u := range f.users {
+		if strings.EqualFold(u.Username, username) {
+			return &u, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (f *fileUserRepository) SaveUser(u *User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(); err != nil {
+		return err
+	}
+	for i := range f.users {
+		if strings.EqualFold(f.users[i].Username, u.Username) {
+			old := f.users[i]
+			f.users[i] = *u
+			if err := f.save(); err != nil {
+				f.users[i] = old
+				return err
+			}
+			return nil
+		}
+	}
+	f.users = append(f.users, *u)
+	if err := f.save(); err != nil {
+		f.users = f.users[:len(f.users)-1]
+		return err
+	}
+	return nil
+}
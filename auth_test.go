@@ -0,0 +1,339 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestSessions memakai sessionManager dengan secret tetap selama test.
+func useTestSessions(t *testing.T) *sessionManager {
+	t.Helper()
+	old := sessions
+	sessions = &sessionManager{secret: []byte("rahasia"), ttl: time.Hour}
+	t.Cleanup(func() { sessions = old })
+	return sessions
+}
+
+// saveTestUser menyimpan akun aktif dengan password "rahasia123".
+func saveTestUser(t *testing.T, username string, role Role) *User {
+	t.Helper()
+	hash, err := hashPassword("rahasia123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &User{Username: username, Nama: "Pak " + username, Role: role, Aktif: true, PasswordHash: hash}
+	if err := userRepo.SaveUser(u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// withSession menambahkan token sesi u ke r.
+func withSession(t *testing.T, r *http.Request, u *User) *http.Request {
+	t.Helper()
+	token, err := sessions.issue(httptest.NewRecorder(), u, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Role
+		wantErr bool
+	}{
+		{"siswa", RoleSiswa, false},
+		{" Approver ", RoleApprover, false},
+		{"ADMIN_LAB", RoleAdminLab, false},
+		{"super_admin", RoleSuperAdmin, false},
+		{"guru", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseRole(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseRole(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role  Role
+		roles []Role
+		want  bool
+	}{
+		{RoleApprover, []Role{RoleApprover}, true},
+		{RoleSiswa, []Role{RoleApprover, RoleAdminLab}, false},
+		{RoleAdminLab, []Role{RoleApprover, RoleAdminLab}, true},
+		{RoleSuperAdmin, []Role{RoleApprover}, true},
+		{RoleSuperAdmin, nil, true},
+	}
+	for _, tt := range tests {
+		u := &User{Role: tt.role}
+		if got := u.hasRole(tt.roles...); got != tt.want {
+			t.Errorf("%s.hasRole(%v) = %v, want %v", tt.role, tt.roles, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := hashPassword("rahasia123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := hashPassword("rahasia123"); other == hash {
+		t.Error("dua hash password yang sama memakai salt yang sama")
+	}
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{"benar", hash, "rahasia123", true},
+		{"salah", hash, "rahasia124", false},
+		{"kosong", hash, "", false},
+		{"format lain", strings.Replace(hash, "pbkdf2-sha256", "bcrypt", 1), "rahasia123", false},
+		{"iterasi rusak", strings.Replace(hash, "$600000$", "$x$", 1), "rahasia123", false},
+		{"bukan hash", "rahasia123", "rahasia123", false},
+	}
+	for _, tt := range tests {
+		if got := checkPassword(tt.hash, tt.password); got != tt.want {
+			t.Errorf("%s: checkPassword = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSessionCurrentUser(t *testing.T) {
+	newTestStorage(t)
+	m := useTestSessions(t)
+	now := time.Date(2026, 5, 10, 9, 0, 0, 0, time.UTC)
+	budi := saveTestUser(t, "budi", RoleSiswa)
+
+	rec := httptest.NewRecorder()
+	token, err := m.issue(rec, budi, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != token || !cookies[0].HttpOnly {
+		t.Fatalf("cookie sesi = %+v", cookies)
+	}
+	other := &sessionManager{secret: []byte("rahasia lain"), ttl: time.Hour}
+	palsu, _ := other.issue(httptest.NewRecorder(), budi, now)
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		at     time.Time
+		want   string
+	}{
+		{"bearer", "Bearer " + token, "", now, "budi"},
+		{"cookie", "", token, now, "budi"},
+		{"tanpa sesi", "", "", now, ""},
+		{"kedaluwarsa", "Bearer " + token, "", now.Add(time.Hour + time.Second), ""},
+		{"secret lain", "Bearer " + palsu, "", now, ""},
+		{"token rusak", "Bearer " + token[:len(token)-2] + "AA", "", now, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: sessionCookie, Value: tt.cookie})
+			}
+			u, err := m.currentUser(r, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if u != nil {
+				got = u.Username
+			}
+			if got != tt.want {
+				t.Errorf("currentUser = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Akun yang dinonaktifkan langsung kehilangan sesinya.
+	budi.Aktif = false
+	if err := userRepo.SaveUser(budi); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if u, err := m.currentUser(r, now); u != nil || err != nil {
+		t.Errorf("currentUser akun nonaktif = %+v, %v", u, err)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	newTestStorage(t)
+	m := useTestSessions(t)
+	siswa := saveTestUser(t, "siswa1", RoleSiswa)
+	guru := saveTestUser(t, "guru1", RoleApprover)
+	admin := saveTestUser(t, "admin", RoleSuperAdmin)
+
+	var got *User
+	h := requireRole(func(w http.ResponseWriter, r *http.Request) { got = userFrom(r) }, RoleApprover)
+	tests := []struct {
+		name string
+		user *User
+		want int
+	}{
+		{"tanpa login", nil, http.StatusUnauthorized},
+		{"role lain", siswa, http.StatusForbidden},
+		{"role sesuai", guru, http.StatusOK},
+		{"super admin", admin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			r := httptest.NewRequest(http.MethodGet, "/approve", nil)
+			if tt.user != nil {
+				token, _ := m.issue(httptest.NewRecorder(), tt.user, time.Now())
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			h(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && (got == nil || got.Username != tt.user.Username) {
+				t.Errorf("userFrom = %+v, want %s", got, tt.user.Username)
+			}
+		})
+	}
+}
+
+func TestHandleLogin(t *testing.T) {
+	newTestStorage(t)
+	useTestSessions(t)
+	saveTestUser(t, "guru1", RoleApprover)
+	nonaktif := saveTestUser(t, "guru2", RoleApprover)
+	nonaktif.Aktif = false
+	if err := userRepo.SaveUser(nonaktif); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		username string
+		password string
+		want     int
+	}{
+		{"berhasil", http.MethodPost, "GURU1", "rahasia123", http.StatusOK},
+		{"password salah", http.MethodPost, "guru1", "salah", http.StatusUnauthorized},
+		{"tidak terdaftar", http.MethodPost, "guru9", "rahasia123", http.StatusUnauthorized},
+		{"nonaktif", http.MethodPost, "guru2", "rahasia123", http.StatusUnauthorized},
+		{"kosong", http.MethodPost, "", "", http.StatusBadRequest},
+		{"GET", http.MethodGet, "guru1", "rahasia123", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"username": {tt.username}, "password": {tt.password}}
+			r := httptest.NewRequest(tt.method, "/auth/login", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			handleLogin(rec, r)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			body := rec.Body.String()
+			if !strings.Contains(body, `"token":"`) || !strings.Contains(body, `"username":"guru1"`) || strings.Contains(body, "pbkdf2") {
+				t.Errorf("body login = %s", body)
+			}
+		})
+	}
+}
+
+func TestHandleUsersKanal(t *testing.T) {
+	newTestStorage(t)
+	tests := []struct {
+		name      string
+		email     string
+		kanal     string
+		want      int
+		wantKanal string
+	}{
+		{"email saja", " guru@sekolah.sch.id ", "email", http.StatusOK, KanalEmail},
+		{"keduanya", "guru@sekolah.sch.id", "wa,email", http.StatusOK, KanalWA + "," + KanalEmail},
+		{"email ada tetapi pilih wa", "guru@sekolah.sch.id", "", http.StatusOK, KanalWA},
+		{"email tanpa alamat", "", "email", http.StatusBadRequest, ""},
+		{"email tidak valid", "guru@sekolah.sch.id\r\nBcc: x@y.id", "email", http.StatusBadRequest, ""},
+		{"kanal tidak dikenal", "guru@sekolah.sch.id", "sms", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"username": {"guru1"}, "nama": {"Pak Guru"}, "role": {"approver"}, "password": {"rahasia123"},
+				"noWa": {"0811"}, "email": {tt.email}, "kanal": {tt.kanal}}
+			r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			handleUsers(rec, r)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			u, err := userRepo.FindUser("guru1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p := userPenerima(u); p.Kanal != tt.wantKanal || p.Email != "guru@sekolah.sch.id" {
+				t.Errorf("penerima = %+v, want kanal %s", p, tt.wantKanal)
+			}
+		})
+	}
+}
+
+func TestFileUserRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	repo := newFileUserRepository(path)
+	if list, err := repo.ListUsers(); err != nil || len(list) != 0 {
+		t.Fatalf("ListUsers file baru = %+v, %v", list, err)
+	}
+	for _, u := range []User{
+		{Username: "guru1", Nama: "Pak Guru", Role: RoleApprover, Aktif: true, PasswordHash: "hash1"},
+		{Username: "admin", Nama: "Admin", Role: RoleSuperAdmin, Aktif: true, PasswordHash: "hash2"},
+		{Username: "Guru1", Nama: "Pak Guru Baru", Role: RoleApprover, PasswordHash: "hash3"},
+	} {
+		if err := repo.SaveUser(&u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Dibaca ulang dari file: hash password ikut tersimpan dan username yang
+	// sama hanya memperbarui akun lama.
+	again := newFileUserRepository(path)
+	list, err := again.ListUsers()
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListUsers = %+v, %v", list, err)
+	}
+	u, err := again.FindUser("GURU1")
+	if err != nil || u.Nama != "Pak Guru Baru" || u.PasswordHash != "hash3" || u.Aktif {
+		t.Errorf("FindUser = %+v, %v", u, err)
+	}
+	if _, err := again.FindUser("guru9"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("FindUser(guru9) err = %v, want ErrUserNotFound", err)
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDelegasiNotFound dikembalikan repository jika ID delegasi tidak ada.
+var ErrDelegasiNotFound = errors.New("delegasi tidak ditemukan")
+
+// Delegasi mengalihkan permohonan persetujuan untuk approver Dari ke approver
+// Kepada selama Mulai sampai Selesai (YYYY-MM-DD, keduanya ikut), misalnya
+// saat guru cuti.
+type Delegasi struct {
+	ID         int    `json:"id"`
+	Dari       string `json:"dari"`
+	Kepada     string `json:"kepada"`
+	Mulai      string `json:"mulai"`
+	Selesai    string `json:"selesai"`
+	Alasan     string `json:"alasan,omitempty"`
+	DibuatOleh string `json:"dibuatOleh"`
+	Dibuat     string `json:"dibuat"`
+	Dibatalkan bool   `json:"dibatalkan"`
+}
+
+// berlaku bernilai true jika delegasi aktif pada tanggal day.
+func (d *Delegasi) berlaku(day time.Time) bool {
+	tgl := day.Format("2006-01-02")
+	return !d.Dibatalkan && d.Mulai <= tgl && tgl <= d.Selesai
+}
+
+// DelegationRepository menyimpan jadwal delegasi approver.
+type DelegationRepository interface {
+	ListDelegations() ([]Delegasi, error)
+	// SaveDelegation menambah delegasi baru (ID 0, lalu d.ID diisi) atau
+	// memperbarui delegasi yang sudah ada.
+	SaveDelegation(d *Delegasi) error
+}
+
+var delegationRepo DelegationRepository
+
+// newDelegationRepoFromEnv memakai database SQLite jika backend penyimpanan
+// sqlite, selain itu file DELEGASI_PATH (default data/delegasi.json).
+func newDelegationRepoFromEnv(storage Storage) DelegationRepository {
+	switch s := storage.(type) {
+	case *sqliteLoanRepository:
+		return s
+	case *mirrorLoanRepository:
+		if db, ok := s.primary.(*sqliteLoanRepository); ok {
+			return db
+		}
+	}
+	return newFileDelegationRepository(getEnv("DELEGASI_PATH", filepath.Join("data", "delegasi.json")))
+}
+
+// maxDelegasi membatasi delegasi bersambung (A ke B, B juga cuti ke C, ...)
+// dan mencegah putaran A ke B ke A.
+const maxDelegasi = 5
+
+// delegationPath mengembalikan username approver beserta semua wakilnya yang
+// berlaku pada now, urut dari approver asli. Wakil yang akunnya tidak ada atau
+// nonaktif tidak dipakai.
+func delegationPath(username string, now time.Time) ([]string, error) {
+	list, err := delegationRepo.ListDelegations()
+	if err != nil {
+		return nil, err
+	}
+	path := []string{username}
+	seen := map[string]bool{strings.ToLower(username): true}
+	cur := username
+	for len(path) <= maxDelegasi {
+		var next string
+		for i := range list {
+			d := &list[i]
+			if strings.EqualFold(d.Dari, cur) && d.berlaku(now) {
+				next = d.Kepada
+			}
+		}
+		if next == "" || seen[strings.ToLower(next)] {
+			break
+		}
+		u, err := userRepo.FindUser(next)
+		if err != nil || !u.Aktif {
+			break
+		}
+		seen[strings.ToLower(u.Username)] = true
+		path = append(path, u.Username)
+		cur = u.Username
+	}
+	return path, nil
+}
+
+// resolveApprover mengembalikan akun yang menerima permohonan untuk username
+// pada now, dan nama approver asli jika permohonan dialihkan ke wakil.
+func resolveApprover(username string, now time.Time) (u *User, mewakili string, err error) {
+	path, err := delegationPath(username, now)
+	if err != nil {
+		return nil, "", err
+	}
+	u, err = userRepo.FindUser(path[len(path)-1])
+	if err != nil {
+		return nil, "", err
+	}
+	if len(path) > 1 {
+		mewakili = path[0]
+		if asal, err := userRepo.FindUser(path[0]); err == nil {
+			mewakili = asal.Nama
+		}
+	}
+	return u, mewakili, nil
+}
+
+// ApproverInfo adalah satu baris direktori approver di GET /approvers.
+type ApproverInfo struct {
+	Username string `json:"username"`
+	Nama     string `json:"nama"`
+	NoWA     string `json:"noWa,omitempty"`
+	Email    string `json:"email,omitempty"`
+	// DiwakilkanKe terisi jika hari ini permohonan untuk approver ini dialihkan.
+	DiwakilkanKe string `json:"diwakilkanKe,omitempty"`
+}
+
+// handleApprovers menampilkan direktori approver: akun aktif dengan role
+// approver beserta nomor WA dan wakilnya hari ini.
+func handleApprovers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	users, err := userRepo.ListUsers()
+	if err != nil {
+		log.Println("List users error:", err)
+		http.Error(w, "Gagal membaca akun", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	list := []ApproverInfo{}
+	for _, u := range users {
+		if !u.Aktif || !u.hasRole(RoleApprover) {
+			continue
+		}
+		info := ApproverInfo{Username: u.Username, Nama: u.Nama, NoWA: u.NoWA, Email: u.Email}
+		if path, err := delegationPath(u.Username, now); err == nil && len(path) > 1 {
+			info.DiwakilkanKe = path[len(path)-1]
+		}
+		list = append(list, info)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleDelegasi: GET menampilkan delegasi (approver hanya melihat yang
+// melibatkan dirinya), POST membuat delegasi baru. Approver hanya bisa
+// mendelegasikan dirinya sendiri; admin lab bisa mengisi dari untuk approver
+// lain.
+func handleDelegasi(w http.ResponseWriter, r *http.Request) {
+	self := userFrom(r)
+	admin := self.hasRole(RoleAdminLab)
+	switch r.Method {
+	case http.MethodGet:
+		all, err := delegationRepo.ListDelegations()
+		if err != nil {
+			log.Println("List delegasi error:", err)
+			http.Error(w, "Gagal membaca delegasi", http.StatusInternalServerError)
+			return
+		}
+		list := []Delegasi{}
+		for _, d := range all {
+			if admin || strings.EqualFold(d.Dari, self.Username) || strings.EqualFold(d.Kepada, self.Username) {
+				list = append(list, d)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	case http.MethodPost:
+		r.ParseMultipartForm(10 << 20)
+		d := &Delegasi{
+			Dari:       strings.TrimSpace(r.FormValue("dari")),
+			Kepada:     strings.TrimSpace(r.FormValue("kepada")),
+			Mulai:      strings.TrimSpace(r.FormValue("mulai")),
+			Selesai:    strings.TrimSpace(r.FormValue("selesai")),
+			Alasan:     strings.TrimSpace(r.FormValue("alasan")),
+			DibuatOleh: self.Username,
+			Dibuat:     time.Now().Format("2006-01-02 15:04:05"),
+		}
+		if d.Dari == "" {
+			d.Dari = self.Username
+		}
+		if !admin && !strings.EqualFold(d.Dari, self.Username) {
+			http.Error(w, "❌ Hanya admin lab yang bisa membuat delegasi untuk approver lain", http.StatusForbidden)
+			return
+		}
+		if err := validateDelegasi(d); err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := delegationRepo.SaveDelegation(d); err != nil {
+			log.Println("Save delegasi error:", err)
+			http.Error(w, "Gagal menyimpan delegasi", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("INFO: Delegasi %d: %s ke %s (%s s.d. %s) oleh %s", d.ID, d.Dari, d.Kepada, d.Mulai, d.Selesai, self.Username)
+		fmt.Fprintf(w, "✅ Permohonan untuk %s dialihkan ke %s mulai %s sampai %s", d.Dari, d.Kepada, d.Mulai, d.Selesai)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validateDelegasi memeriksa tanggal dan akun, lalu menormalkan username
+// sesuai akun yang tersimpan.
+func validateDelegasi(d *Delegasi) error {
+	mulai, err := time.Parse("2006-01-02", d.Mulai)
+	if err != nil {
+		return fmt.Errorf("tanggal mulai harus YYYY-MM-DD")
+	}
+	selesai, err := time.Parse("2006-01-02", d.Selesai)
+	if err != nil {
+		return fmt.Errorf("tanggal selesai harus YYYY-MM-DD")
+	}
+	if selesai.Before(mulai) {
+		return fmt.Errorf("tanggal selesai tidak boleh sebelum tanggal mulai")
+	}
+	if strings.EqualFold(d.Dari, d.Kepada) {
+		return fmt.Errorf("approver tidak bisa mewakilkan ke dirinya sendiri")
+	}
+	dari, err := userRepo.FindUser(d.Dari)
+	if err != nil {
+		return fmt.Errorf("approver %s tidak ditemukan", d.Dari)
+	}
+	kepada, err := userRepo.FindUser(d.Kepada)
+	if err != nil {
+		return fmt.Errorf("approver pengganti %s tidak ditemukan", d.Kepada)
+	}
+	if !kepada.Aktif || !kepada.hasRole(RoleApprover) {
+		return fmt.Errorf("%s bukan approver aktif", kepada.Username)
+	}
+	d.Dari, d.Kepada = dari.Username, kepada.Username
+	return nil
+}
+
+// handleDelegasiBatal membatalkan delegasi: POST id=<id>. Hanya approver asal,
+// pembuat delegasi, atau admin lab yang bisa membatalkan.
+func handleDelegasiBatal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "ID delegasi tidak valid", http.StatusBadRequest)
+		return
+	}
+	list, err := delegationRepo.ListDelegations()
+	if err != nil {
+		log.Println("List delegasi error:", err)
+		http.Error(w, "Gagal membaca delegasi", http.StatusInternalServerError)
+		return
+	}
+	var d *Delegasi
+	for i := range list {
+		if list[i].ID == id {
+			d = &list[i]
+		}
+	}
+	if d == nil {
+		http.Error(w, ErrDelegasiNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	self := userFrom(r)
+	if !self.hasRole(RoleAdminLab) && !strings.EqualFold(d.Dari, self.Username) && !strings.EqualFold(d.DibuatOleh, self.Username) {
+		http.Error(w, "❌ Delegasi ini bukan milik Anda", http.StatusForbidden)
+		return
+	}
+	d.Dibatalkan = true
+	if err := delegationRepo.SaveDelegation(d); err != nil {
+		log.Println("Save delegasi error:", err)
+		http.Error(w, "Gagal menyimpan delegasi", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "✅ Delegasi %d dibatalkan", d.ID)
+}
+
+// fileDelegationRepository menyimpan delegasi di satu file JSON untuk backend sheets.
+type fileDelegationRepository struct {
+	path string
+
+	mu     sync.Mutex
+	list   []Delegasi
+	loaded bool
+}
+
+func newFileDelegationRepository(path string) *fileDelegationRepository {
+	return &fileDelegationRepository{path: path}
+}
+
+func (f *fileDelegationRepository) load() error {
+	if f.loaded {
+		return nil
+	}
+	b, err := os.ReadFile(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("gagal membaca %s: %v", f.path, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &f.list); err != nil {
+			return fmt.Errorf("file delegasi %s rusak: %v", f.path, err)
+		}
+	}
+	f.loaded = true
+	return nil
+}
+
+func (f *fileDelegationRepository) save() error {
+	b, err := json.MarshalIndent(f.list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(f.path, b); err != nil {
+		return fmt.Errorf("gagal menyimpan delegasi: %v", err)
+	}
+	return nil
+}
+
+func (f *fileDelegationRepository) ListDelegations() ([]Delegasi, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return append([]Delegasi(nil), f.list...), nil
+}
+
+func (f *fileDelegationRepository) SaveDelegation(d *Delegasi) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(); err != nil {
+		return err
+	}
+	old := append([]Delegasi(nil), f.list...)
+	baru := d.ID == 0
+	if baru {
+		d.ID = 1
+		for _, existing := range f.list {
+			if existing.ID >= d.ID {
+				d.ID = existing.ID + 1
+			}
+		}
+		f.list = append(f.list, *d)
+	} else {
+		found := false
+		for i := range f.list {
+			if f.list[i].ID == d.ID {
+				f.list[i] = *d
+				found = true
+			}
+		}
+		if !found {
+			return ErrDelegasiNotFound
+		}
+	}
+	if err := f.save(); err != nil {
+		f.list = old
+		if baru {
+			d.ID = 0
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDelegationPath(t *testing.T) {
+	now := time.Date(2026, 5, 10, 9, 0, 0, 0, time.Local)
+	tests := []struct {
+		name     string
+		delegasi []Delegasi
+		want     []string
+	}{
+		{
+			name: "tanpa delegasi",
+			want: []string{"guru1"},
+		},
+		{
+			name:     "satu wakil",
+			delegasi: []Delegasi{{Dari: "guru1", Kepada: "guru2", Mulai: "2026-05-01", Selesai: "2026-05-10"}},
+			want:     []string{"guru1", "guru2"},
+		},
+		{
+			name:     "nama akun tidak membedakan huruf besar",
+			delegasi: []Delegasi{{Dari: "GURU1", Kepada: "Guru2", Mulai: "2026-05-10", Selesai: "2026-05-10"}},
+			want:     []string{"guru1", "guru2"},
+		},
+		{
+			name: "bersambung",
+			delegasi: []Delegasi{
+				{Dari: "guru1", Kepada: "guru2", Mulai: "2026-05-01", Selesai: "2026-05-31"},
+				{Dari: "guru2", Kepada: "guru3", Mulai: "2026-05-09", Selesai: "2026-05-11"},
+			},
+			want: []string{"guru1", "guru2", "guru3"},
+		},
+		{
+			name:     "belum mulai",
+			delegasi: []Delegasi{{Dari: "guru1", Kepada: "guru2", Mulai: "2026-05-11", Selesai: "2026-05-20"}},
+			want:     []string{"guru1"},
+		},
+		{
+			name:     "sudah selesai",
+			delegasi: []Delegasi{{Dari: "guru1", Kepada: "guru2", Mulai: "2026-05-01", Selesai: "2026-05-09"}},
+			want:     []string{"guru1"},
+		},
+		{
+			name:     "dibatalkan",
+			delegasi: []Delegasi{{Dari: "guru1", Kepada: "guru2", Mulai: "2026-05-01", Selesai: "2026-05-31", Dibatalkan: true}},
+			want:     []string{"guru1"},
+		},
+		{
+			name: "putaran berhenti",
+			delegasi: []Delegasi{
+				{Dari: "guru1", Kepada: "guru2", Mulai: "2026-05-01", Selesai: "2026-05-31"},
+				{Dari: "guru2", Kepada: "guru1", Mulai: "2026-05-01", Selesai: "2026-05-31"},
+			},
+			want: []string{"guru1", "guru2"},
+		},
+		{
+			name:     "wakil nonaktif",
+			delegasi: []Delegasi{{Dari: "guru1", Kepada: "pensiun", Mulai: "2026-05-01", Selesai: "2026-05-31"}},
+			want:     []string{"guru1"},
+		},
+		{
+			name:     "wakil tidak punya akun",
+			delegasi: []Delegasi{{Dari: "guru1", Kepada: "tamu", Mulai: "2026-05-01", Selesai: "2026-05-31"}},
+			want:     []string{"guru1"},
+		},
+		{
+			name: "dibatasi maxDelegasi",
+			delegasi: []Delegasi{
+				{Dari: "guru1", Kepada: "guru2", Mulai: "2026-05-01", Selesai: "2026-05-31"},
+				{Dari: "guru2", Kepada: "guru3", Mulai: "2026-05-01", Selesai: "2026-05-31"},
+				{Dari: "guru3", Kepada: "guru4", Mulai: "2026-05-01", Selesai: "2026-05-31"},
+				{Dari: "guru4", Kepada: "guru5", Mulai: "2026-05-01", Selesai: "2026-05-31"},
+				{Dari: "guru5", Kepada: "guru6", Mulai: "2026-05-01", Selesai: "2026-05-31"},
+				{Dari: "guru6", Kepada: "guru7", Mulai: "2026-05-01", Selesai: "2026-05-31"},
+				{Dari: "guru7", Kepada: "guru8", Mulai: "2026-05-01", Selesai: "2026-05-31"},
+			},
+			want: []string{"guru1", "guru2", "guru3", "guru4", "guru5", "guru6"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestStorage(t)
+			for _, u := range []string{"guru1", "guru2", "guru3", "guru4", "guru5", "guru6", "guru7", "guru8"} {
+				if err := userRepo.SaveUser(&User{Username: u, Nama: u, Role: RoleApprover, Aktif: true}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			userRepo.SaveUser(&User{Username: "pensiun", Nama: "Pensiun", Role: RoleApprover})
+			for i := range tt.delegasi {
+				if err := delegationRepo.SaveDelegation(&tt.delegasi[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := delegationPath("guru1", now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("delegationPath = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrPlaceholderNotFound dikembalikan jika placeholder gambar atau tabel tidak
+// ada di dokumen.
+var ErrPlaceholderNotFound = errors.New("placeholder tidak ditemukan")
+
+// docxDocument adalah isi file .docx di memori. Placeholder seperti <<NAMA>>
+// diganti langsung pada XML-nya, tanpa Google Docs.
+type docxDocument struct {
+	names []string // urutan file di zip, dipertahankan saat ditulis ulang
+	files map[string][]byte
+	docPr int // id wp:docPr terakhir, untuk gambar baru
+}
+
+const (
+	docxMain     = "word/document.xml"
+	docxTypes    = "[Content_Types].xml"
+	docxImageRel = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+)
+
+var (
+	reDocxText   = regexp.MustCompile(`<w:t(?:\s[^>]*)?>([^<]*)</w:t>`)
+	reDocxPara   = regexp.MustCompile(`<w:p[\s>]|</w:p>`)
+	reDocxPart   = regexp.MustCompile(`^word/(document|header\d*|footer\d*)\.xml$`)
+	reDocxRelID  = regexp.MustCompile(`Id="rId(\d+)"`)
+	reDocxDocPr  = regexp.MustCompile(`<wp:docPr\s[^>]*?id="(\d+)"`)
+	reDocxOpenTc = regexp.MustCompile(`<w:tc[\s>]`)
+)
+
+func openDocx(path string) (*docxDocument, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca template %s: %v", path, err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, fmt.Errorf("template %s bukan file .docx: %v", path, err)
+	}
+	d := &docxDocument{files: map[string][]byte{}}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("gagal membuka %s di %s: %v", f.Name, path, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("gagal membaca %s di %s: %v", f.Name, path, err)
+		}
+		d.names = append(d.names, f.Name)
+		d.files[f.Name] = data
+	}
+	if _, ok := d.files[docxMain]; !ok {
+		return nil, fmt.Errorf("template %s tidak punya %s", path, docxMain)
+	}
+	for _, part := range d.textParts() {
+		for _, m := range reDocxDocPr.FindAllStringSubmatch(string(d.files[part]), -1) {
+			if n, _ := strconv.Atoi(m[1]); n > d.docPr {
+				d.docPr = n
+			}
+		}
+	}
+	return d, nil
+}
+
+// textParts adalah isi dokumen, header, dan footer.
+func (d *docxDocument) textParts() []string {
+	var parts []string
+	for _, name := range d.names {
+		if reDocxPart.MatchString(name) {
+			parts = append(parts, name)
+		}
+	}
+	return parts
+}
+
+// replaceText mengganti setiap placeholder di body, header, dan footer.
+// Word sering memecah satu placeholder ke beberapa run (misalnya "<<NA" dan
+// "MA>>"), jadi pencarian dilakukan pada gabungan teks satu paragraf; hasilnya
+// ditulis ke run pertama dan sisa placeholder di run berikutnya dihapus.
+// Baris baru pada nilai menjadi <w:br/>.
+func (d *docxDocument) replaceText(replacements map[string]string) {
+	for _, name := range d.textParts() {
+		d.files[name] = []byte(replaceDocxText(string(d.files[name]), replacements))
+	}
+}
+
+type docxMatch struct {
+	start, end int
+	value      string
+}
+
+func replaceDocxText(doc string, replacements map[string]string) string {
+	keys := make([]string, 0, len(replacements))
+	for k := range replacements {
+		keys = append(keys, k)
+	}
+	// Placeholder terpanjang dulu supaya <<FOTO2>> tidak terbaca sebagai <<FOTO>>.
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+
+	nodes, groups := docxParagraphs(doc)
+	newText := map[int]string{}
+
+	for _, g := range groups {
+		start := g[0]
+		texts := docxTexts(doc, nodes[g[0]:g[1]])
+		full := strings.Join(texts, "")
+		var matches []docxMatch
+		for i := 0; i < len(full); {
+			matched := false
+			for _, k := range keys {
+				if k != "" && strings.HasPrefix(full[i:], k) {
+					matches = append(matches, docxMatch{i, i + len(k), replacements[k]})
+					i += len(k)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				i++
+			}
+		}
+		if len(matches) > 0 {
+			offset := 0
+			for i, t := range texts {
+				ns, ne := offset, offset+len(t)
+				var b strings.Builder
+				pos := ns
+				for _, m := range matches {
+					if m.end <= ns || m.start >= ne {
+						continue
+					}
+					if m.start > pos {
+						b.WriteString(full[pos:m.start])
+					}
+					if m.start >= ns {
+						b.WriteString(m.value)
+					}
+					if m.end > pos {
+						pos = min(m.end, ne)
+					}
+				}
+				if pos < ne {
+					b.WriteString(full[pos:ne])
+				}
+				if b.String() != t {
+					newText[start+i] = b.String()
+				}
+				offset = ne
+			}
+		}
+	}
+	if len(newText) == 0 {
+		return doc
+	}
+
+	var out strings.Builder
+	last := 0
+	for i, n := range nodes {
+		t, ok := newText[i]
+		if !ok {
+			continue
+		}
+		out.WriteString(doc[last:n[0]])
+		out.WriteString(docxTextRun(t))
+		last = n[1]
+	}
+	out.WriteString(doc[last:])
+	return out.String()
+}
+
+// docxParagraphs mengembalikan posisi setiap <w:t> di doc dan pengelompokannya
+// per paragraf sebagai rentang indeks [awal, akhir) pada nodes. Kelompok baru
+// dimulai jika ada tag pembuka atau penutup paragraf di antara dua <w:t>.
+func docxParagraphs(doc string) (nodes [][]int, groups [][2]int) {
+	nodes = reDocxText.FindAllStringSubmatchIndex(doc, -1)
+	edges := reDocxPara.FindAllStringIndex(doc, -1)
+	edge := 0
+	for start := 0; start < len(nodes); {
+		end := start + 1
+		for end < len(nodes) {
+			for edge < len(edges) && edges[edge][0] < nodes[end-1][1] {
+				edge++
+			}
+			if edge < len(edges) && edges[edge][0] < nodes[end][0] {
+				break
+			}
+			end++
+		}
+		groups = append(groups, [2]int{start, end})
+		start = end
+	}
+	return nodes, groups
+}
+
+func docxTexts(doc string, nodes [][]int) []string {
+	texts := make([]string, len(nodes))
+	for i, n := range nodes {
+		texts[i] = html.UnescapeString(doc[n[2]:n[3]])
+	}
+	return texts
+}
+
+// findText mengembalikan semua teks di body, header, dan footer yang cocok
+// dengan re, termasuk yang terpecah ke beberapa run, tanpa duplikat.
+func (d *docxDocument) findText(re *regexp.Regexp) []string {
+	var found []string
+	seen := map[string]bool{}
+	for _, name := range d.textParts() {
+		doc := string(d.files[name])
+		nodes, groups := docxParagraphs(doc)
+		for _, g := range groups {
+			for _, m := range re.FindAllString(strings.Join(docxTexts(doc, nodes[g[0]:g[1]]), ""), -1) {
+				if !seen[m] {
+					seen[m] = true
+					found = append(found, m)
+				}
+			}
+		}
+	}
+	return found
+}
+
+// docxTextRun menulis t sebagai <w:t>, dengan <w:br/> untuk setiap baris baru.
+func docxTextRun(t string) string {
+	lines := strings.Split(t, "\n")
+	for i, l := range lines {
+		lines[i] = docxEscape(l)
+	}
+	return `<w:t xml:space="preserve">` + strings.Join(lines, `</w:t><w:br/><w:t xml:space="preserve">`) + `</w:t>`
+}
+
+func docxEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// locate memastikan placeholder berada utuh di satu <w:t> pada part lalu
+// mengembalikan isi part dan posisi placeholder, atau -1 jika tidak ada.
+func (d *docxDocument) locate(part, placeholder string) (string, int) {
+	doc := replaceDocxText(string(d.files[part]), map[string]string{placeholder: placeholder})
+	return doc, strings.Index(doc, docxEscape(placeholder))
+}
+
+// replaceImage mengganti setiap placeholder di body, tabel, header, dan
+// footer dengan gambar inline berukuran widthPt x heightPt. Gambar harus PNG,
+// JPEG, atau GIF.
+func (d *docxDocument) replaceImage(placeholder string, img []byte, widthPt, heightPt float64) error {
+	var ext string
+	switch http.DetectContentType(img) {
+	case "image/png":
+		ext = "png"
+	case "image/jpeg":
+		ext = "jpeg"
+	case "image/gif":
+		ext = "gif"
+	default:
+		return fmt.Errorf("format gambar untuk %s tidak didukung (harus PNG, JPEG, atau GIF)", placeholder)
+	}
+	var media string
+	esc := docxEscape(placeholder)
+	for _, part := range d.textParts() {
+		doc, i := d.locate(part, placeholder)
+		if i < 0 {
+			continue
+		}
+		if media == "" {
+			media = d.addMedia(img, ext)
+		}
+		rid := d.addImageRel(part, media)
+		for i >= 0 {
+			d.docPr++
+			run := `</w:t></w:r><w:r>` + docxInlineImage(rid, d.docPr, widthPt, heightPt) + `</w:r><w:r><w:t xml:space="preserve">`
+			doc = doc[:i] + run + doc[i+len(esc):]
+			next := strings.Index(doc[i+len(run):], esc)
+			if next < 0 {
+				break
+			}
+			i += len(run) + next
+		}
+		d.files[part] = []byte(doc)
+	}
+	if media == "" {
+		return fmt.Errorf("%w: %s", ErrPlaceholderNotFound, placeholder)
+	}
+	return nil
+}
+
+// addMedia menyimpan gambar ke word/media dan mengembalikan namanya.
+func (d *docxDocument) addMedia(img []byte, ext string) string {
+	n := 1
+	for {
+		if _, ok := d.files[fmt.Sprintf("word/media/surat%d.%s", n, ext)]; !ok {
+			break
+		}
+		n++
+	}
+	name := fmt.Sprintf("word/media/surat%d.%s", n, ext)
+	d.put(name, img)
+
+	types := string(d.files[docxTypes])
+	if !strings.Contains(strings.ToLower(types), `extension="`+ext+`"`) {
+		def := fmt.Sprintf(`<Default Extension="%s" ContentType="image/%s"/>`, ext, ext)
+		d.put(docxTypes, []byte(strings.Replace(types, "</Types>", def+"</Types>", 1)))
+	}
+	return name
+}
+
+// addImageRel menambah relasi gambar media ke part dan mengembalikan id-nya.
+// Setiap part (document, header, footer) punya file relasi sendiri.
+func (d *docxDocument) addImageRel(part, media string) string {
+	relsName := path.Join(path.Dir(part), "_rels", path.Base(part)+".rels")
+	rels := string(d.files[relsName])
+	if rels == "" {
+		rels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"></Relationships>`
+	}
+	maxID := 0
+	for _, m := range reDocxRelID.FindAllStringSubmatch(rels, -1) {
+		if id, _ := strconv.Atoi(m[1]); id > maxID {
+			maxID = id
+		}
+	}
+	rid := fmt.Sprintf("rId%d", maxID+1)
+	rel := fmt.Sprintf(`<Relationship Id="%s" Type="%s" Target="%s"/>`, rid, docxImageRel, strings.TrimPrefix(media, "word/"))
+	d.put(relsName, []byte(strings.Replace(rels, "</Relationships>", rel+"</Relationships>", 1)))
+	return rid
+}
+
+func (d *docxDocument) put(name string, data []byte) {
+	if _, ok := d.files[name]; !ok {
+		d.names = append(d.names, name)
+	}
+	d.files[name] = data
+}
+
+// docxInlineImage adalah <w:drawing> untuk gambar inline. 1 pt = 12700 EMU.
+func docxInlineImage(rid string, id int, widthPt, heightPt float64) string {
+	cx, cy := int64(widthPt*12700), int64(heightPt*12700)
+	return fmt.Sprintf(`<w:drawing><wp:inline distT="0" distB="0" distL="0" distR="0" xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing">`+
+		`<wp:extent cx="%[3]d" cy="%[4]d"/><wp:docPr id="%[2]d" name="Gambar %[2]d"/>`+
+		`<a:graphic xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture">`+
+		`<pic:pic xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:nvPicPr><pic:cNvPr id="%[2]d" name="Gambar %[2]d"/><pic:cNvPicPr/></pic:nvPicPr>`+
+		`<pic:blipFill><a:blip r:embed="%[1]s" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill>`+
+		`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%[3]d" cy="%[4]d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr>`+
+		`</pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing>`, rid, id, cx, cy)
+}
+
+// replaceTable menghapus placeholder dari paragrafnya lalu menyisipkan tabel
+// berisi rows tepat setelah paragraf itu. Baris pertama dicetak tebal sebagai
+// header.
+func (d *docxDocument) replaceTable(placeholder string, rows [][]string) error {
+	doc, i := d.locate(docxMain, placeholder)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrPlaceholderNotFound, placeholder)
+	}
+	doc = doc[:i] + doc[i+len(docxEscape(placeholder)):]
+	end := strings.Index(doc[i:], "</w:p>")
+	if end < 0 {
+		return fmt.Errorf("paragraf untuk %s tidak lengkap", placeholder)
+	}
+	end += i + len("</w:p>")
+	table := docxTable(rows)
+	// Sel tabel harus diakhiri paragraf, termasuk jika tabel ini ada di dalam sel.
+	if len(reDocxOpenTc.FindAllStringIndex(doc[:end], -1)) > strings.Count(doc[:end], "</w:tc>") {
+		table += "<w:p/>"
+	}
+	d.files[docxMain] = []byte(doc[:end] + table + doc[end:])
+	return nil
+}
+
+func docxTable(rows [][]string) string {
+	cols := 0
+	for _, r := range rows {
+		cols = max(cols, len(r))
+	}
+	if cols == 0 {
+		return ""
+	}
+	// Lebar dalam twip: kolom pertama (nomor) sempit, sisanya dibagi rata.
+	const total, first = 8300, 600
+	widths := make([]int, cols)
+	widths[0] = first
+	for c := 1; c < cols; c++ {
+		widths[c] = (total - first) / max(cols-1, 1)
+	}
+	if cols == 1 {
+		widths[0] = total
+	}
+
+	var b strings.Builder
+	b.WriteString(`<w:tbl><w:tblPr><w:tblW w:w="0" w:type="auto"/><w:tblInd w:w="720" w:type="dxa"/><w:tblBorders>`)
+	for _, side := range []string{"top", "left", "bottom", "right", "insideH", "insideV"} {
+		fmt.Fprintf(&b, `<w:%s w:val="single" w:sz="4" w:space="0" w:color="000000"/>`, side)
+	}
+	b.WriteString(`</w:tblBorders></w:tblPr><w:tblGrid>`)
+	for _, w := range widths {
+		fmt.Fprintf(&b, `<w:gridCol w:w="%d"/>`, w)
+	}
+	b.WriteString(`</w:tblGrid>`)
+	for r, row := range rows {
+		b.WriteString(`<w:tr>`)
+		for c := 0; c < cols; c++ {
+			var text string
+			if c < len(row) {
+				text = row[c]
+			}
+			rPr := ""
+			if r == 0 {
+				rPr = `<w:rPr><w:b/></w:rPr>`
+			}
+			fmt.Fprintf(&b, `<w:tc><w:tcPr><w:tcW w:w="%d" w:type="dxa"/></w:tcPr><w:p><w:r>%s%s</w:r></w:p></w:tc>`, widths[c], rPr, docxTextRun(text))
+		}
+		b.WriteString(`</w:tr>`)
+	}
+	b.WriteString(`</w:tbl>`)
+	return b.String()
+}
+
+// write menulis ulang dokumen sebagai file .docx.
+func (d *docxDocument) write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for _, name := range d.names {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(d.files[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
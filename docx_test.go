@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// docxXML menyusun body dengan satu paragraf per elemen paras; setiap
+// paragraf berisi satu run per teks.
+func docxXML(paras ...[]string) string {
+	var b strings.Builder
+	b.WriteString(`<w:body>`)
+	for _, runs := range paras {
+		b.WriteString(`<w:p><w:pPr><w:jc w:val="left"/></w:pPr>`)
+		for _, r := range runs {
+			b.WriteString(`<w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">` + docxEscape(r) + `</w:t></w:r>`)
+		}
+		b.WriteString(`</w:p>`)
+	}
+	b.WriteString(`</w:body>`)
+	return b.String()
+}
+
+// docxParaTexts mengembalikan isi teks setiap paragraf doc.
+func docxParaTexts(doc string) []string {
+	nodes, groups := docxParagraphs(doc)
+	var out []string
+	for _, g := range groups {
+		out = append(out, strings.Join(docxTexts(doc, nodes[g[0]:g[1]]), ""))
+	}
+	return out
+}
+
+func TestReplaceDocxText(t *testing.T) {
+	repl := map[string]string{
+		"<<NAMA>>":  "Budi & Ani",
+		"<<NMR>>":   "0007",
+		"<<FOTO>>":  "foto",
+		"<<FOTO2>>": "foto kedua",
+		"<<KET>>":   "baris satu\nbaris dua",
+	}
+	tests := []struct {
+		name  string
+		paras [][]string
+		want  []string
+	}{
+		{"satu run", [][]string{{"Nama: <<NAMA>>"}}, []string{"Nama: Budi & Ani"}},
+		{"terpecah dua run", [][]string{{"<<NA", "MA>>"}}, []string{"Budi & Ani"}},
+		{"terpecah tiga run", [][]string{{"Nama: <", "<NA", "MA>", "> ok"}}, []string{"Nama: Budi & Ani ok"}},
+		{"dua placeholder", [][]string{{"<<NMR", ">>/<<NA", "MA>>"}}, []string{"0007/Budi & Ani"}},
+		{"terpanjang dulu", [][]string{{"<<FOTO2>> <<FO", "TO>>"}}, []string{"foto kedua foto"}},
+		{"tidak lintas paragraf", [][]string{{"<<NA"}, {"MA>>"}}, []string{"<<NA", "MA>>"}},
+		{"bukan placeholder", [][]string{{"<<NAMA", " >>"}}, []string{"<<NAMA >>"}},
+		{"paragraf lain tidak berubah", [][]string{{"Hal"}, {"<<N", "MR>>"}}, []string{"Hal", "0007"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := replaceDocxText(docxXML(tt.paras...), repl)
+			if texts := docxParaTexts(got); !reflect.DeepEqual(texts, tt.want) {
+				t.Errorf("teks = %q, want %q", texts, tt.want)
+			}
+			if n := strings.Count(got, "<w:r>"); n != strings.Count(docxXML(tt.paras...), "<w:r>") {
+				t.Errorf("jumlah run berubah menjadi %d", n)
+			}
+		})
+	}
+}
+
+func TestReplaceDocxTextRuns(t *testing.T) {
+	doc := docxXML([]string{"Nama: <<NA", "MA>>", " kelas"})
+	got := replaceDocxText(doc, map[string]string{"<<NAMA>>": "Budi & Ani"})
+	// Nilai ditulis ke run pertama yang memuat awal placeholder, sisa
+	// placeholder di run berikutnya dihapus, dan format run tetap.
+	nodes, _ := docxParagraphs(got)
+	if texts := docxTexts(got, nodes); !reflect.DeepEqual(texts, []string{"Nama: Budi & Ani", "", " kelas"}) {
+		t.Errorf("run = %q", texts)
+	}
+	if !strings.Contains(got, "Budi &amp; Ani") || strings.Count(got, "<w:b/>") != 3 {
+		t.Errorf("XML = %s", got)
+	}
+
+	if same := replaceDocxText(doc, map[string]string{"<<NMR>>": "1"}); same != doc {
+		t.Errorf("dokumen tanpa placeholder berubah: %s", same)
+	}
+}
+
+func TestReplaceDocxTextBarisBaru(t *testing.T) {
+	got := replaceDocxText(docxXML([]string{"<<K", "ET>>"}), map[string]string{"<<KET>>": "satu\ndua"})
+	if !strings.Contains(got, `satu</w:t><w:br/><w:t xml:space="preserve">dua`) {
+		t.Errorf("baris baru tidak menjadi <w:br/>: %s", got)
+	}
+}
+
+func TestRenderSuratPeminjamanDocx(t *testing.T) {
+	foto := filepath.Join(t.TempDir(), "foto.png")
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(foto, img.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	form := FormData{Nama: "Budi Santoso", Kelas: "XI TKJ 1", TanggalPinjam: "2026-05-11", TanggalKembali: "2026-05-12", FotoPath: foto}
+	form.setItems([]ItemPinjam{{"Kamera", 2}, {"Tripod", 1}})
+
+	out := filepath.Join(t.TempDir(), "surat.docx")
+	f, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = renderSuratDocx(f, suratPeminjaman, form, 7, time.Date(2026, 5, 10, 9, 0, 0, 0, time.Local))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := openDocx(out)
+	if err != nil {
+		t.Fatalf("hasil bukan .docx yang valid: %v", err)
+	}
+	body := string(doc.files[docxMain])
+	if !strings.Contains(body, "Budi Santoso") || strings.Contains(body, "&lt;&lt;NAMA&gt;&gt;") {
+		t.Errorf("nama peminjam tidak terisi")
+	}
+	if !strings.Contains(body, "<w:tbl><w:tblPr><w:tblW") || !strings.Contains(body, "Tripod") {
+		t.Errorf("tabel alat tidak dibuat")
+	}
+	if err := xml.Unmarshal(doc.files[docxMain], new(struct{})); err != nil {
+		t.Errorf("document.xml rusak: %v", err)
+	}
+}
+
+func TestDocxReplaceImage(t *testing.T) {
+	d := &docxDocument{
+		names: []string{docxTypes, docxMain, "word/header1.xml"},
+		files: map[string][]byte{
+			docxTypes:          []byte(`<Types></Types>`),
+			docxMain:           []byte(docxXML([]string{"Foto: <<FOTO:pem", "injaman>>"}, []string{"<<TTD:wali>>"})),
+			"word/header1.xml": []byte(docxXML([]string{"<<FOTO:peminjaman>>"})),
+		},
+	}
+	if found := d.findText(reImagePlaceholder); !reflect.DeepEqual(found, []string{"<<FOTO:peminjaman>>", "<<TTD:wali>>"}) {
+		t.Errorf("findText = %q", found)
+	}
+	if err := d.replaceImage("<<FOTO:peminjaman>>", testPNG(t, 4, 3), 40, 30); err != nil {
+		t.Fatal(err)
+	}
+	// Satu file gambar dipakai body dan header, masing-masing dengan relasinya sendiri.
+	if _, ok := d.files["word/media/surat1.png"]; !ok || len(d.names) != 6 {
+		t.Errorf("file = %v", d.names)
+	}
+	for _, part := range []string{docxMain, "word/header1.xml"} {
+		doc := string(d.files[part])
+		if strings.Contains(doc, "FOTO") || !strings.Contains(doc, `r:embed="rId1"`) {
+			t.Errorf("%s = %s", part, doc)
+		}
+	}
+	if rels := string(d.files["word/_rels/header1.xml.rels"]); !strings.Contains(rels, `Target="media/surat1.png"`) {
+		t.Errorf("relasi header = %s", rels)
+	}
+	if types := string(d.files[docxTypes]); !strings.Contains(types, `Extension="png"`) {
+		t.Errorf("content types = %s", types)
+	}
+	if err := d.replaceImage("<<TTD:kepsek>>", testPNG(t, 4, 3), 40, 30); !errors.Is(err, ErrPlaceholderNotFound) {
+		t.Errorf("placeholder tidak ada err = %v", err)
+	}
+	if err := d.replaceImage("<<TTD:wali>>", []byte("bukan gambar"), 40, 30); err == nil {
+		t.Error("gambar bukan PNG/JPEG/GIF diterima")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Mailer mengirim satu email teks biasa.
+type Mailer interface {
+	Send(to, subjek, body string) error
+}
+
+// mailer nil jika SMTP belum dikonfigurasi; notifikasi email lalu dilewati.
+var mailer Mailer
+
+// newMailerFromEnv membaca konfigurasi SMTP:
+//
+//	SMTP_HOST (wajib untuk mengaktifkan email), SMTP_PORT (default 587)
+//	SMTP_USER, SMTP_PASS (kosongkan untuk server tanpa login, mis. MailHog di localhost:1025)
+//	SMTP_FROM (default SMTP_USER)
+func newMailerFromEnv() Mailer {
+	host := getEnv("SMTP_HOST", "")
+	if host == "" {
+		return nil
+	}
+	m := &smtpMailer{
+		host: host,
+		port: getEnv("SMTP_PORT", "587"),
+		user: getEnv("SMTP_USER", ""),
+		pass: getEnv("SMTP_PASS", ""),
+	}
+	m.from = getEnv("SMTP_FROM", m.user)
+	if m.from == "" {
+		log.Println("⚠️ SMTP_FROM kosong, notifikasi email dimatikan")
+		return nil
+	}
+	return m
+}
+
+type smtpMailer struct {
+	host, port, user, pass, from string
+}
+
+func (m *smtpMailer) Send(to, subjek, body string) error {
+	var auth smtp.Auth
+	if m.user != "" {
+		auth = smtp.PlainAuth("", m.user, m.pass, m.host)
+	}
+	addr, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("alamat email %q tidak valid: %v", to, err)
+	}
+	msg, err := buildEmail(m.from, addr, subjek, body)
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(net.JoinHostPort(m.host, m.port), auth, m.from, []string{addr.Address}, msg); err != nil {
+		return fmt.Errorf("SMTP error: %v", err)
+	}
+	return nil
+}
+
+// buildEmail menyusun email text/plain UTF-8. Isi dikodekan quoted-printable
+// karena pesan memakai emoji yang sama dengan WA. Header To ditulis dari alamat
+// yang sudah diparse supaya isian penerima tidak bisa menyisipkan header lain.
+func buildEmail(from string, to *mail.Address, subjek, body string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to.String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subjek))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(plainText(body))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// parseEmail memeriksa isian email dari form dan mengembalikan alamatnya saja.
+// Isian kosong tetap kosong.
+func parseEmail(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", fmt.Errorf("Email %q tidak valid", s)
+	}
+	return addr.Address, nil
+}
+
+var (
+	waBold   = regexp.MustCompile(`\*([^*\n]+)\*`)
+	waItalic = regexp.MustCompile(`(^|[\s:])_([^_\n]+)_`)
+)
+
+// plainText membuang format *tebal* dan _miring_ WA supaya email tetap rapi.
+// Garis bawah di dalam link tidak disentuh.
+func plainText(pesan string) string {
+	pesan = waBold.ReplaceAllString(pesan, "$1")
+	return waItalic.ReplaceAllString(pesan, "$1$2")
+}
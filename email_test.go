@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer menerima satu email tanpa TLS dan login, cukup untuk
+// smtp.SendMail, lalu mengirim isi DATA ke channel.
+func fakeSMTPServer(t *testing.T) (host, port string, got <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	data := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 test ESMTP")
+		var env []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 test")
+			case strings.HasPrefix(cmd, "MAIL FROM:"), strings.HasPrefix(cmd, "RCPT TO:"):
+				env = append(env, strings.TrimSpace(line))
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 lanjut")
+				var b strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					b.WriteString(l)
+				}
+				reply("250 OK")
+				data <- strings.Join(env, "\n") + "\n\n" + b.String()
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 tidak dikenal")
+			}
+		}
+	}()
+	host, port, _ = net.SplitHostPort(ln.Addr().String())
+	return host, port, data
+}
+
+func TestSMTPMailer(t *testing.T) {
+	host, port, got := fakeSMTPServer(t)
+	t.Setenv("SMTP_HOST", host)
+	t.Setenv("SMTP_PORT", port)
+	t.Setenv("SMTP_USER", "")
+	t.Setenv("SMTP_FROM", "lab@sekolah.sch.id")
+	m := newMailerFromEnv()
+	if m == nil {
+		t.Fatal("mailer nil padahal SMTP_HOST dan SMTP_FROM diisi")
+	}
+	if err := m.Send("siswa@example.com", "Peminjaman ✅", "Halo *Budi*, alat _Kamera_ disetujui 🎉"); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-got
+	for _, want := range []string{
+		"MAIL FROM:<lab@sekolah.sch.id>",
+		"RCPT TO:<siswa@example.com>",
+		"To: <siswa@example.com>\r\n",
+		"Subject: =?UTF-8?q?Peminjaman_=E2=9C=85?=\r\n",
+		"Content-Transfer-Encoding: quoted-printable\r\n",
+		"Halo Budi, alat Kamera disetujui =F0=9F=8E=89",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("email tidak berisi %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestSMTPMailerAlamatTidakValid(t *testing.T) {
+	m := &smtpMailer{host: "127.0.0.1", port: "1", from: "lab@sekolah.sch.id"}
+	err := m.Send("siswa@example.com\r\nBcc: semua@example.com", "Peminjaman", "Halo")
+	if err == nil || !strings.Contains(err.Error(), "tidak valid") {
+		t.Errorf("err = %v, want alamat tidak valid", err)
+	}
+}
+
+func TestParseEmail(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{" siswa@example.com ", "siswa@example.com", false},
+		{"Budi <budi@example.com>", "budi@example.com", false},
+		{"", "", false},
+		{"bukan email", "", true},
+		{"siswa@example.com\r\nBcc: semua@example.com", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseEmail(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseEmail(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestNewMailerFromEnvNonaktif(t *testing.T) {
+	tests := []struct {
+		name       string
+		host, from string
+	}{
+		{"tanpa host", "", "lab@sekolah.sch.id"},
+		{"tanpa pengirim", "smtp.example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_HOST", tt.host)
+			t.Setenv("SMTP_USER", "")
+			t.Setenv("SMTP_FROM", tt.from)
+			if m := newMailerFromEnv(); m != nil {
+				t.Errorf("mailer = %+v, want nil", m)
+			}
+		})
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"*ID Pinjam* : _0007_", "ID Pinjam : 0007"},
+		{"link https://x.id/a_b_c tetap", "link https://x.id/a_b_c tetap"},
+	}
+	for _, tt := range tests {
+		if got := plainText(tt.in); got != tt.want {
+			t.Errorf("plainText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseKanal(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"", KanalWA, false},
+		{"WhatsApp", KanalWA, false},
+		{" E-mail ", KanalEmail, false},
+		{"Email, WA", "wa,email", false},
+		{"sms", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseKanal(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseKanal(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestKirimNotifikasi(t *testing.T) {
+	tests := []struct {
+		name      string
+		penerima  Penerima
+		mailer    Mailer
+		wantKanal []string
+		wantErr   bool
+	}{
+		{"wa saja", Penerima{NoWA: "0811", Email: "a@b.id"}, &smtpMailer{}, []string{KanalWA}, false},
+		{"email saja", Penerima{NoWA: "0811", Email: "a@b.id", Kanal: "email"}, &smtpMailer{}, []string{KanalEmail}, false},
+		{"keduanya", Penerima{NoWA: "0811", Email: "a@b.id", Kanal: "wa,email"}, &smtpMailer{}, []string{KanalWA, KanalEmail}, false},
+		{"email tanpa SMTP tetap WA", Penerima{NoWA: "0811", Email: "a@b.id", Kanal: "wa,email"}, nil, []string{KanalWA}, false},
+		{"email tanpa alamat", Penerima{NoWA: "0811", Kanal: "email"}, &smtpMailer{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFileOutbox(t.TempDir() + "/outbox.json")
+			useTestOutbox(t, repo, &fakeNotifier{name: "fake"})
+			oldMailer := mailer
+			mailer = tt.mailer
+			t.Cleanup(func() { mailer = oldMailer })
+
+			err := kirimNotifikasi(tt.penerima, "Subjek", "Pesan")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v", err)
+			}
+			msgs, _ := repo.ListMessages("")
+			if len(msgs) != len(tt.wantKanal) {
+				t.Fatalf("outbox = %+v, want kanal %v", msgs, tt.wantKanal)
+			}
+			for i, m := range msgs {
+				if m.Kanal != tt.wantKanal[i] {
+					t.Errorf("pesan %d kanal %s, want %s", i, m.Kanal, tt.wantKanal[i])
+				}
+				if m.Kanal == KanalEmail && (m.Tujuan != "a@b.id" || m.Subjek != "Subjek") {
+					t.Errorf("email = %+v", m)
+				}
+			}
+		})
+	}
+}
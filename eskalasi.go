@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Jenis riwayat pengingat untuk rantai persetujuan, diikuti nama tahap.
+// Permohonan mencatat kapan tahap mulai menunggu; eskalasi mencatat bahwa
+// tahap itu sudah dieskalasi sehingga tidak dikirim ulang.
+const (
+	jenisPermohonan = "Persetujuan:"
+	jenisEskalasi   = "Eskalasi:"
+)
+
+// eskalasiInterval adalah jarak pemeriksaan permohonan yang belum diputuskan.
+const eskalasiInterval = 15 * time.Minute
+
+// approvalEscalation mengatur eskalasi permohonan yang belum diputuskan.
+type approvalEscalation struct {
+	setelah time.Duration
+	ke      string // username penerima eskalasi jika tahap tidak mengisi Eskalasi
+}
+
+var approvalEskalasi *approvalEscalation
+
+// newApprovalEscalationFromEnv membaca:
+//
+//	APPROVAL_ESKALASI_SETELAH, lama tahap boleh menunggu (default 24h, 0 mematikan eskalasi)
+//	APPROVAL_ESKALASI_KE, username penerima eskalasi untuk tahap tanpa "eskalasi"
+//
+// Tanpa penerima eskalasi, permohonan dikirim ulang ke approver tahap itu.
+func newApprovalEscalationFromEnv() (*approvalEscalation, error) {
+	raw := getEnv("APPROVAL_ESKALASI_SETELAH", "24h")
+	setelah, err := time.ParseDuration(raw)
+	if raw == "0" {
+		setelah, err = 0, nil
+	}
+	if err != nil || setelah < 0 {
+		return nil, fmt.Errorf("APPROVAL_ESKALASI_SETELAH tidak valid: %q", raw)
+	}
+	return &approvalEscalation{setelah: setelah, ke: strings.TrimSpace(getEnv("APPROVAL_ESKALASI_KE", ""))}, nil
+}
+
+func (e *approvalEscalation) target(st ApprovalStep) string {
+	if st.Eskalasi != "" {
+		return st.Eskalasi
+	}
+	return e.ke
+}
+
+// escalatedTo mengembalikan penerima eskalasi tahap st pada peminjaman id dan
+// apakah tahap itu sudah dieskalasi.
+func escalatedTo(id int, st ApprovalStep) (string, bool, error) {
+	history, err := reminderRepo.ListReminders()
+	if err != nil {
+		return "", false, err
+	}
+	for _, r := range history {
+		if r.IDPinjam == id && r.Jenis == jenisEskalasi+st.Nama {
+			return approvalEskalasi.target(st), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// startApprovalEscalation memeriksa permohonan yang belum diputuskan saat
+// server menyala lalu setiap eskalasiInterval.
+func startApprovalEscalation() {
+	if approvalEskalasi.setelah == 0 {
+		log.Println("INFO: Eskalasi persetujuan dimatikan (APPROVAL_ESKALASI_SETELAH=0)")
+		return
+	}
+	go func() {
+		for {
+			runApprovalEscalation(time.Now())
+			time.Sleep(eskalasiInterval)
+		}
+	}()
+}
+
+// runApprovalEscalation mengeskalasi tahap yang sudah menunggu lebih lama dari
+// APPROVAL_ESKALASI_SETELAH. Setiap tahap hanya dieskalasi sekali. Tahap yang
+// belum punya catatan permohonan (diajukan sebelum fitur ini ada) mulai
+// dihitung sejak pemeriksaan pertama.
+func runApprovalEscalation(now time.Time) {
+	loans, err := loanRepo.ListLoans()
+	if err != nil {
+		log.Println("❌ Eskalasi: gagal membaca peminjaman:", err)
+		return
+	}
+	history, err := reminderRepo.ListReminders()
+	if err != nil {
+		log.Println("❌ Eskalasi: gagal membaca riwayat pengingat:", err)
+		return
+	}
+	snapshot, err := loadApprovalSnapshot()
+	if err != nil {
+		log.Println("❌ Eskalasi: gagal membaca rantai persetujuan:", err)
+		return
+	}
+	tercatat := map[string]string{}
+	for _, r := range history {
+		key := reminderKey(r.IDPinjam, r.Jenis)
+		if _, ok := tercatat[key]; !ok {
+			tercatat[key] = r.Tanggal
+		}
+	}
+
+	for i := range loans {
+		loan := &loans[i]
+		if loan.Status != StatusDiajukan {
+			continue
+		}
+		chain, index := snapshot.currentStep(loan)
+		st := chain[index]
+		if _, ok := tercatat[reminderKey(loan.ID, jenisEskalasi+st.Nama)]; ok {
+			continue
+		}
+		tanggal, ok := tercatat[reminderKey(loan.ID, jenisPermohonan+st.Nama)]
+		if !ok {
+			reminderRepo.RecordReminder(&Reminder{IDPinjam: loan.ID, Jenis: jenisPermohonan + st.Nama, Tanggal: now.Format("2006-01-02 15:04:05")})
+			continue
+		}
+		sejak, err := time.ParseInLocation("2006-01-02 15:04:05", tanggal, now.Location())
+		if err != nil || now.Sub(sejak) < approvalEskalasi.setelah {
+			continue
+		}
+		if err := escalateApproval(loan, chain, index, sejak, now); err != nil {
+			log.Printf("⚠️ Eskalasi peminjaman %s tahap %s gagal: %v", formatLoanID(loan.ID), st.Nama, err)
+		}
+	}
+}
+
+// escalateApproval mengirim permohonan tahap ke-index ke penerima eskalasi
+// (atau wakilnya), atau ke approver tahap itu jika tidak ada penerima
+// eskalasi, lalu mencatatnya.
+func escalateApproval(loan *Peminjaman, chain []ApprovalStep, index int, sejak, now time.Time) error {
+	st := chain[index]
+	var (
+		penerima            Penerima
+		identitas, mewakili string
+		err                 error
+	)
+	if target := approvalEskalasi.target(st); target != "" {
+		penerima, identitas, mewakili, err = usernamePenerima(target, now)
+	} else {
+		penerima, identitas, mewakili, err = stepPenerima(st, now)
+	}
+	if err != nil {
+		return err
+	}
+	data, err := approvalRequestData(loan, chain, index, penerima, identitas, now)
+	if err != nil {
+		return err
+	}
+	data.Mewakili = mewakili
+	data.Eskalasi = true
+	data.MenungguSejak = sejak.Format("02 January 2006 15:04")
+	if err := kirimPesan(penerima, PesanPinjamApprover, data); err != nil {
+		return err
+	}
+	log.Printf("INFO: Peminjaman %s tahap %s dieskalasi ke %s", formatLoanID(loan.ID), st.Nama, identitas)
+	if err := reminderRepo.RecordReminder(&Reminder{
+		IDPinjam: loan.ID,
+		Jenis:    jenisEskalasi + st.Nama,
+		Tanggal:  now.Format("2006-01-02 15:04:05"),
+		Penerima: penerimaTujuan(penerima),
+	}); err != nil {
+		log.Printf("⚠️ Gagal mencatat eskalasi peminjaman %s tahap %s: %v", formatLoanID(loan.ID), st.Nama, err)
+	}
+	return nil
+}
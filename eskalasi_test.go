@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunApprovalEscalation(t *testing.T) {
+	newTestStorage(t)
+	useTestPesanTemplates(t, filepath.Join("templates", "pesan"))
+	outbox := newFileOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+	useTestOutbox(t, outbox, &fakeNotifier{name: "fake"})
+	useTestChains(t, &ApprovalChains{Default: []ApprovalStep{{Nama: "Guru Lab", Approver: "guru1", Eskalasi: "wakasek"}}})
+	oldLinks, oldEskalasi := approvalLinks, approvalEskalasi
+	approvalLinks = &approvalSigner{secret: []byte("rahasia"), ttl: 72 * time.Hour, baseURL: "http://backend"}
+	approvalEskalasi = &approvalEscalation{setelah: 24 * time.Hour}
+	t.Cleanup(func() { approvalLinks, approvalEskalasi = oldLinks, oldEskalasi })
+	for _, u := range []User{
+		{Username: "guru1", Nama: "Pak Guru", Role: RoleApprover, NoWA: "62811", Aktif: true},
+		{Username: "wakasek", Nama: "Bu Wakasek", Role: RoleApprover, NoWA: "62822", Aktif: true},
+	} {
+		if err := userRepo.SaveUser(&u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loan := createTestLoan(t, StatusDiajukan, "Kamera", 1, "2026-05-11", "2026-05-12")
+	createTestLoan(t, StatusDisetujui, "Tripod", 1, "2026-05-11", "2026-05-12")
+	now := time.Date(2026, 5, 10, 9, 0, 0, 0, time.Local)
+
+	// Permohonan tanpa catatan mulai dihitung sejak pemeriksaan pertama.
+	runApprovalEscalation(now)
+	history, _ := reminderRepo.ListReminders()
+	if len(history) != 1 || history[0].Jenis != jenisPermohonan+"Guru Lab" || history[0].IDPinjam != loan.ID {
+		t.Fatalf("riwayat setelah pemeriksaan pertama = %+v", history)
+	}
+
+	runApprovalEscalation(now.Add(23 * time.Hour))
+	if msgs, _ := outbox.ListMessages(""); len(msgs) != 0 {
+		t.Errorf("eskalasi sebelum waktunya: %+v", msgs)
+	}
+
+	runApprovalEscalation(now.Add(25 * time.Hour))
+	runApprovalEscalation(now.Add(50 * time.Hour))
+	msgs, _ := outbox.ListMessages("")
+	if len(msgs) != 1 || msgs[0].Tujuan != "62822" || !strings.Contains(msgs[0].Pesan, "Kamera") {
+		t.Errorf("outbox = %+v, want satu eskalasi ke wakasek", msgs)
+	}
+	history, _ = reminderRepo.ListReminders()
+	if len(history) != 2 || history[1].Jenis != jenisEskalasi+"Guru Lab" || history[1].Penerima != "62822" {
+		t.Errorf("riwayat eskalasi = %+v", history)
+	}
+}
+
+// reminderGagal menggagalkan setiap RecordReminder.
+type reminderGagal struct{ ReminderRepository }
+
+func (reminderGagal) RecordReminder(*Reminder) error { return errors.New("sheet penuh") }
+
+func TestNotifyApprovalStepRiwayatGagal(t *testing.T) {
+	db := newTestStorage(t)
+	useTestPesanTemplates(t, filepath.Join("templates", "pesan"))
+	outbox := newFileOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+	useTestOutbox(t, outbox, &fakeNotifier{name: "fake"})
+	chain := []ApprovalStep{{Nama: "Guru Lab", Approver: "guru1"}}
+	useTestChains(t, &ApprovalChains{Default: chain})
+	oldLinks := approvalLinks
+	approvalLinks = &approvalSigner{secret: []byte("rahasia"), ttl: 72 * time.Hour, baseURL: "http://backend"}
+	t.Cleanup(func() { approvalLinks = oldLinks })
+	if err := userRepo.SaveUser(&User{Username: "guru1", Nama: "Pak Guru", Role: RoleApprover, NoWA: "62811", Aktif: true}); err != nil {
+		t.Fatal(err)
+	}
+	loan := createTestLoan(t, StatusDiajukan, "Kamera", 1, "2026-05-11", "2026-05-12")
+	reminderRepo = reminderGagal{db}
+
+	// Pesan sudah masuk antrean, jadi gagal mencatat riwayat bukan error.
+	if err := notifyApprovalStep(loan, chain, 0); err != nil {
+		t.Errorf("notifyApprovalStep = %v, want nil", err)
+	}
+	if msgs, _ := outbox.ListMessages(""); len(msgs) != 1 || msgs[0].Tujuan != "62811" {
+		t.Errorf("outbox = %+v, want satu permohonan ke guru1", msgs)
+	}
+}
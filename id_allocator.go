@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Nama urutan nomor yang dibagikan IDAllocator.
+const (
+	seqPeminjaman   = "peminjaman"
+	seqApproval     = "approval"
+	seqPengembalian = "pengembalian"
+)
+
+// IDAllocator membagikan nomor urut per jenis data. Nomor yang datanya sudah
+// tersimpan tidak pernah diberikan lagi, juga setelah server restart.
+type IDAllocator interface {
+	Next(seq string) (int, error)
+	// Release mengembalikan nomor dari Next yang datanya gagal disimpan, supaya
+	// nomor itu dibagikan lagi dan tidak terlewat.
+	Release(seq string, id int) error
+}
+
+// fileIDAllocator menyimpan nomor terakhir tiap urutan di file JSON. Saat
+// sebuah urutan belum ada di file, nilai awalnya diambil dari seed (misalnya ID
+// terbesar yang sudah ada di sheet) supaya data lama tidak tertimpa.
+type fileIDAllocator struct {
+	path string
+	seed func(seq string) (int, error)
+
+	mu       sync.Mutex
+	last     map[string]int
+	released map[string][]int // nomor yang dikembalikan lewat Release, urut naik
+	loaded   bool
+}
+
+// idAllocatorFile adalah isi file nomor urut. File lama hanya berisi peta
+// nomor terakhir per urutan.
+type idAllocatorFile struct {
+	Last     map[string]int   `json:"terakhir"`
+	Released map[string][]int `json:"dilepas,omitempty"`
+}
+
+func newFileIDAllocator(path string, seed func(seq string) (int, error)) *fileIDAllocator {
+	return &fileIDAllocator{path: path, seed: seed}
+}
+
+func (a *fileIDAllocator) Next(seq string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.loaded {
+		if err := a.load(); err != nil {
+			return 0, err
+		}
+	}
+	if free := a.released[seq]; len(free) > 0 {
+		a.released[seq] = free[1:]
+		if err := a.save(); err != nil {
+			a.released[seq] = free
+			return 0, err
+		}
+		return free[0], nil
+	}
+	last, ok := a.last[seq]
+	if !ok && a.seed != nil {
+		seeded, err := a.seed(seq)
+		if err != nil {
+			return 0, fmt.Errorf("gagal menentukan nomor awal %s: %v", seq, err)
+		}
+		last = seeded
+		log.Printf("INFO: Nomor urut %s dimulai dari %d", seq, last)
+	}
+
+	next := last + 1
+	a.last[seq] = next
+	if err := a.save(); err != nil {
+		// Nomor belum tersimpan, jadi boleh dibagikan ulang pada panggilan berikutnya.
+		if ok {
+			a.last[seq] = last
+		} else {
+			delete(a.last, seq)
+		}
+		return 0, err
+	}
+	return next, nil
+}
+
+// Release menyimpan id supaya diberikan lagi oleh Next berikutnya. Nomor
+// terakhir cukup dimundurkan; nomor lain diantrekan karena nomor sesudahnya
+// sudah dibagikan.
+func (a *fileIDAllocator) Release(seq string, id int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.loaded {
+		if err := a.load(); err != nil {
+			return err
+		}
+	}
+	last, free := a.last[seq], a.released[seq]
+	if id <= 0 || id > last || slices.Contains(free, id) {
+		return fmt.Errorf("nomor %s %d tidak sedang dibagikan", seq, id)
+	}
+	if id == last {
+		// Nomor dilepas di ujung urutan: mundurkan sampai melewati antrean.
+		n := last - 1
+		trimmed := free
+		for len(trimmed) > 0 && trimmed[len(trimmed)-1] == n {
+			trimmed = trimmed[:len(trimmed)-1]
+			n--
+		}
+		a.last[seq], a.released[seq] = n, trimmed
+	} else {
+		i, _ := slices.BinarySearch(free, id)
+		a.released[seq] = slices.Insert(slices.Clone(free), i, id)
+	}
+	if err := a.save(); err != nil {
+		a.last[seq], a.released[seq] = last, free
+		return err
+	}
+	return nil
+}
+
+func (a *fileIDAllocator) load() error {
+	a.last = map[string]int{}
+	a.released = map[string][]int{}
+	b, err := os.ReadFile(a.path)
+	if os.IsNotExist(err) {
+		a.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("gagal membaca %s: %v", a.path, err)
+	}
+	var f idAllocatorFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("file nomor urut %s rusak: %v", a.path, err)
+	}
+	if f.Last == nil {
+		if err := json.Unmarshal(b, &a.last); err != nil {
+			return fmt.Errorf("file nomor urut %s rusak: %v", a.path, err)
+		}
+	} else {
+		a.last = f.Last
+	}
+	if f.Released != nil {
+		a.released = f.Released
+	}
+	a.loaded = true
+	return nil
+}
+
+func (a *fileIDAllocator) save() error {
+	b, err := json.MarshalIndent(idAllocatorFile{Last: a.last, Released: a.released}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(a.path, b); err != nil {
+		return fmt.Errorf("gagal menyimpan nomor urut: %v", err)
+	}
+	return nil
+}
+
+// writeFileAtomic menulis ke file sementara lalu rename agar file lama tidak
+// pernah setengah tertulis jika proses mati di tengah jalan.
+func writeFileAtomic(path string, b []byte) error {
+	if dir := filepath.Dir(path); dir != "." {
+		os.MkdirAll(dir, 0700)
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
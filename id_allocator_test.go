@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileIDAllocator(t *testing.T) {
+	type step struct {
+		release int // 0 berarti Next
+		want    int // nomor dari Next, atau -1 jika Release harus gagal
+	}
+	tests := []struct {
+		name  string
+		seed  int
+		steps []step
+	}{
+		{"berurutan dari seed", 5, []step{{0, 6}, {0, 7}, {0, 8}}},
+		{"lepas nomor terakhir", 0, []step{{0, 1}, {0, 2}, {2, 0}, {0, 2}, {0, 3}}},
+		{"lepas nomor tengah", 0, []step{{0, 1}, {0, 2}, {0, 3}, {2, 0}, {0, 2}, {0, 4}}},
+		{"antrean urut naik", 0, []step{{0, 1}, {0, 2}, {0, 3}, {0, 4}, {3, 0}, {1, 0}, {0, 1}, {0, 3}, {0, 5}}},
+		{"lepas terakhir menggulung antrean", 0, []step{{0, 1}, {0, 2}, {0, 3}, {2, 0}, {3, 0}, {0, 2}, {0, 3}, {0, 4}}},
+		{"lepas dua kali", 0, []step{{0, 1}, {0, 2}, {1, 0}, {1, -1}}},
+		{"lepas nomor belum dibagikan", 0, []step{{0, 1}, {2, -1}, {0, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ids.json")
+			seed := func(string) (int, error) { return tt.seed, nil }
+			a := newFileIDAllocator(path, seed)
+			for i, s := range tt.steps {
+				if s.release != 0 {
+					err := a.Release(seqPeminjaman, s.release)
+					if (err != nil) != (s.want == -1) {
+						t.Fatalf("langkah %d: Release(%d) = %v", i, s.release, err)
+					}
+					continue
+				}
+				got, err := a.Next(seqPeminjaman)
+				if err != nil || got != s.want {
+					t.Fatalf("langkah %d: Next() = %d, %v, want %d", i, got, err, s.want)
+				}
+				// Allocator baru dari file yang sama harus melanjutkan urutan.
+				a = newFileIDAllocator(path, seed)
+			}
+		})
+	}
+}
+
+func TestFileIDAllocatorSeed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ids.json")
+	calls := 0
+	a := newFileIDAllocator(path, func(seq string) (int, error) {
+		calls++
+		if seq == seqApproval {
+			return 0, errors.New("sheet tidak terbaca")
+		}
+		return 41, nil
+	})
+	if _, err := a.Next(seqApproval); err == nil {
+		t.Error("Next(approval) tanpa seed harus gagal")
+	}
+	if got, _ := a.Next(seqPengembalian); got != 42 {
+		t.Errorf("Next(pengembalian) = %d, want 42", got)
+	}
+	if got, _ := a.Next(seqPengembalian); got != 43 || calls != 2 {
+		t.Errorf("Next(pengembalian) = %d setelah %d seed, want 43 setelah 2", got, calls)
+	}
+}
+
+func TestFileIDAllocatorFormatLama(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ids.json")
+	if err := os.WriteFile(path, []byte(`{"peminjaman": 12}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a := newFileIDAllocator(path, nil)
+	if got, err := a.Next(seqPeminjaman); err != nil || got != 13 {
+		t.Errorf("Next() = %d, %v, want 13", got, err)
+	}
+}
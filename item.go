@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// ItemPinjam adalah satu jenis alat dalam sebuah pengajuan.
+type ItemPinjam struct {
+	NamaAlat string `json:"namaAlat"`
+	Jumlah   int    `json:"jumlah"`
+}
+
+// items mengembalikan daftar alat peminjaman. Data lama yang dibuat sebelum ada
+// daftar item dibaca dari NamaAlat dan JumlahAlat.
+func (f FormData) items() []ItemPinjam {
+	if len(f.Items) > 0 {
+		return f.Items
+	}
+	if f.NamaAlat == "" {
+		return nil
+	}
+	return []ItemPinjam{{NamaAlat: f.NamaAlat, Jumlah: f.JumlahAlat}}
+}
+
+// setItems mengisi Items sekaligus ringkasan NamaAlat (nama dipisah koma) dan
+// JumlahAlat (total) yang tetap ditulis ke kolom G/H "Form Peminjam".
+func (f *FormData) setItems(items []ItemPinjam) {
+	f.Items = items
+	names := make([]string, len(items))
+	total := 0
+	for i, it := range items {
+		names[i] = it.NamaAlat
+		total += it.Jumlah
+	}
+	f.NamaAlat = strings.Join(names, ", ")
+	f.JumlahAlat = total
+}
+
+// alatWA mengisi baris "Nama Alat" pada pesan WA: nama alat jika hanya satu
+// item, atau daftar bernomor jika lebih.
+func (f FormData) alatWA() string {
+	items := f.items()
+	if len(items) <= 1 {
+		return f.NamaAlat
+	}
+	return itemsWA(items)
+}
+
+// itemsWA menulis daftar alat bernomor untuk pesan WA.
+func itemsWA(items []ItemPinjam) string {
+	if len(items) == 1 {
+		return fmt.Sprintf("%s (%d)", items[0].NamaAlat, items[0].Jumlah)
+	}
+	var b strings.Builder
+	for i, it := range items {
+		fmt.Fprintf(&b, "\n   %d. %s (%d)", i+1, it.NamaAlat, it.Jumlah)
+	}
+	return b.String()
+}
+
+// itemSummary meringkas daftar alat dalam satu baris, misalnya
+// "Kabel HDMI (3), Proyektor (1)". Daftar kosong ditulis "-".
+func itemSummary(items []ItemPinjam) string {
+	if len(items) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(items))
+	for i, it := range items {
+		parts[i] = fmt.Sprintf("%s (%d)", it.NamaAlat, it.Jumlah)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func totalJumlah(items []ItemPinjam) int {
+	total := 0
+	for _, it := range items {
+		total += it.Jumlah
+	}
+	return total
+}
+
+// jumlahOf mengembalikan jumlah alat bernama nama di items.
+func jumlahOf(items []ItemPinjam, nama string) int {
+	total := 0
+	for _, it := range items {
+		if strings.EqualFold(strings.TrimSpace(it.NamaAlat), strings.TrimSpace(nama)) {
+			total += it.Jumlah
+		}
+	}
+	return total
+}
+
+// addItems menjumlahkan dua daftar alat per nama, urutan mengikuti a lalu b.
+func addItems(a, b []ItemPinjam) []ItemPinjam {
+	var sum []ItemPinjam
+	for _, list := range [][]ItemPinjam{a, b} {
+		for _, it := range list {
+			found := false
+			for i := range sum {
+				if strings.EqualFold(sum[i].NamaAlat, it.NamaAlat) {
+					sum[i].Jumlah += it.Jumlah
+					found = true
+					break
+				}
+			}
+			if !found {
+				sum = append(sum, it)
+			}
+		}
+	}
+	return sum
+}
+
+// sisa adalah alat yang belum dikembalikan. Item yang sudah kembali semua tidak
+// ikut dalam daftar. Nama alat yang tercatat lebih dari sekali dijumlahkan dulu
+// karena jumlah yang kembali dihitung per nama.
+func (p Peminjaman) sisa() []ItemPinjam {
+	var out []ItemPinjam
+	for _, it := range addItems(nil, p.Form.items()) {
+		if n := it.Jumlah - jumlahOf(p.Kembali, it.NamaAlat); n > 0 {
+			out = append(out, ItemPinjam{NamaAlat: it.NamaAlat, Jumlah: n})
+		}
+	}
+	return out
+}
+
+// parseItems membaca daftar alat dari form /pinjam. Frontend boleh mengirim
+// field "items" berisi JSON [{"namaAlat":"Kamera","jumlah":1}, ...], atau
+// mengulang field namaAlat/jumlahAlat untuk setiap item. Nama alat yang sama
+// digabung menjadi satu item.
+func parseItems(r *http.Request) ([]ItemPinjam, error) {
+	var items []ItemPinjam
+	if raw := r.FormValue("items"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &items); err != nil {
+			return nil, fmt.Errorf("daftar alat tidak valid: %v", err)
+		}
+	} else {
+		names := r.Form["namaAlat"]
+		counts := r.Form["jumlahAlat"]
+		for i, name := range names {
+			jumlah := 0
+			if i < len(counts) {
+				jumlah, _ = strconv.Atoi(strings.TrimSpace(counts[i]))
+			}
+			items = append(items, ItemPinjam{NamaAlat: name, Jumlah: jumlah})
+		}
+	}
+
+	var cleaned []ItemPinjam
+	for _, it := range items {
+		it.NamaAlat = strings.TrimSpace(it.NamaAlat)
+		if it.NamaAlat == "" {
+			continue
+		}
+		if it.Jumlah <= 0 {
+			return nil, fmt.Errorf("jumlah %s harus lebih dari 0", it.NamaAlat)
+		}
+		cleaned = append(cleaned, it)
+	}
+	if len(cleaned) == 0 {
+		return nil, fmt.Errorf("minimal satu alat harus diisi")
+	}
+	return addItems(nil, cleaned), nil
+}
+
+// parseReturnItems membaca alat yang dikembalikan dari form /pengembalian dengan
+// format yang sama seperti parseItems. Jika tidak ada item yang dikirim, nil
+// berarti semua sisa alat dikembalikan.
+func parseReturnItems(r *http.Request) ([]ItemPinjam, error) {
+	if r.FormValue("items") == "" && len(r.Form["namaAlat"]) == 0 {
+		return nil, nil
+	}
+	return parseItems(r)
+}
+
+// itemTableRows adalah isi tabel alat pada surat: header lalu satu baris per item.
+func itemTableRows(items []ItemPinjam) [][]string {
+	rows := [][]string{{"No", "Nama Alat", "Jumlah"}}
+	for i, it := range items {
+		rows = append(rows, []string{strconv.Itoa(i + 1), it.NamaAlat, strconv.Itoa(it.Jumlah)})
+	}
+	return rows
+}
+
+// findTextIndex mencari posisi awal text di dokumen, termasuk di dalam tabel.
+// Mengembalikan -1 jika tidak ditemukan.
+func findTextIndex(content []*docs.StructuralElement, text string) int64 {
+	for _, c := range content {
+		if c.Paragraph != nil {
+			for _, e := range c.Paragraph.Elements {
+				if e.TextRun == nil {
+					continue
+				}
+				if i := strings.Index(e.TextRun.Content, text); i >= 0 {
+					return e.StartIndex + utf16Len(e.TextRun.Content[:i])
+				}
+			}
+		}
+		if c.Table != nil {
+			for _, row := range c.Table.TableRows {
+				for _, tc := range row.TableCells {
+					if i := findTextIndex(tc.Content, text); i >= 0 {
+						return i
+					}
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// utf16Len menghitung panjang teks dalam satuan indeks Google Docs (UTF-16).
+func utf16Len(s string) int64 {
+	return int64(len(utf16.Encode([]rune(s))))
+}
+
+// findTableAfter mengembalikan tabel pertama yang dimulai pada atau setelah index.
+func findTableAfter(content []*docs.StructuralElement, index int64) *docs.Table {
+	for _, c := range content {
+		if c.Table == nil {
+			continue
+		}
+		if c.StartIndex >= index {
+			return c.Table
+		}
+		for _, row := range c.Table.TableRows {
+			for _, tc := range row.TableCells {
+				if t := findTableAfter(tc.Content, index); t != nil {
+					return t
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// insertTable mengganti placeholder dengan tabel berisi rows. Dokumen harus
+// sudah tidak berisi placeholder lain yang akan diganti dengan ReplaceAllText,
+// karena indeks berubah setelah tabel disisipkan.
+func insertTable(docsService *docs.Service, docID, placeholder string, rows [][]string) error {
+	doc, err := docsService.Documents.Get(docID).Do()
+	if err != nil {
+		return fmt.Errorf("gagal membaca dokumen: %v", err)
+	}
+	index := findTextIndex(doc.Body.Content, placeholder)
+	if index < 0 {
+		return fmt.Errorf("placeholder %s tidak ditemukan", placeholder)
+	}
+
+	_, err = docsService.Documents.BatchUpdate(docID, &docs.BatchUpdateDocumentRequest{Requests: []*docs.Request{
+		{DeleteContentRange: &docs.DeleteContentRangeRequest{
+			Range: &docs.Range{StartIndex: index, EndIndex: index + utf16Len(placeholder)},
+		}},
+		{InsertTable: &docs.InsertTableRequest{
+			Location: &docs.Location{Index: index},
+			Rows:     int64(len(rows)),
+			Columns:  int64(len(rows[0])),
+		}},
+	}}).Do()
+	if err != nil {
+		return fmt.Errorf("gagal menyisipkan tabel: %v", err)
+	}
+
+	doc, err = docsService.Documents.Get(docID).Do()
+	if err != nil {
+		return fmt.Errorf("gagal membaca dokumen: %v", err)
+	}
+	table := findTableAfter(doc.Body.Content, index)
+	if table == nil {
+		return fmt.Errorf("tabel untuk %s tidak ditemukan setelah disisipkan", placeholder)
+	}
+
+	// Isi dari sel terakhir supaya indeks sel sebelumnya tidak bergeser.
+	var reqs []*docs.Request
+	for r := len(table.TableRows) - 1; r >= 0; r-- {
+		cells := table.TableRows[r].TableCells
+		for c := len(cells) - 1; c >= 0; c-- {
+			if r >= len(rows) || c >= len(rows[r]) || rows[r][c] == "" || len(cells[c].Content) == 0 {
+				continue
+			}
+			reqs = append(reqs, &docs.Request{InsertText: &docs.InsertTextRequest{
+				Location: &docs.Location{Index: cells[c].Content[0].StartIndex},
+				Text:     rows[r][c],
+			}})
+		}
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+	_, err = docsService.Documents.BatchUpdate(docID, &docs.BatchUpdateDocumentRequest{Requests: reqs}).Do()
+	if err != nil {
+		return fmt.Errorf("gagal mengisi tabel: %v", err)
+	}
+	return nil
+}
+
+// replaceItemPlaceholders menyiapkan <<NMALT>> dan <<JML>> untuk ReplaceAllText.
+// Untuk lebih dari satu item <<NMALT>> dibiarkan agar nanti diganti tabel
+// (LetterDefinition.tableRows), dan <<JML>> berisi total.
+func replaceItemPlaceholders(replacements map[string]string, form FormData) {
+	items := form.items()
+	replacements["<<JML>>"] = strconv.Itoa(form.JumlahAlat)
+	if len(items) > 1 {
+		delete(replacements, "<<NMALT>>")
+		replacements["<<JML>>"] = fmt.Sprintf("%d (total)", form.JumlahAlat)
+		return
+	}
+	replacements["<<NMALT>>"] = form.NamaAlat
+}
+
+// returnTableRows adalah isi tabel pada surat pengembalian: jumlah dipinjam,
+// dikembalikan kali ini, dan sisa untuk setiap alat.
+func returnTableRows(form FormData) [][]string {
+	rows := [][]string{{"No", "Nama Alat", "Dipinjam", "Dikembalikan", "Sisa"}}
+	for i, it := range form.items() {
+		rows = append(rows, []string{
+			strconv.Itoa(i + 1),
+			it.NamaAlat,
+			strconv.Itoa(it.Jumlah),
+			strconv.Itoa(jumlahOf(form.ItemKembali, it.NamaAlat)),
+			strconv.Itoa(jumlahOf(form.ItemSisa, it.NamaAlat)),
+		})
+	}
+	return rows
+}
+
+// replaceReturnPlaceholders mengisi <<KMB>> (alat yang dikembalikan kali ini)
+// dan <<SISA>> (alat yang belum kembali). Jika pengembalian hanya sebagian
+// atau alatnya lebih dari satu, <<NMALT>> dibiarkan untuk tabel pengembalian.
+func replaceReturnPlaceholders(replacements map[string]string, form FormData) {
+	replaceItemPlaceholders(replacements, form)
+	replacements["<<KMB>>"] = itemSummary(form.ItemKembali)
+	replacements["<<SISA>>"] = itemSummary(form.ItemSisa)
+	if len(form.ItemSisa) > 0 {
+		delete(replacements, "<<NMALT>>")
+	}
+}
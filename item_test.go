@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSisa(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    FormData
+		kembali []ItemPinjam
+		want    []ItemPinjam
+	}{
+		{
+			name: "belum ada pengembalian",
+			form: FormData{Items: []ItemPinjam{{"Kamera", 2}, {"Tripod", 1}}},
+			want: []ItemPinjam{{"Kamera", 2}, {"Tripod", 1}},
+		},
+		{
+			name:    "sebagian",
+			form:    FormData{Items: []ItemPinjam{{"Kamera", 2}, {"Tripod", 1}}},
+			kembali: []ItemPinjam{{"kamera", 1}},
+			want:    []ItemPinjam{{"Kamera", 1}, {"Tripod", 1}},
+		},
+		{
+			name:    "satu alat kembali semua",
+			form:    FormData{Items: []ItemPinjam{{"Kamera", 2}, {"Tripod", 1}}},
+			kembali: []ItemPinjam{{"Tripod", 1}, {"Kamera", 1}},
+			want:    []ItemPinjam{{"Kamera", 1}},
+		},
+		{
+			name:    "semua kembali",
+			form:    FormData{Items: []ItemPinjam{{"Kamera", 2}}},
+			kembali: []ItemPinjam{{"Kamera", 2}},
+			want:    nil,
+		},
+		{
+			name:    "kembali berlebih tidak negatif",
+			form:    FormData{Items: []ItemPinjam{{"Kamera", 1}}},
+			kembali: []ItemPinjam{{"Kamera", 3}},
+			want:    nil,
+		},
+		{
+			name:    "data lama tanpa Items",
+			form:    FormData{NamaAlat: "Proyektor", JumlahAlat: 3},
+			kembali: []ItemPinjam{{"Proyektor", 1}},
+			want:    []ItemPinjam{{"Proyektor", 2}},
+		},
+		{
+			name:    "nama alat ganda",
+			form:    FormData{Items: []ItemPinjam{{"Kamera", 1}, {"Kamera", 1}}},
+			kembali: []ItemPinjam{{"Kamera", 1}},
+			want:    []ItemPinjam{{"Kamera", 1}},
+		},
+		{
+			name: "tanpa alat",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Peminjaman{Form: tt.form, Kembali: tt.kembali}
+			if got := p.sisa(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sisa() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetItems(t *testing.T) {
+	var f FormData
+	f.setItems([]ItemPinjam{{"Kamera", 2}, {"Tripod", 1}})
+	if f.NamaAlat != "Kamera, Tripod" || f.JumlahAlat != 3 {
+		t.Errorf("ringkasan = %q, %d", f.NamaAlat, f.JumlahAlat)
+	}
+	if got := f.items(); len(got) != 2 {
+		t.Errorf("items() = %v", got)
+	}
+	lama := FormData{NamaAlat: "Proyektor", JumlahAlat: 3}
+	if got := lama.items(); !reflect.DeepEqual(got, []ItemPinjam{{"Proyektor", 3}}) {
+		t.Errorf("items() data lama = %v", got)
+	}
+}
+
+func TestParseItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    url.Values
+		want    []ItemPinjam
+		wantErr string
+	}{
+		{
+			name: "json",
+			form: url.Values{"items": {`[{"namaAlat":" Kamera ","jumlah":2},{"namaAlat":"Tripod","jumlah":1}]`}},
+			want: []ItemPinjam{{"Kamera", 2}, {"Tripod", 1}},
+		},
+		{
+			name: "field berulang",
+			form: url.Values{"namaAlat": {"Kamera", "Tripod"}, "jumlahAlat": {"2", " 1 "}},
+			want: []ItemPinjam{{"Kamera", 2}, {"Tripod", 1}},
+		},
+		{
+			name: "baris kosong dilewati",
+			form: url.Values{"namaAlat": {"Kamera", " "}, "jumlahAlat": {"1", ""}},
+			want: []ItemPinjam{{"Kamera", 1}},
+		},
+		{
+			name: "nama sama digabung",
+			form: url.Values{"items": {`[{"namaAlat":"Kamera","jumlah":1},{"namaAlat":"Tripod","jumlah":1},{"namaAlat":"kamera ","jumlah":1}]`}},
+			want: []ItemPinjam{{"Kamera", 2}, {"Tripod", 1}},
+		},
+		{"jumlah nol", url.Values{"namaAlat": {"Kamera"}, "jumlahAlat": {"0"}}, nil, "harus lebih dari 0"},
+		{"jumlah tidak ada", url.Values{"namaAlat": {"Kamera", "Tripod"}, "jumlahAlat": {"1"}}, nil, "Tripod harus lebih dari 0"},
+		{"json rusak", url.Values{"items": {`[{"namaAlat":`}}, nil, "daftar alat tidak valid"},
+		{"tanpa alat", url.Values{}, nil, "minimal satu alat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/pinjam", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.ParseForm()
+			got, err := parseItems(r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want berisi %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseItems = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceItemPlaceholders(t *testing.T) {
+	var satu, banyak FormData
+	satu.setItems([]ItemPinjam{{"Kamera", 2}})
+	banyak.setItems([]ItemPinjam{{"Kamera", 2}, {"Tripod", 1}})
+
+	r := map[string]string{"<<NMALT>>": ""}
+	replaceItemPlaceholders(r, satu)
+	if r["<<NMALT>>"] != "Kamera" || r["<<JML>>"] != "2" {
+		t.Errorf("satu item = %v", r)
+	}
+	r = map[string]string{"<<NMALT>>": ""}
+	replaceItemPlaceholders(r, banyak)
+	if _, ok := r["<<NMALT>>"]; ok || r["<<JML>>"] != "3 (total)" {
+		t.Errorf("banyak item = %v, want <<NMALT>> untuk tabel", r)
+	}
+	if rows := itemTableRows(banyak.Items); len(rows) != 3 || rows[2][1] != "Tripod" {
+		t.Errorf("itemTableRows = %v", rows)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound dikembalikan repository jika ID job tidak ada.
+var ErrJobNotFound = errors.New("job tidak ditemukan")
+
+// JobStatus adalah tahap pemrosesan pengajuan yang berjalan di belakang.
+type JobStatus string
+
+const (
+	JobAntri        JobStatus = "antri"
+	JobUploadFoto   JobStatus = "upload_foto"
+	JobMembuatSurat JobStatus = "membuat_surat"
+	JobMenulisSheet JobStatus = "menulis_sheet"
+	JobNotifikasi   JobStatus = "notifikasi"
+	JobSelesai      JobStatus = "selesai"
+	JobGagal        JobStatus = "gagal"
+)
+
+// Jenis job.
+const (
+	JobPinjam       = "pinjam"
+	JobPengembalian = "pengembalian"
+)
+
+// Job adalah status satu pengajuan pinjam atau pengembalian yang diproses di
+// belakang, supaya frontend bisa menampilkan progres dan error lewat GET
+// /jobs/{id}. Error berisi alasan yang aman ditampilkan ke siswa; detailnya
+// hanya ada di log. Peringatan berisi langkah yang gagal tanpa menggagalkan
+// job, misalnya foto tidak terupload.
+type Job struct {
+	ID         string    `json:"id"`
+	Jenis      string    `json:"jenis"`
+	Status     JobStatus `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Peringatan []string  `json:"peringatan,omitempty"`
+	IDPinjam   int       `json:"idPinjam,omitempty"`
+	DokumenURL string    `json:"dokumenUrl,omitempty"`
+	Dibuat     time.Time `json:"dibuat"`
+	Diperbarui time.Time `json:"diperbarui"`
+}
+
+func (j *Job) selesai() bool {
+	return j.Status == JobSelesai || j.Status == JobGagal
+}
+
+// JobRepository menyimpan status job supaya tetap bisa dibaca setelah server restart.
+type JobRepository interface {
+	// SaveJob menambah atau memperbarui job berdasarkan ID.
+	SaveJob(j *Job) error
+	FindJob(id string) (*Job, error)
+	// UnfinishedJobs mengembalikan job yang belum selesai atau gagal.
+	UnfinishedJobs() ([]Job, error)
+}
+
+var jobRepo JobRepository
+
+// newJobRepoFromEnv memakai database SQLite jika backend penyimpanan sqlite,
+// selain itu file JOBS_PATH (default data/jobs.json).
+func newJobRepoFromEnv(storage Storage) JobRepository {
+	switch s := storage.(type) {
+	case *sqliteLoanRepository:
+		return s
+	case *mirrorLoanRepository:
+		if db, ok := s.primary.(*sqliteLoanRepository); ok {
+			return db
+		}
+	}
+	return newFileJobRepository(getEnv("JOBS_PATH", filepath.Join("data", "jobs.json")))
+}
+
+// newJob membuat job antri dengan ID acak. ID juga menjadi kunci akses GET
+// /jobs/{id}, jadi tidak boleh bisa ditebak.
+func newJob(jenis string) (*Job, error) {
+	raw := make([]byte, 12)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	j := &Job{ID: hex.EncodeToString(raw), Jenis: jenis, Status: JobAntri, Dibuat: now, Diperbarui: now}
+	if err := jobRepo.SaveJob(j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Job) save() {
+	j.Diperbarui = time.Now()
+	if err := jobRepo.SaveJob(j); err != nil {
+		log.Printf("⚠️ Gagal menyimpan status job %s: %v", j.ID, err)
+	}
+}
+
+// tahap memindahkan job ke status berikutnya.
+func (j *Job) tahap(s JobStatus) {
+	j.Status = s
+	j.save()
+}
+
+// peringatkan mencatat langkah yang gagal tanpa menghentikan job.
+func (j *Job) peringatkan(pesan string) {
+	j.Peringatan = append(j.Peringatan, pesan)
+	j.save()
+}
+
+// gagal menghentikan job dengan alasan untuk siswa; err hanya ditulis ke log.
+func (j *Job) gagal(alasan string, err error) {
+	log.Printf("❌ Job %s %s gagal: %s: %v", j.Jenis, j.ID, alasan, err)
+	j.Status = JobGagal
+	j.Error = alasan
+	j.save()
+}
+
+func (j *Job) beres() {
+	j.Status = JobSelesai
+	j.save()
+}
+
+// writeJobAccepted membalas pengajuan dengan 202 beserta ID job di header
+// X-Job-ID dan Location, dan di akhir pesan.
+func writeJobAccepted(w http.ResponseWriter, j *Job, pesan string) {
+	w.Header().Set("Access-Control-Expose-Headers", "X-Job-ID, Location")
+	w.Header().Set("X-Job-ID", j.ID)
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "%s (ID proses: %s)", pesan, j.ID)
+}
+
+// failInterruptedJobs menandai gagal job yang masih berjalan saat server
+// berhenti, karena goroutine-nya tidak akan dilanjutkan.
+func failInterruptedJobs() {
+	list, err := jobRepo.UnfinishedJobs()
+	if err != nil {
+		log.Println("⚠️ Gagal membaca job yang belum selesai:", err)
+		return
+	}
+	for i := range list {
+		j := &list[i]
+		j.Status = JobGagal
+		j.Error = "Server dimulai ulang saat pengajuan diproses, silakan hubungi admin lab"
+		j.save()
+	}
+	if len(list) > 0 {
+		log.Printf("⚠️ %d job terhenti karena server dimulai ulang", len(list))
+	}
+}
+
+// handleJob mengembalikan status satu job: GET /jobs/{id}.
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	j, err := jobRepo.FindJob(r.PathValue("id"))
+	if errors.Is(err, ErrJobNotFound) {
+		http.Error(w, "Job tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Find job error:", err)
+		http.Error(w, "Gagal membaca status job", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(j)
+}
+
+// fileJobRepository menyimpan job di satu file JSON untuk backend sheets. Job
+// yang sudah selesai lebih dari 7 hari dibuang saat file dibaca.
+type fileJobRepository struct {
+	path string
+
+	mu     sync.Mutex
+	jobs   []Job
+	loaded bool
+}
+
+func newFileJobRepository(path string) *fileJobRepository {
+	return &fileJobRepository{path: path}
+}
+
+func (f *fileJobRepository) load() error {
+	if f.loaded {
+		return nil
+	}
+	b, err := os.ReadFile(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("gagal membaca %s: %v", f.path, err)
+	}
+	var jobs []Job
+	if err == nil {
+		if err := json.Unmarshal(b, &jobs); err != nil {
+			return fmt.Errorf("file job %s rusak: %v", f.path, err)
+		}
+	}
+	cutoff := time.Now().AddDate(0, 0, -7)
+	for _, j := range jobs {
+		if j.selesai() && j.Diperbarui.Before(cutoff) {
+			continue
+		}
+		f.jobs = append(f.jobs, j)
+	}
+	f.loaded = true
+	return nil
+}
+
+func (f *fileJobRepository) save() error {
+	b, err := json.MarshalIndent(f.jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(f.path, b); err != nil {
+		return fmt.Errorf("gagal menyimpan job: %v", err)
+	}
+	return nil
+}
+
+func (f *fileJobRepository) SaveJob(j *Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(); err != nil {
+		return err
+	}
+	old := append([]Job(nil), f.jobs...)
+	saved := *j
+	saved.Peringatan = append([]string(nil), j.Peringatan...)
+	found := false
+	for i := range f.jobs {
+		if f.jobs[i].ID == j.ID {
+			f.jobs[i] = saved
+			found = true
+		}
+	}
+	if !found {
+		f.jobs = append(f.jobs, saved)
+	}
+	if err := f.save(); err != nil {
+		f.jobs = old
+		return err
+	}
+	return nil
+}
+
+func (f *fileJobRepository) FindJob(id string) (*Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	for _, j := range f.jobs {
+		if j.ID == id {
+			return &j, nil
+		}
+	}
+	return nil, ErrJobNotFound
+}
+
+func (f *fileJobRepository) UnfinishedJobs() ([]Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	var list []Job
+	for _, j := range f.jobs {
+		if !j.selesai() {
+			list = append(list, j)
+		}
+	}
+	return list, nil
+}
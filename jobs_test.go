@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestJobs memakai repo sebagai jobRepo selama test.
+func useTestJobs(t *testing.T, repo JobRepository) {
+	t.Helper()
+	old := jobRepo
+	jobRepo = repo
+	t.Cleanup(func() { jobRepo = old })
+}
+
+// jobImpls menjalankan test yang sama untuk penyimpanan job file dan SQLite.
+func jobImpls(t *testing.T) map[string]JobRepository {
+	return map[string]JobRepository{
+		"file":   newFileJobRepository(filepath.Join(t.TempDir(), "jobs.json")),
+		"sqlite": openTestSQLite(t, filepath.Join(t.TempDir(), "peminjaman.db")),
+	}
+}
+
+func TestJobTahap(t *testing.T) {
+	for name, repo := range jobImpls(t) {
+		t.Run(name, func(t *testing.T) {
+			useTestJobs(t, repo)
+			berhasil, err := newJob(JobPinjam)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gagal, _ := newJob(JobPengembalian)
+			berjalan, _ := newJob(JobPinjam)
+			if berhasil.ID == gagal.ID || len(berhasil.ID) != 24 || berhasil.Status != JobAntri {
+				t.Fatalf("job baru = %+v, %+v", berhasil, gagal)
+			}
+
+			berhasil.tahap(JobUploadFoto)
+			berhasil.peringatkan("Foto gagal diupload")
+			berhasil.tahap(JobMembuatSurat)
+			berhasil.IDPinjam = 7
+			berhasil.DokumenURL = "https://drive/surat"
+			berhasil.beres()
+			gagal.tahap(JobMenulisSheet)
+			gagal.gagal("Data gagal disimpan", errors.New("quota"))
+			berjalan.tahap(JobNotifikasi)
+
+			got, err := repo.FindJob(berhasil.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != JobSelesai || got.IDPinjam != 7 || got.DokumenURL != "https://drive/surat" ||
+				len(got.Peringatan) != 1 || got.Peringatan[0] != "Foto gagal diupload" || got.Diperbarui.Before(got.Dibuat) {
+				t.Errorf("job selesai = %+v", got)
+			}
+			if got, _ := repo.FindJob(gagal.ID); got.Status != JobGagal || got.Error != "Data gagal disimpan" || got.Jenis != JobPengembalian {
+				t.Errorf("job gagal = %+v", got)
+			}
+			if _, err := repo.FindJob("tidak-ada"); !errors.Is(err, ErrJobNotFound) {
+				t.Errorf("FindJob(tidak-ada) err = %v, want ErrJobNotFound", err)
+			}
+			unfinished, err := repo.UnfinishedJobs()
+			if err != nil || len(unfinished) != 1 || unfinished[0].ID != berjalan.ID || unfinished[0].Status != JobNotifikasi {
+				t.Errorf("UnfinishedJobs = %+v, %v", unfinished, err)
+			}
+
+			// Job yang masih berjalan saat server berhenti ditandai gagal.
+			failInterruptedJobs()
+			if got, _ := repo.FindJob(berjalan.ID); got.Status != JobGagal || got.Error == "" {
+				t.Errorf("job terhenti = %+v", got)
+			}
+			if unfinished, _ := repo.UnfinishedJobs(); len(unfinished) != 0 {
+				t.Errorf("UnfinishedJobs setelah restart = %+v", unfinished)
+			}
+		})
+	}
+}
+
+func TestFileJobRepositoryBuangJobLama(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	lama := time.Now().AddDate(0, 0, -8)
+	b, _ := json.Marshal([]Job{
+		{ID: "lama", Status: JobSelesai, Dibuat: lama, Diperbarui: lama},
+		{ID: "lama-berjalan", Status: JobMembuatSurat, Dibuat: lama, Diperbarui: lama},
+		{ID: "baru", Status: JobGagal, Dibuat: time.Now(), Diperbarui: time.Now()},
+	})
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	repo := newFileJobRepository(path)
+	if _, err := repo.FindJob("lama"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("job selesai lebih dari 7 hari masih ada: %v", err)
+	}
+	for _, id := range []string{"lama-berjalan", "baru"} {
+		if _, err := repo.FindJob(id); err != nil {
+			t.Errorf("FindJob(%s): %v", id, err)
+		}
+	}
+}
+
+func TestHandleJob(t *testing.T) {
+	useTestJobs(t, newFileJobRepository(filepath.Join(t.TempDir(), "jobs.json")))
+	j, err := newJob(JobPinjam)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.tahap(JobMembuatSurat)
+
+	rec := httptest.NewRecorder()
+	writeJobAccepted(rec, j, "✅ Data berhasil diterima")
+	if rec.Code != http.StatusAccepted || rec.Header().Get("X-Job-ID") != j.ID ||
+		rec.Header().Get("Location") != "/jobs/"+j.ID || !strings.Contains(rec.Body.String(), j.ID) {
+		t.Errorf("writeJobAccepted = %d %v %q", rec.Code, rec.Header(), rec.Body)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs/{id}", handleJob)
+	tests := []struct {
+		name     string
+		method   string
+		id       string
+		wantCode int
+	}{
+		{"ada", http.MethodGet, j.ID, http.StatusOK},
+		{"tidak ada", http.MethodGet, "abc", http.StatusNotFound},
+		{"POST", http.MethodPost, j.ID, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, "/jobs/"+tt.id, nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var got Job
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != j.ID || got.Status != JobMembuatSurat || got.Jenis != JobPinjam {
+				t.Errorf("GET /jobs/%s = %+v", tt.id, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Surat adalah link hasil pembuatan surat. DocURL bisa kosong jika renderer
+// tidak membuat dokumen yang bisa diedit.
+type Surat struct {
+	PDFURL string
+	DocURL string
+}
+
+// LetterRenderer membuat surat sesuai LetterDefinition dan menyimpan foto yang
+// dilampirkan di surat. Implementasinya Google Docs/Drive atau PDF lokal tanpa
+// koneksi ke Google.
+type LetterRenderer interface {
+	// UploadFoto menyimpan foto dari localPath dan mengembalikan link-nya.
+	// File di localPath boleh dihapus setelahnya.
+	UploadFoto(localPath string) (string, error)
+	Render(def *LetterDefinition, form FormData, nomorUrut int) (*Surat, error)
+}
+
+var letterRenderer LetterRenderer
+
+// newLetterRendererFromEnv memilih pembuat surat:
+//
+//	SURAT_RENDERER=google (default) atau lokal
+//	SURAT_DIR=data/surat (folder PDF, .docx, dan foto untuk renderer lokal)
+//
+// Renderer lokal menyajikan file lewat GET /surat/file/{nama} di PUBLIC_URL.
+func newLetterRendererFromEnv() (LetterRenderer, error) {
+	switch renderer := getEnv("SURAT_RENDERER", "google"); renderer {
+	case "google":
+		return googleLetterRenderer{}, nil
+	case "lokal":
+		dir := getEnv("SURAT_DIR", filepath.Join("data", "surat"))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("gagal membuat folder surat %s: %v", dir, err)
+		}
+		return &localLetterRenderer{
+			dir:     dir,
+			baseURL: strings.TrimRight(getEnv("PUBLIC_URL", "http://localhost:8080"), "/") + "/surat/file/",
+		}, nil
+	default:
+		return nil, fmt.Errorf("SURAT_RENDERER tidak dikenal: %q", renderer)
+	}
+}
+
+// googleLetterRenderer menyalin template Google Docs, mengekspor PDF lewat
+// Drive, dan mengupload foto ke Drive.
+type googleLetterRenderer struct{}
+
+func (googleLetterRenderer) UploadFoto(localPath string) (string, error) {
+	_, driveService, _, err := getServices()
+	if err != nil {
+		return "", err
+	}
+	mimeType, err := fileContentType(localPath)
+	if err != nil {
+		return "", err
+	}
+	return uploadToDrive(localPath, filepath.Base(localPath), mimeType, driveService)
+}
+
+// Render memakai tata letak PDF lokal (surat_pdf.go) dan menyimpan PDF-nya di
+// PDFFolder jika template Google Docs def belum diperbarui untuk gambar baru;
+// surat seperti itu tidak punya dokumen yang bisa diedit.
+func (googleLetterRenderer) Render(def *LetterDefinition, form FormData, nomorUrut int) (*Surat, error) {
+	_, driveService, docsService, err := getServices()
+	if err != nil {
+		return nil, err
+	}
+	surat, err := renderSuratGoogle(def, form, nomorUrut, driveService, docsService)
+	if !errors.Is(err, errTemplateGoogleLama) {
+		return surat, err
+	}
+	log.Printf("⚠️ %v, surat dibuat dengan PDF lokal", err)
+	now := time.Now()
+	var pdf bytes.Buffer
+	if err := renderSuratPDF(&pdf, def, form, nomorUrut, now); err != nil {
+		return nil, err
+	}
+	pdfURL, err := uploadGooglePDF(driveService, pdf.Bytes(), def.judul(suratReplacements(def, form, nomorUrut, now)), def.PDFFolder)
+	if err != nil {
+		return nil, err
+	}
+	return &Surat{PDFURL: pdfURL}, nil
+}
+
+// localLetterRenderer membuat PDF dengan tata letak di surat_pdf.go dan .docx
+// dari DocxTemplate, lalu menyimpan keduanya di dir. Nama file diberi
+// akhiran acak karena link-nya dikirim ke WA tanpa login, sama seperti link
+// Drive yang bisa dibaca siapa saja.
+type localLetterRenderer struct {
+	dir     string
+	baseURL string
+}
+
+func (l *localLetterRenderer) UploadFoto(localPath string) (string, error) {
+	src, err := os.ReadFile(localPath)
+	if err != nil {
+		return "", err
+	}
+	return l.save("Foto", strings.ToLower(filepath.Ext(localPath)), func(w io.Writer) error {
+		_, err := w.Write(src)
+		return err
+	})
+}
+
+func (l *localLetterRenderer) Render(def *LetterDefinition, form FormData, nomorUrut int) (*Surat, error) {
+	now := time.Now()
+	form.FotoPath = l.source(form.FotoPath)
+	form.PeminjamanFotoPath = l.source(form.PeminjamanFotoPath)
+	form.ApproverTTD = l.source(form.ApproverTTD)
+	form.TTDTahap = append([]TTDTahap(nil), form.TTDTahap...)
+	for i := range form.TTDTahap {
+		form.TTDTahap[i].TTD = l.source(form.TTDTahap[i].TTD)
+	}
+	title := def.judul(suratReplacements(def, form, nomorUrut, now))
+	return l.render(title,
+		func(w io.Writer) error { return renderSuratPDF(w, def, form, nomorUrut, now) },
+		func(w io.Writer) error { return renderSuratDocx(w, def, form, nomorUrut, now) })
+}
+
+// render menyimpan PDF dan .docx. Kegagalan .docx (misalnya template tidak
+// ada) hanya dicatat karena PDF sudah cukup untuk dikirim.
+func (l *localLetterRenderer) render(title string, pdf, docx func(io.Writer) error) (*Surat, error) {
+	pdfURL, err := l.save(title, ".pdf", pdf)
+	if err != nil {
+		return nil, err
+	}
+	docURL, err := l.save(title, ".docx", docx)
+	if err != nil {
+		log.Printf("⚠️ Gagal membuat %s.docx: %v", title, err)
+	}
+	return &Surat{PDFURL: pdfURL, DocURL: docURL}, nil
+}
+
+// save menulis file baru di dir dan mengembalikan link publiknya.
+func (l *localLetterRenderer) save(title, ext string, write func(io.Writer) error) (string, error) {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return "", err
+	}
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s %s%s", safeFileName(title), hex.EncodeToString(raw), ext)
+	if err := writeFileAtomic(filepath.Join(l.dir, name), buf.Bytes()); err != nil {
+		return "", fmt.Errorf("gagal menyimpan %s: %v", name, err)
+	}
+	return l.baseURL + url.PathEscape(name), nil
+}
+
+// source mengubah link file renderer ini menjadi path lokal supaya foto
+// tidak perlu diunduh lewat HTTP dari server sendiri.
+func (l *localLetterRenderer) source(src string) string {
+	name, ok := strings.CutPrefix(src, l.baseURL)
+	if !ok {
+		return src
+	}
+	if name, err := url.PathUnescape(name); err == nil && name == filepath.Base(name) {
+		return filepath.Join(l.dir, name)
+	}
+	return src
+}
+
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '-'
+		}
+		return r
+	}, s)
+}
+
+// handleSuratFile menyajikan surat dan foto dari renderer lokal:
+// GET /surat/file/{nama}.
+func handleSuratFile(w http.ResponseWriter, r *http.Request) {
+	l, ok := letterRenderer.(*localLetterRenderer)
+	name := r.PathValue("nama")
+	if !ok || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(l.dir, name))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalLetterRenderer(t *testing.T) {
+	l := &localLetterRenderer{dir: t.TempDir(), baseURL: "http://backend/surat/file/"}
+	old := letterRenderer
+	letterRenderer = l
+	t.Cleanup(func() { letterRenderer = old })
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 8, 6))); err != nil {
+		t.Fatal(err)
+	}
+	upload := filepath.Join(t.TempDir(), "foto.png")
+	if err := os.WriteFile(upload, img.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fotoURL, err := l.UploadFoto(upload)
+	if err != nil || !strings.HasPrefix(fotoURL, l.baseURL) || !strings.HasSuffix(fotoURL, ".png") {
+		t.Fatalf("UploadFoto = %q, %v", fotoURL, err)
+	}
+	// Link foto milik renderer ini dibaca langsung dari dir.
+	if src := l.source(fotoURL); filepath.Dir(src) != l.dir {
+		t.Errorf("source(%q) = %q", fotoURL, src)
+	}
+	if src := l.source("https://drive/foto"); src != "https://drive/foto" {
+		t.Errorf("source link lain = %q", src)
+	}
+
+	form := FormData{Nama: "Budi/Santoso", Kelas: "XI TKJ 1", TanggalPinjam: "2026-05-11", TanggalKembali: "2026-05-12", FotoPath: fotoURL}
+	form.setItems([]ItemPinjam{{"Kamera", 2}, {"Tripod", 1}})
+	surat, err := l.Render(suratPeminjaman, form, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(surat.PDFURL, ".pdf") || !strings.HasSuffix(surat.DocURL, ".docx") {
+		t.Fatalf("surat = %+v", surat)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /surat/file/{nama}", handleSuratFile)
+	name := strings.TrimPrefix(surat.PDFURL, l.baseURL)
+	if unescaped, _ := url.PathUnescape(name); strings.Contains(unescaped, "Budi/Santoso") {
+		t.Errorf("nama file memuat garis miring: %q", unescaped)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/surat/file/"+name, nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "%PDF-") {
+		t.Errorf("GET PDF = %d %.20q", rec.Code, rec.Body.String())
+	}
+	for _, path := range []string{"/surat/file/tidak-ada.pdf", "/surat/file/..%2Fsecret", "/surat/file/.rahasia"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, rec.Code)
+		}
+	}
+}
+
+func TestFileContentType(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"ttd.png", testPNG(t, 30, 10), "image/png"},
+		{"foto.jpg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), "image/jpeg"},
+		{"catatan.txt", []byte("bukan gambar"), "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := fileContentType(path); got != tt.want || err != nil {
+			t.Errorf("fileContentType(%s) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := fileContentType(filepath.Join(dir, "tidak-ada.png")); err == nil {
+		t.Error("fileContentType file yang tidak ada tidak error")
+	}
+}
+
+func TestPDFWrap(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		maxWidth float64
+		want     int
+	}{
+		{"muat satu baris", "Kamera dan tripod", 500, 1},
+		{"dipecah per kata", "Kamera dan tripod untuk lomba fotografi tingkat kota", 100, 3},
+		{"baris baru", "satu\ndua", 500, 2},
+	}
+	for _, tt := range tests {
+		lines := pdfWrap(tt.s, 11, false, tt.maxWidth)
+		if len(lines) != tt.want {
+			t.Errorf("%s: pdfWrap = %q, want %d baris", tt.name, lines, tt.want)
+		}
+		for _, l := range lines {
+			if w := pdfTextWidth(l, 11, false); w > tt.maxWidth && strings.Contains(l, " ") {
+				t.Errorf("%s: baris %q lebar %.0f > %.0f", tt.name, l, w, tt.maxWidth)
+			}
+		}
+	}
+}
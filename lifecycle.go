@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// LoanStatus adalah tahap peminjaman. Nilainya disimpan apa adanya di kolom Q
+// "Form Peminjam" dan kolom status SQLite.
+type LoanStatus string
+
+const (
+	StatusDiajukan     LoanStatus = "Diajukan"
+	StatusDisetujui    LoanStatus = "Disetujui"
+	StatusDitolak      LoanStatus = "Ditolak"
+	StatusDipinjam     LoanStatus = "Dipinjam"
+	StatusDikembalikan LoanStatus = "Dikembalikan"
+	StatusTerlambat    LoanStatus = "Terlambat"
+	StatusHilang       LoanStatus = "Hilang"
+)
+
+// loanTransitions adalah satu-satunya daftar perpindahan status yang sah:
+//
+//	Diajukan → Disetujui / Ditolak
+//	Disetujui → Dipinjam
+//	Dipinjam → Dikembalikan / Terlambat / Hilang
+//	Terlambat → Dikembalikan / Hilang
+var loanTransitions = map[LoanStatus][]LoanStatus{
+	StatusDiajukan:  {StatusDisetujui, StatusDitolak},
+	StatusDisetujui: {StatusDipinjam},
+	StatusDipinjam:  {StatusDikembalikan, StatusTerlambat, StatusHilang},
+	StatusTerlambat: {StatusDikembalikan, StatusHilang},
+}
+
+// TransitionError dikembalikan jika perpindahan status tidak diizinkan.
+type TransitionError struct {
+	ID       int
+	From, To LoanStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("peminjaman %s berstatus %s, tidak bisa diubah menjadi %s", formatLoanID(e.ID), e.From, e.To)
+}
+
+func canTransition(from, to LoanStatus) bool {
+	for _, next := range loanTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLoanStatus menerima nama status baru maupun isian lama di sheet
+// ("Approved", "Setuju", kosong, dan sebagainya).
+func parseLoanStatus(s string) (LoanStatus, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "diajukan", "submitted", "pending", "menunggu":
+		return StatusDiajukan, nil
+	case "disetujui", "approved", "setuju", "diterima":
+		return StatusDisetujui, nil
+	case "ditolak", "rejected", "tolak", "tidak disetujui":
+		return StatusDitolak, nil
+	case "dipinjam", "borrowed":
+		return StatusDipinjam, nil
+	case "dikembalikan", "returned", "kembali":
+		return StatusDikembalikan, nil
+	case "terlambat", "overdue":
+		return StatusTerlambat, nil
+	case "hilang", "lost":
+		return StatusHilang, nil
+	}
+	return "", fmt.Errorf("status tidak dikenal: %q", s)
+}
+
+// loanStatusFromStorage membaca status yang tersimpan. Isian yang tidak dikenal
+// dibiarkan apa adanya sehingga tidak punya perpindahan yang sah.
+func loanStatusFromStorage(s string) LoanStatus {
+	status, err := parseLoanStatus(s)
+	if err != nil {
+		return LoanStatus(strings.TrimSpace(s))
+	}
+	return status
+}
+
+// parseApprovalDecision hanya menerima keputusan approver: Disetujui atau Ditolak.
+func parseApprovalDecision(s string) (LoanStatus, error) {
+	status, err := parseLoanStatus(s)
+	if err != nil || (status != StatusDisetujui && status != StatusDitolak) {
+		return "", fmt.Errorf("status persetujuan harus Disetujui atau Ditolak, bukan %q", s)
+	}
+	return status, nil
+}
+
+// lifecycleMu menyerialkan perubahan status di dalam proses; backend Sheets
+// tidak punya compare-and-set sendiri.
+var lifecycleMu sync.Mutex
+
+// transitionLoan memindahkan status peminjaman setelah memeriksa loanTransitions.
+// approver diisi saat keputusan persetujuan, kosong untuk perpindahan lain.
+func transitionLoan(id int, to LoanStatus, approver string) (*Peminjaman, error) {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+
+	loan, err := loanRepo.FindLoan(id)
+	if err != nil {
+		return nil, err
+	}
+	return loan, transitionLoanLocked(loan, to, approver)
+}
+
+// transitionLoanLocked seperti transitionLoan untuk loan yang sudah dibaca;
+// pemanggil harus memegang lifecycleMu. loan ikut diperbarui jika berhasil.
+func transitionLoanLocked(loan *Peminjaman, to LoanStatus, approver string) error {
+	id := loan.ID
+	from := loan.Status
+	if !canTransition(from, to) {
+		return &TransitionError{ID: id, From: from, To: to}
+	}
+	// Stok diperiksa ulang saat disetujui karena pengajuan yang belum disetujui
+	// tidak mengurangi stok.
+	if to == StatusDisetujui {
+		if _, err := checkStock(loan.Form, id); err != nil && !errors.Is(err, errTanggalTidakValid) {
+			return err
+		}
+	}
+	err := loanRepo.UpdateStatus(id, from, to, approver)
+	if errors.Is(err, ErrStatusChanged) {
+		return &TransitionError{ID: id, From: from, To: to}
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("INFO: Status peminjaman %s: %s → %s", formatLoanID(id), from, to)
+	loan.Status = to
+	if approver != "" {
+		loan.Approver = approver
+	}
+	return nil
+}
+
+// ReturnError dikembalikan jika alat yang dikembalikan tidak ada di peminjaman
+// atau jumlahnya melebihi sisa yang belum kembali.
+type ReturnError struct {
+	ID       int
+	Alat     string
+	Diminta  int
+	Sisa     int
+	Dipinjam bool // false jika alat tidak ada di peminjaman
+}
+
+func (e *ReturnError) Error() string {
+	if !e.Dipinjam {
+		return fmt.Sprintf("alat %s tidak ada di peminjaman %s", e.Alat, formatLoanID(e.ID))
+	}
+	return fmt.Sprintf("pengembalian %s untuk peminjaman %s melebihi sisa: dikembalikan %d, sisa %d", e.Alat, formatLoanID(e.ID), e.Diminta, e.Sisa)
+}
+
+// returnMu menyerialkan pengembalian supaya sisa alat tidak dihitung dua kali.
+// lifecycleMu hanya dipegang saat status diubah, tidak selama pengembalian
+// ditulis ke sheet.
+var returnMu sync.Mutex
+
+// recordReturn mencatat satu pengembalian. ret.Items kosong berarti semua sisa
+// alat dikembalikan. Peminjaman baru berstatus Dikembalikan jika tidak ada sisa;
+// sebelum itu tetap Dipinjam (atau Terlambat). Peminjaman yang baru disetujui
+// dianggap sudah diambil (Disetujui → Dipinjam) karena pengambilan alat belum
+// selalu dicatat petugas.
+//
+// Status baru diubah setelah pengembalian tercatat. Jika perubahan status itu
+// gagal, error-nya hanya dicatat di log supaya klien tidak mengulang
+// pengembalian yang sudah tersimpan; status diselesaikan pada permintaan
+// pengembalian berikutnya.
+func recordReturn(id int, ret *Pengembalian) (*Peminjaman, error) {
+	returnMu.Lock()
+	defer returnMu.Unlock()
+
+	loan, err := loanRepo.FindLoan(id)
+	if err != nil {
+		return nil, err
+	}
+	switch loan.Status {
+	case StatusDisetujui, StatusDipinjam, StatusTerlambat:
+	default:
+		return loan, &TransitionError{ID: id, From: loan.Status, To: StatusDikembalikan}
+	}
+
+	sisa := loan.sisa()
+	if len(sisa) == 0 {
+		// Semua alat sudah tercatat kembali, hanya statusnya yang dulu gagal diubah.
+		if err := finishReturnStatus(loan, true); err != nil {
+			return loan, err
+		}
+		return loan, &TransitionError{ID: id, From: loan.Status, To: StatusDikembalikan}
+	}
+	if len(ret.Items) == 0 {
+		ret.Items = sisa
+	}
+	// Nama alat ditulis sama dengan di peminjaman.
+	for i, it := range ret.Items {
+		for _, pinjam := range loan.Form.items() {
+			if strings.EqualFold(strings.TrimSpace(it.NamaAlat), pinjam.NamaAlat) {
+				ret.Items[i].NamaAlat = pinjam.NamaAlat
+			}
+		}
+	}
+	ret.Items = addItems(nil, ret.Items)
+	for _, it := range ret.Items {
+		if n := jumlahOf(sisa, it.NamaAlat); it.Jumlah > n {
+			return loan, &ReturnError{ID: id, Alat: it.NamaAlat, Diminta: it.Jumlah, Sisa: n, Dipinjam: jumlahOf(loan.Form.items(), it.NamaAlat) > 0}
+		}
+	}
+
+	ret.IDPinjam = id
+	if ret.Nama == "" {
+		ret.Nama = loan.Form.Nama
+	}
+	kembali := addItems(loan.Kembali, ret.Items)
+	ret.Sisa = Peminjaman{Form: loan.Form, Kembali: kembali}.sisa()
+	if err := loanRepo.RecordReturn(ret); err != nil {
+		return loan, err
+	}
+	loan.Kembali = kembali
+	log.Printf("INFO: Pengembalian %s untuk peminjaman %s: %s, sisa %s", formatLoanID(ret.ID), formatLoanID(id), itemSummary(ret.Items), itemSummary(ret.Sisa))
+
+	if err := finishReturnStatus(loan, len(ret.Sisa) == 0); err != nil {
+		log.Printf("❌ Pengembalian %s tercatat tetapi status peminjaman %s gagal diubah: %v", formatLoanID(ret.ID), formatLoanID(id), err)
+	}
+	return loan, nil
+}
+
+// finishReturnStatus mengubah status peminjaman setelah pengembalian tercatat:
+// Disetujui → Dipinjam, lalu Dikembalikan jika selesai. Status dibaca ulang di
+// bawah lifecycleMu karena bisa sudah berubah selama pengembalian ditulis.
+func finishReturnStatus(loan *Peminjaman, selesai bool) error {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+
+	current, err := loanRepo.FindLoan(loan.ID)
+	if err != nil {
+		return err
+	}
+	loan.Status = current.Status
+	if loan.Status == StatusDisetujui {
+		if err := transitionLoanLocked(loan, StatusDipinjam, ""); err != nil {
+			return err
+		}
+	}
+	if selesai {
+		return transitionLoanLocked(loan, StatusDikembalikan, "")
+	}
+	return nil
+}
+
+// writeTransitionError menerjemahkan error transitionLoan ke status HTTP.
+func writeTransitionError(w http.ResponseWriter, err error) {
+	var te *TransitionError
+	var se *StockError
+	var re *ReturnError
+	switch {
+	case errors.As(err, &te):
+		http.Error(w, "❌ "+te.Error(), http.StatusConflict)
+	case errors.As(err, &se):
+		http.Error(w, "❌ "+se.Error(), http.StatusConflict)
+	case errors.As(err, &re):
+		http.Error(w, "❌ "+re.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrLoanNotFound):
+		http.Error(w, "ID Pinjam tidak ditemukan", http.StatusNotFound)
+	case errors.Is(err, ErrBukanGiliran):
+		http.Error(w, "❌ "+err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrTahapTerlewati):
+		http.Error(w, "❌ "+err.Error(), http.StatusConflict)
+	default:
+		log.Println("Transition error:", err)
+		http.Error(w, "Gagal mengubah status peminjaman", http.StatusInternalServerError)
+	}
+}
+
+// handleStatusPeminjaman dipakai petugas lab untuk mencatat alat diambil
+// (Dipinjam), terlambat, atau hilang.
+func handleStatusPeminjaman(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseMultipartForm(10 << 20)
+	id, err := parseLoanID(r.FormValue("idPinjam"))
+	if err != nil {
+		http.Error(w, "ID Pinjam tidak valid", http.StatusBadRequest)
+		return
+	}
+	to, err := parseLoanStatus(r.FormValue("status"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Persetujuan dan pengembalian punya endpoint sendiri yang juga membuat surat.
+	switch to {
+	case StatusDisetujui, StatusDitolak:
+		http.Error(w, "Gunakan /approval-request-new untuk persetujuan", http.StatusBadRequest)
+		return
+	case StatusDikembalikan:
+		http.Error(w, "Gunakan /pengembalian untuk pengembalian alat", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := transitionLoan(id, to, ""); err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+	fmt.Fprintf(w, "✅ Status peminjaman %s sekarang %s", formatLoanID(id), to)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to LoanStatus
+		want     bool
+	}{
+		{StatusDiajukan, StatusDisetujui, true},
+		{StatusDiajukan, StatusDitolak, true},
+		{StatusDiajukan, StatusDipinjam, false},
+		{StatusDisetujui, StatusDipinjam, true},
+		{StatusDisetujui, StatusDikembalikan, false},
+		{StatusDipinjam, StatusDikembalikan, true},
+		{StatusDipinjam, StatusTerlambat, true},
+		{StatusDipinjam, StatusHilang, true},
+		{StatusTerlambat, StatusDikembalikan, true},
+		{StatusTerlambat, StatusDipinjam, false},
+		{StatusDitolak, StatusDisetujui, false},
+		{StatusDikembalikan, StatusDipinjam, false},
+		{StatusHilang, StatusDikembalikan, false},
+		{"Approved?", StatusDisetujui, false},
+	}
+	for _, tt := range tests {
+		if got := canTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestParseLoanStatus(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    LoanStatus
+		wantErr bool
+	}{
+		{"", StatusDiajukan, false},
+		{" Approved ", StatusDisetujui, false},
+		{"tidak disetujui", StatusDitolak, false},
+		{"OVERDUE", StatusTerlambat, false},
+		{"lost", StatusHilang, false},
+		{"entah", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseLoanStatus(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseLoanStatus(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestTransitionLoanLocked(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to LoanStatus
+		jumlah   int // jumlah Kamera yang diminta; stok 2, 1 sudah disetujui
+		approver string
+		wantErr  any // nil, *TransitionError, atau *StockError
+	}{
+		{"disetujui", StatusDiajukan, StatusDisetujui, 1, "Pak Budi", nil},
+		{"ditolak tanpa cek stok", StatusDiajukan, StatusDitolak, 5, "Pak Budi", nil},
+		{"stok tidak cukup", StatusDiajukan, StatusDisetujui, 2, "Pak Budi", &StockError{}},
+		{"diambil", StatusDisetujui, StatusDipinjam, 1, "", nil},
+		{"terlambat", StatusDipinjam, StatusTerlambat, 1, "", nil},
+		{"lompat status", StatusDiajukan, StatusDipinjam, 1, "", &TransitionError{}},
+		{"sudah selesai", StatusDikembalikan, StatusHilang, 1, "", &TransitionError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestStorage(t)
+			alatRepo.SaveAlat(&Alat{Kode: "KAM", Nama: "Kamera", Jumlah: 2})
+			createTestLoan(t, StatusDisetujui, "Kamera", 1, "2026-03-01", "2026-03-03")
+			loan := createTestLoan(t, tt.from, "Kamera", tt.jumlah, "2026-03-02", "2026-03-04")
+
+			err := transitionLoanLocked(loan, tt.to, tt.approver)
+			stored, ferr := loanRepo.FindLoan(loan.ID)
+			if ferr != nil {
+				t.Fatal(ferr)
+			}
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("transitionLoanLocked: %v", err)
+				}
+				if loan.Status != tt.to || stored.Status != tt.to {
+					t.Errorf("status = %s (tersimpan %s), want %s", loan.Status, stored.Status, tt.to)
+				}
+				if stored.Approver != tt.approver {
+					t.Errorf("approver = %q, want %q", stored.Approver, tt.approver)
+				}
+			case *TransitionError:
+				if !errors.As(err, &want) || want.From != tt.from || want.To != tt.to {
+					t.Errorf("err = %v, want TransitionError %s → %s", err, tt.from, tt.to)
+				}
+			case *StockError:
+				if !errors.As(err, &want) || want.Tersedia != 1 || want.Diminta != 2 {
+					t.Errorf("err = %v, want StockError tersedia 1", err)
+				}
+			}
+			if tt.wantErr != nil && (loan.Status != tt.from || stored.Status != tt.from) {
+				t.Errorf("status berubah menjadi %s (tersimpan %s) padahal gagal", loan.Status, stored.Status)
+			}
+		})
+	}
+}
+
+func TestTransitionLoanStatusChanged(t *testing.T) {
+	newTestStorage(t)
+	loan := createTestLoan(t, StatusDisetujui, "Kamera", 1, "2026-03-01", "2026-03-03")
+	stale := *loan
+	if err := transitionLoanLocked(loan, StatusDipinjam, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Salinan lama masih mengira statusnya Disetujui.
+	var te *TransitionError
+	if err := transitionLoanLocked(&stale, StatusDipinjam, ""); !errors.As(err, &te) {
+		t.Errorf("err = %v, want TransitionError", err)
+	}
+}
+
+// returnGagal menggagalkan setiap RecordReturn.
+type returnGagal struct{ LoanRepository }
+
+func (returnGagal) RecordReturn(*Pengembalian) error { return errors.New("sheet penuh") }
+
+// statusGagal menggagalkan setiap UpdateStatus.
+type statusGagal struct{ LoanRepository }
+
+func (statusGagal) UpdateStatus(int, LoanStatus, LoanStatus, string) error {
+	return errors.New("sheet penuh")
+}
+
+func TestRecordReturn(t *testing.T) {
+	newTestStorage(t)
+	pinjam := func(status LoanStatus) *Peminjaman {
+		loan := &Peminjaman{Status: status, Form: FormData{Nama: "Budi", TanggalPinjam: "2026-03-01", TanggalKembali: "2026-03-03"}}
+		loan.Form.setItems([]ItemPinjam{{"Kamera", 2}, {"Tripod", 1}})
+		if err := loanRepo.CreateLoan(loan); err != nil {
+			t.Fatal(err)
+		}
+		return loan
+	}
+
+	t.Run("sebagian lalu sisanya", func(t *testing.T) {
+		loan := pinjam(StatusDipinjam)
+		got, err := recordReturn(loan.ID, &Pengembalian{Items: []ItemPinjam{{" kamera", 1}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != StatusDipinjam || itemSummary(got.sisa()) != itemSummary([]ItemPinjam{{"Kamera", 1}, {"Tripod", 1}}) {
+			t.Errorf("status %s sisa %v setelah pengembalian sebagian", got.Status, got.sisa())
+		}
+		ret := &Pengembalian{}
+		if got, err = recordReturn(loan.ID, ret); err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != StatusDikembalikan || len(ret.Sisa) != 0 || totalJumlah(ret.Items) != 2 {
+			t.Errorf("status %s, dikembalikan %v, sisa %v", got.Status, ret.Items, ret.Sisa)
+		}
+	})
+
+	t.Run("disetujui dianggap sudah diambil", func(t *testing.T) {
+		loan := pinjam(StatusDisetujui)
+		if _, err := recordReturn(loan.ID, &Pengembalian{}); err != nil {
+			t.Fatal(err)
+		}
+		if stored, _ := loanRepo.FindLoan(loan.ID); stored.Status != StatusDikembalikan {
+			t.Errorf("status tersimpan %s, want Dikembalikan", stored.Status)
+		}
+	})
+
+	t.Run("pengembalian gagal dicatat", func(t *testing.T) {
+		loan := pinjam(StatusDisetujui)
+		db := loanRepo
+		loanRepo = returnGagal{db}
+		_, err := recordReturn(loan.ID, &Pengembalian{})
+		loanRepo = db
+		if err == nil {
+			t.Fatal("recordReturn berhasil padahal pengembalian gagal dicatat")
+		}
+		if stored, _ := loanRepo.FindLoan(loan.ID); stored.Status != StatusDisetujui {
+			t.Errorf("status tersimpan %s, want tetap Disetujui", stored.Status)
+		}
+	})
+
+	t.Run("status gagal diubah", func(t *testing.T) {
+		loan := pinjam(StatusDipinjam)
+		db := loanRepo
+		loanRepo = statusGagal{db}
+		_, err := recordReturn(loan.ID, &Pengembalian{})
+		loanRepo = db
+		// Pengembalian sudah tercatat, jadi klien tidak boleh mengulangnya.
+		if err != nil {
+			t.Fatalf("recordReturn = %v, want nil", err)
+		}
+		stored, _ := loanRepo.FindLoan(loan.ID)
+		if stored.Status != StatusDipinjam || len(stored.sisa()) != 0 {
+			t.Fatalf("status %s sisa %v", stored.Status, stored.sisa())
+		}
+		// Permintaan berikutnya hanya menyelesaikan statusnya.
+		var te *TransitionError
+		if _, err := recordReturn(loan.ID, &Pengembalian{}); !errors.As(err, &te) {
+			t.Errorf("err = %v, want TransitionError", err)
+		}
+		stored, _ = loanRepo.FindLoan(loan.ID)
+		if stored.Status != StatusDikembalikan || totalJumlah(stored.Kembali) != 3 {
+			t.Errorf("status %s kembali %v, want Dikembalikan tanpa pengembalian ganda", stored.Status, stored.Kembali)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		status   LoanStatus
+		items    []ItemPinjam
+		wantErr  any // *TransitionError atau *ReturnError
+		dipinjam bool
+	}{
+		{"melebihi sisa", StatusDipinjam, []ItemPinjam{{"Kamera", 3}}, &ReturnError{}, true},
+		{"alat lain", StatusDipinjam, []ItemPinjam{{"Drone", 1}}, &ReturnError{}, false},
+		{"belum disetujui", StatusDiajukan, nil, &TransitionError{}, false},
+		{"sudah kembali", StatusDikembalikan, nil, &TransitionError{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := pinjam(tt.status)
+			_, err := recordReturn(loan.ID, &Pengembalian{Items: tt.items})
+			switch want := tt.wantErr.(type) {
+			case *ReturnError:
+				if !errors.As(err, &want) || want.Dipinjam != tt.dipinjam {
+					t.Errorf("err = %v, want ReturnError (dipinjam %v)", err, tt.dipinjam)
+				}
+			case *TransitionError:
+				if !errors.As(err, &want) {
+					t.Errorf("err = %v, want TransitionError", err)
+				}
+			}
+			if stored, _ := loanRepo.FindLoan(loan.ID); stored.Status != tt.status || len(stored.Kembali) != 0 {
+				t.Errorf("status %s kembali %v berubah padahal gagal", stored.Status, stored.Kembali)
+			}
+		})
+	}
+}
+
+func TestHandleStatusPeminjaman(t *testing.T) {
+	newTestStorage(t)
+	dipinjam := createTestLoan(t, StatusDipinjam, "Kamera", 1, "2026-03-01", "2026-03-03")
+	diajukan := createTestLoan(t, StatusDiajukan, "Kamera", 1, "2026-03-01", "2026-03-03")
+
+	tests := []struct {
+		name     string
+		method   string
+		id       string
+		status   string
+		wantCode int
+		wantBody string
+	}{
+		{"terlambat", http.MethodPost, formatLoanID(dipinjam.ID), "Terlambat", http.StatusOK, "sekarang Terlambat"},
+		{"perpindahan tidak sah", http.MethodPost, formatLoanID(diajukan.ID), "Hilang", http.StatusConflict, "tidak bisa diubah"},
+		{"persetujuan lewat endpoint lain", http.MethodPost, formatLoanID(diajukan.ID), "Disetujui", http.StatusBadRequest, "/approval-request-new"},
+		{"pengembalian lewat endpoint lain", http.MethodPost, formatLoanID(dipinjam.ID), "Dikembalikan", http.StatusBadRequest, "/pengembalian"},
+		{"status tidak dikenal", http.MethodPost, formatLoanID(dipinjam.ID), "entah", http.StatusBadRequest, "status tidak dikenal"},
+		{"id tidak valid", http.MethodPost, "abc", "Hilang", http.StatusBadRequest, "ID Pinjam tidak valid"},
+		{"id tidak ada", http.MethodPost, "9999", "Hilang", http.StatusNotFound, "tidak ditemukan"},
+		{"bukan POST", http.MethodGet, formatLoanID(dipinjam.ID), "Hilang", http.StatusMethodNotAllowed, "Method not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"idPinjam": {tt.id}, "status": {tt.status}}
+			r := httptest.NewRequest(tt.method, "/status-peminjaman", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			handleStatusPeminjaman(w, r)
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("kode %d %q, want %d berisi %q", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+	if loan, _ := loanRepo.FindLoan(dipinjam.ID); loan.Status != StatusTerlambat {
+		t.Errorf("status tersimpan %s, want Terlambat", loan.Status)
+	}
+}
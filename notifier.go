@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Notifier mengirim satu pesan WA ke nomor yang sudah dinormalisasi (62...).
+type Notifier interface {
+	Name() string
+	Send(no, pesan string) error
+}
+
+var notifier Notifier
+
+var notifierClient = &http.Client{Timeout: 10 * time.Second}
+
+// newNotifierFromEnv menyusun provider WA sesuai urutan failover:
+//
+//	WA_PROVIDERS=bangkit,cloudapi,webhook (default bangkit)
+//	WA_BANGKIT_URL, WA_BANGKIT_API_KEY, WA_BANGKIT_SENDER
+//	WA_CLOUD_PHONE_NUMBER_ID, WA_CLOUD_TOKEN, WA_CLOUD_API_VERSION (default v19.0)
+//	WA_WEBHOOK_URL, WA_WEBHOOK_TOKEN
+//
+// Provider yang konfigurasinya belum lengkap dilewati.
+func newNotifierFromEnv() (Notifier, error) {
+	var providers []Notifier
+	for _, name := range strings.Split(getEnv("WA_PROVIDERS", "bangkit"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		n, err := newProvider(name)
+		if err != nil {
+			log.Printf("⚠️ Provider WA %s dilewati: %v", name, err)
+			continue
+		}
+		providers = append(providers, n)
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("tidak ada provider WA yang bisa dipakai (WA_PROVIDERS=%q)", getEnv("WA_PROVIDERS", "bangkit"))
+	}
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+	return &failoverNotifier{providers: providers}, nil
+}
+
+func newProvider(name string) (Notifier, error) {
+	switch name {
+	case "bangkit":
+		n := &bangkitNotifier{
+			url:    getEnv("WA_BANGKIT_URL", "https://wa.bangkitsolusibangsa.id/send-message"),
+			apiKey: getEnv("WA_BANGKIT_API_KEY", ""),
+			sender: getEnv("WA_BANGKIT_SENDER", ""),
+		}
+		if n.apiKey == "" || n.sender == "" {
+			return nil, errors.New("WA_BANGKIT_API_KEY dan WA_BANGKIT_SENDER harus diisi")
+		}
+		return n, nil
+	case "cloudapi":
+		n := &cloudAPINotifier{
+			phoneNumberID: getEnv("WA_CLOUD_PHONE_NUMBER_ID", ""),
+			token:         getEnv("WA_CLOUD_TOKEN", ""),
+			version:       getEnv("WA_CLOUD_API_VERSION", "v19.0"),
+		}
+		if n.phoneNumberID == "" || n.token == "" {
+			return nil, errors.New("WA_CLOUD_PHONE_NUMBER_ID dan WA_CLOUD_TOKEN harus diisi")
+		}
+		return n, nil
+	case "webhook":
+		n := &webhookNotifier{url: getEnv("WA_WEBHOOK_URL", ""), token: getEnv("WA_WEBHOOK_TOKEN", "")}
+		if n.url == "" {
+			return nil, errors.New("WA_WEBHOOK_URL harus diisi")
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("provider tidak dikenal")
+}
+
+// postJSON mengirim body sebagai JSON dan menganggap status >= 300 sebagai gagal.
+func postJSON(url string, body interface{}, header map[string]string) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := notifierClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("WA API error: %s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// bangkitNotifier adalah gateway wa.bangkitsolusibangsa.id yang dipakai sejak awal.
+type bangkitNotifier struct {
+	url, apiKey, sender string
+}
+
+func (n *bangkitNotifier) Name() string { return "bangkit" }
+
+func (n *bangkitNotifier) Send(no, pesan string) error {
+	return postJSON(n.url, map[string]string{
+		"api_key": n.apiKey,
+		"sender":  n.sender,
+		"number":  no,
+		"message": pesan,
+	}, nil)
+}
+
+// cloudAPINotifier mengirim lewat WhatsApp Cloud API (Meta). Pesan teks biasa
+// hanya sampai jika penerima pernah membalas dalam 24 jam terakhir; di luar itu
+// Meta mewajibkan template.
+type cloudAPINotifier struct {
+	phoneNumberID, token, version string
+}
+
+func (n *cloudAPINotifier) Name() string { return "cloudapi" }
+
+func (n *cloudAPINotifier) Send(no, pesan string) error {
+	url := fmt.Sprintf("https://graph.facebook.com/%s/%s/messages", n.version, n.phoneNumberID)
+	return postJSON(url, map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"to":                no,
+		"type":              "text",
+		"text":              map[string]string{"body": pesan},
+	}, map[string]string{"Authorization": "Bearer " + n.token})
+}
+
+// webhookNotifier meneruskan pesan ke URL mana pun yang menerima
+// {"number": "...", "message": "..."}, misalnya gateway WA milik sekolah.
+type webhookNotifier struct {
+	url, token string
+}
+
+func (n *webhookNotifier) Name() string { return "webhook" }
+
+func (n *webhookNotifier) Send(no, pesan string) error {
+	header := map[string]string{}
+	if n.token != "" {
+		header["Authorization"] = "Bearer " + n.token
+	}
+	return postJSON(n.url, map[string]string{"number": no, "message": pesan}, header)
+}
+
+// failoverNotifier mencoba provider satu per satu sampai ada yang berhasil.
+type failoverNotifier struct {
+	providers []Notifier
+}
+
+func (f *failoverNotifier) Name() string {
+	names := make([]string, len(f.providers))
+	for i, p := range f.providers {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *failoverNotifier) Send(no, pesan string) error {
+	var errs []string
+	for _, p := range f.providers {
+		err := p.Send(no, pesan)
+		if err == nil {
+			if len(errs) > 0 {
+				log.Printf("INFO: WA ke %s terkirim lewat %s setelah provider lain gagal", no, p.Name())
+			}
+			return nil
+		}
+		log.Printf("⚠️ Provider WA %s gagal: %v", p.Name(), err)
+		errs = append(errs, p.Name()+": "+err.Error())
+	}
+	return fmt.Errorf("semua provider WA gagal: %s", strings.Join(errs, "; "))
+}
+
+// Kanal notifikasi yang bisa dipilih penerima.
+const (
+	KanalWA    = "wa"
+	KanalEmail = "email"
+)
+
+// Penerima adalah tujuan notifikasi beserta kanal yang dipilihnya.
+type Penerima struct {
+	Nama  string
+	NoWA  string
+	Email string
+	Kanal string // "wa", "email", atau "wa,email"; kosong berarti wa
+}
+
+// parseKanal merapikan isian kanal, misalnya "Email, WA" menjadi "wa,email".
+func parseKanal(s string) (string, error) {
+	var wa, email bool
+	for _, k := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "":
+		case KanalWA, "whatsapp":
+			wa = true
+		case KanalEmail, "e-mail":
+			email = true
+		default:
+			return "", fmt.Errorf("kanal notifikasi tidak dikenal: %q", k)
+		}
+	}
+	switch {
+	case wa && email:
+		return KanalWA + "," + KanalEmail, nil
+	case email:
+		return KanalEmail, nil
+	default:
+		return KanalWA, nil
+	}
+}
+
+func (p Penerima) pakai(kanal string) bool {
+	k, err := parseKanal(p.Kanal)
+	if err != nil {
+		k = KanalWA
+	}
+	for _, x := range strings.Split(k, ",") {
+		if x == kanal {
+			return true
+		}
+	}
+	return false
+}
+
+func peminjamPenerima(form FormData) Penerima {
+	return Penerima{Nama: form.Nama, NoWA: form.NoWA, Email: form.Email, Kanal: form.Kanal}
+}
+
+// approverPenerima dibaca dari APPROVER_NAMA, APPROVER_NO, APPROVER_EMAIL, dan
+// APPROVER_KANAL.
+func approverPenerima() Penerima {
+	return Penerima{
+		Nama:  getEnv("APPROVER_NAMA", ""),
+		NoWA:  getEnv("APPROVER_NO", ""),
+		Email: getEnv("APPROVER_EMAIL", ""),
+		Kanal: getEnv("APPROVER_KANAL", KanalWA),
+	}
+}
+
+// kirimNotifikasi memasukkan pesan ke outbox untuk setiap kanal yang dipilih
+// penerima. subjek hanya dipakai untuk email. Error dikembalikan jika tidak ada
+// satu kanal pun yang berhasil.
+func kirimNotifikasi(p Penerima, subjek, pesan string) error {
+	var errs []string
+	queued := 0
+	if p.pakai(KanalWA) {
+		if err := kirimPesanWA(p.NoWA, pesan); err != nil {
+			errs = append(errs, "wa: "+err.Error())
+		} else {
+			queued++
+			log.Println("📲 WA masuk antrean ke:", normalizePhoneNumber(p.NoWA))
+		}
+	}
+	if p.pakai(KanalEmail) {
+		switch {
+		case mailer == nil:
+			errs = append(errs, "email: SMTP belum dikonfigurasi")
+		case p.Email == "":
+			errs = append(errs, "email: alamat email kosong")
+		default:
+			if err := enqueueEmail(p.Email, subjek, pesan); err != nil {
+				errs = append(errs, "email: "+err.Error())
+			} else {
+				queued++
+				log.Println("📧 Email masuk antrean ke:", p.Email)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		log.Printf("⚠️ Notifikasi %q ke %s: %s", subjek, p.Nama, strings.Join(errs, "; "))
+	}
+	if queued == 0 {
+		return fmt.Errorf("tidak ada kanal yang bisa dipakai: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeNotifier mencatat pesan yang dikirim dan gagal jika err diisi.
+type fakeNotifier struct {
+	name string
+	err  error
+	sent []string
+}
+
+func (f *fakeNotifier) Name() string { return f.name }
+
+func (f *fakeNotifier) Send(no, pesan string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, no+": "+pesan)
+	return nil
+}
+
+func TestFailoverNotifier(t *testing.T) {
+	down := errors.New("gateway mati")
+	tests := []struct {
+		name     string
+		errs     []error // error tiap provider berurutan
+		wantSent int     // indeks provider yang mengirim, -1 jika semua gagal
+	}{
+		{"provider pertama", []error{nil, nil}, 0},
+		{"pindah ke cadangan", []error{down, nil}, 1},
+		{"cadangan terakhir", []error{down, down, nil}, 2},
+		{"semua gagal", []error{down, down}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &failoverNotifier{}
+			var fakes []*fakeNotifier
+			for i, err := range tt.errs {
+				n := &fakeNotifier{name: string(rune('a' + i)), err: err}
+				fakes = append(fakes, n)
+				f.providers = append(f.providers, n)
+			}
+			err := f.Send("62811", "halo")
+			if (err != nil) != (tt.wantSent < 0) {
+				t.Fatalf("Send err = %v", err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "a: gateway mati; b: gateway mati") {
+				t.Errorf("err = %v, want semua error provider", err)
+			}
+			for i, n := range fakes {
+				if want := i == tt.wantSent; (len(n.sent) == 1) != want {
+					t.Errorf("provider %s mengirim %v", n.name, n.sent)
+				}
+			}
+		})
+	}
+}
+
+func TestNewNotifierFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers string
+		env       map[string]string
+		want      string
+		wantErr   bool
+	}{
+		{"satu provider", "webhook", map[string]string{"WA_WEBHOOK_URL": "http://gw"}, "webhook", false},
+		{"failover", " webhook , cloudapi", map[string]string{"WA_WEBHOOK_URL": "http://gw", "WA_CLOUD_PHONE_NUMBER_ID": "1", "WA_CLOUD_TOKEN": "t"}, "webhook,cloudapi", false},
+		{"konfigurasi kurang dilewati", "cloudapi,webhook", map[string]string{"WA_WEBHOOK_URL": "http://gw"}, "webhook", false},
+		{"bangkit dengan API key", "bangkit", map[string]string{"WA_BANGKIT_API_KEY": "k", "WA_BANGKIT_SENDER": "62811"}, "bangkit", false},
+		{"bangkit tanpa API key dilewati", "bangkit,webhook", map[string]string{"WA_BANGKIT_SENDER": "62811", "WA_WEBHOOK_URL": "http://gw"}, "webhook", false},
+		{"provider tidak dikenal", "sms", nil, "", true},
+		{"tidak ada yang lengkap", "webhook", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"WA_WEBHOOK_URL", "WA_CLOUD_PHONE_NUMBER_ID", "WA_CLOUD_TOKEN", "WA_BANGKIT_API_KEY", "WA_BANGKIT_SENDER"} {
+				t.Setenv(k, tt.env[k])
+			}
+			t.Setenv("WA_PROVIDERS", tt.providers)
+			n, err := newNotifierFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v", err)
+			}
+			if err == nil && n.Name() != tt.want {
+				t.Errorf("provider = %s, want %s", n.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got map[string]string
+	var auth string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+		w.Write([]byte("kuota habis"))
+	}))
+	defer srv.Close()
+
+	n := &webhookNotifier{url: srv.URL, token: "rahasia"}
+	if err := n.Send("62811", "halo"); err != nil {
+		t.Fatal(err)
+	}
+	if got["number"] != "62811" || got["message"] != "halo" || auth != "Bearer rahasia" {
+		t.Errorf("body %v, Authorization %q", got, auth)
+	}
+	status = http.StatusTooManyRequests
+	if err := n.Send("62811", "halo"); err == nil || !strings.Contains(err.Error(), "kuota habis") {
+		t.Errorf("err = %v, want status dan isi respons", err)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Status pesan di outbox.
+const (
+	OutboxMenunggu = "menunggu" // belum terkirim, akan dicoba lagi pada Berikutnya
+	OutboxTerkirim = "terkirim"
+	OutboxGagal    = "gagal" // sudah dicoba OUTBOX_MAX_ATTEMPTS kali; hanya dikirim ulang lewat /outbox/retry
+)
+
+// ErrMessageNotFound dikembalikan outbox jika ID pesan tidak ada.
+var ErrMessageNotFound = errors.New("pesan tidak ditemukan")
+
+// OutboxMessage adalah satu pesan WA atau email yang menunggu atau sudah
+// dikirim worker.
+type OutboxMessage struct {
+	ID         int       `json:"id"`
+	Kanal      string    `json:"kanal"` // KanalWA atau KanalEmail
+	Tujuan     string    `json:"tujuan"`
+	Subjek     string    `json:"subjek,omitempty"`
+	Pesan      string    `json:"pesan"`
+	Status     string    `json:"status"`
+	Percobaan  int       `json:"percobaan"`
+	Berikutnya time.Time `json:"berikutnya"`
+	Error      string    `json:"error,omitempty"`
+	Dibuat     time.Time `json:"dibuat"`
+	Terkirim   time.Time `json:"terkirim"`
+}
+
+// OutboxRepository menyimpan pesan sebelum dikirim supaya tidak hilang saat
+// gateway WA mati atau server restart.
+type OutboxRepository interface {
+	// EnqueueMessage menyimpan pesan baru dan mengisi m.ID.
+	EnqueueMessage(m *OutboxMessage) error
+	// DueMessages mengembalikan pesan menunggu yang jadwalnya sudah lewat.
+	DueMessages(now time.Time, limit int) ([]OutboxMessage, error)
+	UpdateMessage(m *OutboxMessage) error
+	FindMessage(id int) (*OutboxMessage, error)
+	// ListMessages mengembalikan pesan dengan status tertentu, atau semua jika status kosong.
+	ListMessages(status string) ([]OutboxMessage, error)
+}
+
+var outboxRepo OutboxRepository
+
+// newOutboxFromEnv memakai database SQLite jika backend penyimpanan sqlite,
+// selain itu file OUTBOX_PATH (default data/outbox.json).
+func newOutboxFromEnv(storage Storage) OutboxRepository {
+	switch s := storage.(type) {
+	case *sqliteLoanRepository:
+		return s
+	case *mirrorLoanRepository:
+		if db, ok := s.primary.(*sqliteLoanRepository); ok {
+			return db
+		}
+	}
+	return newFileOutbox(getEnv("OUTBOX_PATH", filepath.Join("data", "outbox.json")))
+}
+
+// outboxWake membangunkan worker saat ada pesan baru atau retry.
+var outboxWake = make(chan struct{}, 1)
+
+func wakeOutbox() {
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueWA menyimpan pesan ke outbox; pengiriman dilakukan worker.
+func enqueueWA(no, pesan string) error {
+	return enqueue(&OutboxMessage{Kanal: KanalWA, Tujuan: no, Pesan: pesan})
+}
+
+func enqueueEmail(to, subjek, pesan string) error {
+	return enqueue(&OutboxMessage{Kanal: KanalEmail, Tujuan: to, Subjek: subjek, Pesan: pesan})
+}
+
+func enqueue(m *OutboxMessage) error {
+	now := time.Now().UTC()
+	m.Status, m.Berikutnya, m.Dibuat = OutboxMenunggu, now, now
+	if err := outboxRepo.EnqueueMessage(m); err != nil {
+		return fmt.Errorf("gagal menyimpan pesan ke outbox: %v", err)
+	}
+	wakeOutbox()
+	return nil
+}
+
+// startOutboxWorker mengirim pesan outbox di background. Kegagalan dicoba lagi
+// dengan jeda 30 detik, 1 menit, 2 menit, ... (maksimal 1 jam) sampai
+// OUTBOX_MAX_ATTEMPTS (default 8) kali, lalu pesan berstatus gagal.
+func startOutboxWorker() {
+	maxAttempts, err := strconv.Atoi(getEnv("OUTBOX_MAX_ATTEMPTS", "8"))
+	if err != nil || maxAttempts < 1 {
+		log.Printf("⚠️ OUTBOX_MAX_ATTEMPTS tidak valid, memakai 8")
+		maxAttempts = 8
+	}
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+		for {
+			processOutbox(time.Now().UTC(), maxAttempts)
+			select {
+			case <-ticker.C:
+			case <-outboxWake:
+			}
+		}
+	}()
+}
+
+func processOutbox(now time.Time, maxAttempts int) {
+	msgs, err := outboxRepo.DueMessages(now, 50)
+	if err != nil {
+		log.Println("❌ Outbox: gagal membaca pesan:", err)
+		return
+	}
+	for i := range msgs {
+		m := &msgs[i]
+		m.Percobaan++
+		if err := deliver(m); err != nil {
+			m.Error = err.Error()
+			if m.Percobaan >= maxAttempts {
+				m.Status = OutboxGagal
+				log.Printf("❌ Outbox: pesan %d ke %s gagal setelah %d percobaan: %v", m.ID, m.Tujuan, m.Percobaan, err)
+			} else {
+				m.Berikutnya = time.Now().UTC().Add(outboxBackoff(m.Percobaan))
+				log.Printf("⚠️ Outbox: pesan %d ke %s gagal (percobaan %d), dicoba lagi %s: %v", m.ID, m.Tujuan, m.Percobaan, m.Berikutnya.Local().Format("15:04:05"), err)
+			}
+		} else {
+			m.Status = OutboxTerkirim
+			m.Error = ""
+			m.Terkirim = time.Now().UTC()
+			log.Printf("📲 Outbox: pesan %d terkirim ke %s", m.ID, m.Tujuan)
+		}
+		if err := outboxRepo.UpdateMessage(m); err != nil {
+			log.Printf("❌ Outbox: gagal memperbarui pesan %d: %v", m.ID, err)
+		}
+	}
+}
+
+// deliver mengirim pesan lewat kanalnya. Pesan lama tanpa kanal adalah WA.
+func deliver(m *OutboxMessage) error {
+	if m.Kanal == KanalEmail {
+		if mailer == nil {
+			return errors.New("SMTP belum dikonfigurasi")
+		}
+		return mailer.Send(m.Tujuan, m.Subjek, m.Pesan)
+	}
+	return notifier.Send(m.Tujuan, m.Pesan)
+}
+
+func outboxBackoff(attempt int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+// handleOutbox menampilkan isi outbox: GET /outbox?status=gagal
+func handleOutbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", OutboxMenunggu, OutboxTerkirim, OutboxGagal:
+	default:
+		http.Error(w, "Status harus menunggu, terkirim, atau gagal", http.StatusBadRequest)
+		return
+	}
+	list, err := outboxRepo.ListMessages(status)
+	if err != nil {
+		log.Println("List outbox error:", err)
+		http.Error(w, "Gagal membaca outbox", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []OutboxMessage{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleOutboxRetry menjadwalkan ulang pesan: POST /outbox/retry dengan id=...,
+// atau semua=true untuk semua pesan yang gagal.
+func handleOutboxRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseMultipartForm(10 << 20)
+
+	var msgs []OutboxMessage
+	if r.FormValue("semua") == "true" {
+		list, err := outboxRepo.ListMessages(OutboxGagal)
+		if err != nil {
+			log.Println("List outbox error:", err)
+			http.Error(w, "Gagal membaca outbox", http.StatusInternalServerError)
+			return
+		}
+		msgs = list
+	} else {
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "ID pesan tidak valid", http.StatusBadRequest)
+			return
+		}
+		m, err := outboxRepo.FindMessage(id)
+		if errors.Is(err, ErrMessageNotFound) {
+			http.Error(w, "Pesan tidak ditemukan", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("Find outbox error:", err)
+			http.Error(w, "Gagal membaca outbox", http.StatusInternalServerError)
+			return
+		}
+		if m.Status == OutboxTerkirim {
+			http.Error(w, "Pesan sudah terkirim", http.StatusConflict)
+			return
+		}
+		msgs = []OutboxMessage{*m}
+	}
+
+	for i := range msgs {
+		m := &msgs[i]
+		m.Status = OutboxMenunggu
+		m.Percobaan = 0
+		m.Berikutnya = time.Now().UTC()
+		if err := outboxRepo.UpdateMessage(m); err != nil {
+			log.Println("Update outbox error:", err)
+			http.Error(w, "Gagal menjadwalkan ulang pesan", http.StatusInternalServerError)
+			return
+		}
+	}
+	wakeOutbox()
+	fmt.Fprintf(w, "✅ %d pesan dijadwalkan ulang", len(msgs))
+}
+
+// fileOutbox menyimpan outbox di satu file JSON untuk backend sheets. Pesan
+// terkirim yang lebih lama dari 30 hari dibuang saat file dibaca.
+type fileOutbox struct {
+	path string
+
+	mu     sync.Mutex
+	msgs   []OutboxMessage
+	loaded bool
+}
+
+func newFileOutbox(path string) *fileOutbox {
+	return &fileOutbox{path: path}
+}
+
+func (o *fileOutbox) load() error {
+	if o.loaded {
+		return nil
+	}
+	b, err := os.ReadFile(o.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("gagal membaca %s: %v", o.path, err)
+	}
+	var msgs []OutboxMessage
+	if err == nil {
+		if err := json.Unmarshal(b, &msgs); err != nil {
+			return fmt.Errorf("file outbox %s rusak: %v", o.path, err)
+		}
+	}
+	cutoff := time.Now().AddDate(0, 0, -30)
+	for _, m := range msgs {
+		if m.Status == OutboxTerkirim && m.Terkirim.Before(cutoff) {
+			continue
+		}
+		o.msgs = append(o.msgs, m)
+	}
+	o.loaded = true
+	return nil
+}
+
+func (o *fileOutbox) save() error {
+	b, err := json.MarshalIndent(o.msgs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(o.path, b); err != nil {
+		return fmt.Errorf("gagal menyimpan outbox: %v", err)
+	}
+	return nil
+}
+
+func (o *fileOutbox) EnqueueMessage(m *OutboxMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.load(); err != nil {
+		return err
+	}
+	m.ID = 1
+	for _, existing := range o.msgs {
+		if existing.ID >= m.ID {
+			m.ID = existing.ID + 1
+		}
+	}
+	o.msgs = append(o.msgs, *m)
+	if err := o.save(); err != nil {
+		o.msgs = o.msgs[:len(o.msgs)-1]
+		m.ID = 0
+		return err
+	}
+	return nil
+}
+
+func (o *fileOutbox) DueMessages(now time.Time, limit int) ([]OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	var due []OutboxMessage
+	for _, m := range o.msgs {
+		if m.Status == OutboxMenunggu && !m.Berikutnya.After(now) {
+			due = append(due, m)
+			if len(due) == limit {
+				break
+			}
+		}
+	}
+	return due, nil
+}
+
+func (o *fileOutbox) UpdateMessage(m *OutboxMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.load(); err != nil {
+		return err
+	}
+	for i := range o.msgs {
+		if o.msgs[i].ID == m.ID {
+			old := o.msgs[i]
+			o.msgs[i] = *m
+			if err := o.save(); err != nil {
+				o.msgs[i] = old
+				return err
+			}
+			return nil
+		}
+	}
+	return ErrMessageNotFound
+}
+
+func (o *fileOutbox) FindMessage(id int) (*OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	for _, m := range o.msgs {
+		if m.ID == id {
+			return &m, nil
+		}
+	}
+	return nil, ErrMessageNotFound
+}
+
+func (o *fileOutbox) ListMessages(status string) ([]OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	var list []OutboxMessage
+	for _, m := range o.msgs {
+		if status == "" || m.Status == status {
+			list = append(list, m)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestOutbox memakai outbox repo dan notifier n selama test.
+func useTestOutbox(t *testing.T, repo OutboxRepository, n Notifier) {
+	t.Helper()
+	oldRepo, oldNotifier := outboxRepo, notifier
+	outboxRepo, notifier = repo, n
+	t.Cleanup(func() { outboxRepo, notifier = oldRepo, oldNotifier })
+}
+
+// outboxImpls menjalankan test yang sama untuk outbox file dan SQLite.
+func outboxImpls(t *testing.T) map[string]OutboxRepository {
+	return map[string]OutboxRepository{
+		"file":   newFileOutbox(filepath.Join(t.TempDir(), "outbox.json")),
+		"sqlite": openTestSQLite(t, filepath.Join(t.TempDir(), "peminjaman.db")),
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempt); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestProcessOutbox(t *testing.T) {
+	for name, repo := range outboxImpls(t) {
+		t.Run(name, func(t *testing.T) {
+			gateway := &fakeNotifier{name: "fake", err: errors.New("gateway mati")}
+			useTestOutbox(t, repo, gateway)
+			if err := enqueueWA("62811", "halo"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Percobaan pertama gagal: pesan dijadwalkan lagi 30 detik kemudian.
+			processOutbox(time.Now().UTC(), 2)
+			m, err := repo.FindMessage(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Status != OutboxMenunggu || m.Percobaan != 1 || m.Error != "gateway mati" || time.Until(m.Berikutnya) < 20*time.Second {
+				t.Errorf("setelah gagal = %+v", m)
+			}
+			// Belum jatuh tempo, jadi tidak dicoba.
+			processOutbox(time.Now().UTC(), 2)
+			if m, _ := repo.FindMessage(1); m.Percobaan != 1 {
+				t.Errorf("dicoba sebelum jadwal: percobaan %d", m.Percobaan)
+			}
+			// Percobaan kedua juga gagal dan mencapai batas.
+			processOutbox(time.Now().UTC().Add(time.Minute), 2)
+			if m, _ := repo.FindMessage(1); m.Status != OutboxGagal || m.Percobaan != 2 {
+				t.Errorf("setelah batas percobaan = %+v", m)
+			}
+			if due, _ := repo.DueMessages(time.Now().UTC().Add(time.Hour), 10); len(due) != 0 {
+				t.Errorf("pesan gagal masih dijadwalkan: %+v", due)
+			}
+
+			// /outbox/retry menjadwalkan ulang; kali ini gateway hidup.
+			gateway.err = nil
+			form := url.Values{"id": {"1"}}
+			r := httptest.NewRequest(http.MethodPost, "/outbox/retry", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			handleOutboxRetry(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("retry kode %d %q", w.Code, w.Body.String())
+			}
+			processOutbox(time.Now().UTC(), 2)
+			m, _ = repo.FindMessage(1)
+			if m.Status != OutboxTerkirim || m.Error != "" || m.Terkirim.IsZero() || len(gateway.sent) != 1 {
+				t.Errorf("setelah retry = %+v, terkirim %v", m, gateway.sent)
+			}
+
+			// Pesan yang sudah terkirim tidak bisa dikirim ulang.
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodPost, "/outbox/retry", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			handleOutboxRetry(w, r)
+			if w.Code != http.StatusConflict {
+				t.Errorf("retry pesan terkirim kode %d, want 409", w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleOutbox(t *testing.T) {
+	useTestOutbox(t, newFileOutbox(filepath.Join(t.TempDir(), "outbox.json")), &fakeNotifier{name: "fake"})
+	enqueueWA("62811", "satu")
+	enqueueWA("62812", "dua")
+	processOutbox(time.Now().UTC(), 8)
+	enqueueWA("62813", "tiga")
+
+	tests := []struct {
+		query    string
+		wantCode int
+		wantN    int
+	}{
+		{"", http.StatusOK, 3},
+		{"?status=terkirim", http.StatusOK, 2},
+		{"?status=menunggu", http.StatusOK, 1},
+		{"?status=gagal", http.StatusOK, 0},
+		{"?status=entah", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handleOutbox(w, httptest.NewRequest(http.MethodGet, "/outbox"+tt.query, nil))
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: kode %d, want %d", tt.query, w.Code, tt.wantCode)
+			continue
+		}
+		if tt.wantCode == http.StatusOK && strings.Count(w.Body.String(), `"tujuan"`) != tt.wantN {
+			t.Errorf("%s: %s, want %d pesan", tt.query, w.Body.String(), tt.wantN)
+		}
+	}
+}
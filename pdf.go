@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+)
+
+// Ukuran halaman A4 dalam point.
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+)
+
+// pdfDocument adalah penulis PDF sederhana untuk surat: teks Helvetica
+// (standar PDF, tidak perlu menyematkan font), garis, dan gambar. Koordinat
+// dihitung dari kiri atas halaman supaya mudah dipakai untuk tata letak surat.
+type pdfDocument struct {
+	pages  []*pdfPage
+	images []pdfImage
+}
+
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+type pdfImage struct {
+	width, height int
+	colorSpace    string
+	filter        string
+	data          []byte
+}
+
+func newPDF() *pdfDocument {
+	return &pdfDocument{}
+}
+
+func (d *pdfDocument) addPage() *pdfPage {
+	p := &pdfPage{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// text menulis s dengan baseline di (x, y).
+func (p *pdfPage) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, pdfPageHeight-y, pdfEscape(s))
+}
+
+func (p *pdfPage) line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, pdfPageHeight-y1, x2, pdfPageHeight-y2)
+}
+
+func (p *pdfPage) rect(x, y, w, h, width float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f %.2f %.2f re S\n", width, x, pdfPageHeight-y-h, w, h)
+}
+
+// drawImage menggambar gambar ke-index (dari addImage) di kotak x, y, w, h.
+func (p *pdfPage) drawImage(index int, x, y, w, h float64) {
+	fmt.Fprintf(&p.content, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", w, h, x, pdfPageHeight-y-h, index+1)
+}
+
+// addImage menyimpan gambar PNG, JPEG, atau GIF dan mengembalikan indeksnya
+// untuk drawImage. JPEG RGB/grayscale disalin apa adanya; format lain diubah
+// ke RGB di atas latar putih.
+func (d *pdfDocument) addImage(data []byte) (int, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("format gambar tidak dikenali: %v", err)
+	}
+	img := pdfImage{width: cfg.Width, height: cfg.Height}
+	switch {
+	case format == "jpeg" && cfg.ColorModel == color.GrayModel:
+		img.colorSpace, img.filter, img.data = "DeviceGray", "DCTDecode", data
+	case format == "jpeg" && cfg.ColorModel == color.YCbCrModel:
+		img.colorSpace, img.filter, img.data = "DeviceRGB", "DCTDecode", data
+	default:
+		src, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return 0, fmt.Errorf("gagal membaca gambar: %v", err)
+		}
+		b := src.Bounds()
+		rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Over)
+		raw := make([]byte, 0, b.Dx()*b.Dy()*3)
+		for i := 0; i < len(rgba.Pix); i += 4 {
+			raw = append(raw, rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2])
+		}
+		img.width, img.height = b.Dx(), b.Dy()
+		img.colorSpace, img.filter, img.data = "DeviceRGB", "FlateDecode", deflate(raw)
+	}
+	d.images = append(d.images, img)
+	return len(d.images) - 1, nil
+}
+
+func deflate(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// write menulis dokumen PDF. Objek 1 katalog, 2 daftar halaman, 3 dan 4 font,
+// lalu gambar, lalu setiap halaman dengan isinya.
+func (d *pdfDocument) write(w io.Writer) error {
+	var (
+		buf     bytes.Buffer
+		offsets []int
+	)
+	obj := func(body string, stream []byte) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\n", len(offsets), body)
+		if stream != nil {
+			buf.WriteString("stream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	firstImage := 5
+	firstPage := firstImage + len(d.images)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)), nil)
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>", nil)
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>", nil)
+
+	var xobjects strings.Builder
+	for i, img := range d.images {
+		obj(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /%s /Length %d >>",
+			img.width, img.height, img.colorSpace, img.filter, len(img.data)), img.data)
+		fmt.Fprintf(&xobjects, " /Im%d %d 0 R", i+1, firstImage+i)
+	}
+	for i, p := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> /XObject <<%s >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, xobjects.String(), firstPage+2*i+1), nil)
+		content := deflate(p.content.Bytes())
+		obj(fmt.Sprintf("<< /Filter /FlateDecode /Length %d >>", len(content)), content)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pdfWinAnsi memetakan karakter di luar Latin-1 yang sering muncul di surat ke
+// WinAnsiEncoding. Karakter lain yang tidak ada di encoding ditulis "?".
+var pdfWinAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97,
+}
+
+func pdfEncode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch b, ok := pdfWinAnsi[r]; {
+		case ok:
+			out = append(out, b)
+		case r == '\t':
+			out = append(out, ' ')
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			out = append(out, byte(r))
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, c := range pdfEncode(s) {
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\r', '\n':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Lebar karakter ASCII 32-126 Helvetica dan Helvetica-Bold dalam 1/1000 em,
+// dari metrik standar Adobe. Karakter lain dianggap selebar angka.
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+func pdfTextWidth(s string, size float64, bold bool) float64 {
+	widths := &helveticaWidths
+	if bold {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, c := range pdfEncode(s) {
+		if c >= 32 && c <= 126 {
+			total += widths[c-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// pdfWrap memecah s menjadi baris yang lebarnya tidak lebih dari maxWidth.
+// Baris baru pada s tetap menjadi baris baru.
+func pdfWrap(s string, size float64, bold bool, maxWidth float64) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		words := strings.Fields(para)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		line := words[0]
+		for _, word := range words[1:] {
+			if pdfTextWidth(line+" "+word, size, bold) > maxWidth {
+				lines = append(lines, line)
+				line = word
+				continue
+			}
+			line += " " + word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
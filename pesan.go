@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// ErrTemplateNotFound dikembalikan jika file template pesan tidak ada.
+var ErrTemplateNotFound = errors.New("template pesan tidak ditemukan")
+
+// Nama template pesan. Tiap nama adalah file <nama>.tmpl di PESAN_TEMPLATE_DIR.
+const (
+	PesanPinjamPeminjam       = "pinjam_peminjam"
+	PesanPinjamApprover       = "pinjam_approver"
+	PesanKeputusanPeminjam    = "keputusan_peminjam"
+	PesanKeputusanApprover    = "keputusan_approver"
+	PesanPengembalianPeminjam = "pengembalian_peminjam"
+	PesanPengembalianApprover = "pengembalian_approver"
+	PesanPengingatPeminjam    = "pengingat_peminjam"
+	PesanPengingatApprover    = "pengingat_approver"
+)
+
+var pesanTemplateNames = []string{
+	PesanPinjamPeminjam,
+	PesanPinjamApprover,
+	PesanKeputusanPeminjam,
+	PesanKeputusanApprover,
+	PesanPengembalianPeminjam,
+	PesanPengembalianApprover,
+	PesanPengingatPeminjam,
+	PesanPengingatApprover,
+}
+
+// PesanData adalah variabel yang bisa dipakai template pesan, misalnya
+// {{.Form.Nama}}, {{.Approver}}, atau {{.DokumenURL}}. Field yang tidak
+// relevan untuk sebuah pesan dibiarkan kosong.
+type PesanData struct {
+	Salam    string // "Selamat pagi", "Selamat siang", ...
+	ID       string // ID peminjaman, mis. "0007"
+	Form     FormData
+	Approver string
+	Status   string // keputusan approver
+
+	Alat   string // daftar alat format WA
+	Jumlah int
+	Sisa   string // alat yang belum kembali; kosong jika semua sudah kembali
+
+	TanggalDikembalikan string
+
+	// Pengingat: Hari adalah selisih hari terhadap TanggalKembali, Tahap dan
+	// TahapHari berasal dari reminderStage yang sedang berlaku.
+	Hari      int
+	Tahap     string
+	TahapHari int
+
+	// Rantai persetujuan: tahap yang diminta pada pesan ke approver.
+	Langkah       string
+	LangkahKe     int
+	JumlahLangkah int
+	Mewakili      string // nama approver asli jika pesan dikirim ke wakilnya
+	// Eskalasi bernilai true jika permohonan dikirim karena tahap belum
+	// diputuskan sejak MenungguSejak.
+	Eskalasi      bool
+	MenungguSejak string
+
+	DokumenURL      string
+	SetujuURL       string // link approval bertanda tangan, hanya di pesan ke approver
+	TolakURL        string
+	PengembalianURL string
+}
+
+// newPesanData mengisi variabel umum dari data peminjaman.
+func newPesanData(id int, form FormData) PesanData {
+	return PesanData{
+		Salam:           getSalam(),
+		ID:              formatLoanID(id),
+		Form:            form,
+		Alat:            form.alatWA(),
+		Jumlah:          form.JumlahAlat,
+		PengembalianURL: getEnv("PENGEMBALIAN_LINK", "https://s.id/FormKembaliAlat"),
+	}
+}
+
+// pesanTemplates membaca template dari disk dan mem-parse ulang file yang
+// berubah, sehingga teks pesan bisa diubah tanpa build ulang. Jika file yang
+// diubah tidak valid, versi terakhir yang berhasil tetap dipakai.
+type pesanTemplates struct {
+	dir string
+
+	mu    sync.Mutex
+	cache map[string]cachedTemplate
+}
+
+type cachedTemplate struct {
+	tmpl    *template.Template
+	modTime time.Time
+}
+
+var pesanTmpl *pesanTemplates
+
+// newPesanTemplatesFromEnv memakai folder PESAN_TEMPLATE_DIR (default
+// templates/pesan) dan memastikan semua template bisa di-parse.
+func newPesanTemplatesFromEnv() (*pesanTemplates, error) {
+	t := &pesanTemplates{
+		dir:   getEnv("PESAN_TEMPLATE_DIR", filepath.Join("templates", "pesan")),
+		cache: map[string]cachedTemplate{},
+	}
+	for _, nama := range pesanTemplateNames {
+		if _, err := t.get(nama); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *pesanTemplates) get(nama string) (*template.Template, error) {
+	path := filepath.Join(t.dir, nama+".tmpl")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cached, ok := t.cache[nama]
+	st, err := os.Stat(path)
+	if err != nil {
+		if ok {
+			log.Printf("⚠️ Template pesan %s tidak bisa dibaca (%v), memakai versi sebelumnya", path, err)
+			return cached.tmpl, nil
+		}
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, path)
+		}
+		return nil, err
+	}
+	if ok && st.ModTime().Equal(cached.modTime) {
+		return cached.tmpl, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err == nil {
+		var tmpl *template.Template
+		tmpl, err = template.New(nama).Parse(string(b))
+		if err == nil {
+			t.cache[nama] = cachedTemplate{tmpl: tmpl, modTime: st.ModTime()}
+			if ok {
+				log.Printf("INFO: Template pesan %s dimuat ulang", nama)
+			}
+			return tmpl, nil
+		}
+	}
+	if ok {
+		log.Printf("⚠️ Template pesan %s tidak valid (%v), memakai versi sebelumnya", path, err)
+		return cached.tmpl, nil
+	}
+	return nil, fmt.Errorf("template pesan %s tidak valid: %v", path, err)
+}
+
+// render mengembalikan subjek (blok {{define "subjek"}}, dipakai untuk email)
+// dan isi pesan.
+func (t *pesanTemplates) render(nama string, data PesanData) (subjek, pesan string, err error) {
+	tmpl, err := t.get(nama)
+	if err != nil {
+		return "", "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", "", fmt.Errorf("gagal mengisi template pesan %s: %v", nama, err)
+	}
+	pesan = strings.TrimSpace(b.String())
+	if s := tmpl.Lookup("subjek"); s != nil {
+		b.Reset()
+		if err := s.Execute(&b, data); err != nil {
+			return "", "", fmt.Errorf("gagal mengisi subjek template pesan %s: %v", nama, err)
+		}
+		subjek = strings.TrimSpace(b.String())
+	}
+	return subjek, pesan, nil
+}
+
+// kirimPesan mengisi template lalu mengirimnya lewat kirimNotifikasi.
+func kirimPesan(p Penerima, nama string, data PesanData) error {
+	subjek, pesan, err := pesanTmpl.render(nama, data)
+	if err != nil {
+		return err
+	}
+	return kirimNotifikasi(p, subjek, pesan)
+}
+
+// samplePesanData adalah peminjaman contoh untuk pratinjau template.
+func samplePesanData() PesanData {
+	form := FormData{
+		Nama:                   "Budi Santoso",
+		Kelas:                  "XI TKJ 2",
+		NIS:                    "12345",
+		NoWA:                   "081234567890",
+		Email:                  "budi@example.com",
+		TanggalPinjam:          "2025-07-14",
+		TanggalKembali:         "2025-07-16",
+		KondisiAlat:            "Baik",
+		KeteranganPengembalian: "Lengkap",
+	}
+	form.setItems([]ItemPinjam{{NamaAlat: "Proyektor", Jumlah: 1}, {NamaAlat: "Kabel HDMI", Jumlah: 2}})
+	data := newPesanData(7, form)
+	data.Approver = "Sebastian"
+	data.Status = string(StatusDisetujui)
+	data.Sisa = itemsWA([]ItemPinjam{{NamaAlat: "Kabel HDMI", Jumlah: 1}})
+	data.TanggalDikembalikan = time.Now().Format("02 January 2006")
+	data.Hari, data.Tahap, data.TahapHari = 1, "H+1", 1
+	data.Langkah, data.LangkahKe, data.JumlahLangkah = "Guru Lab", 1, 2
+	data.DokumenURL = "https://drive.google.com/uc?id=contoh"
+	data.SetujuURL = "https://example.com/approval/link?token=contoh-setuju"
+	data.TolakURL = "https://example.com/approval/link?token=contoh-tolak"
+	return data
+}
+
+// PesanPreview adalah hasil GET /pesan/preview.
+type PesanPreview struct {
+	Nama   string `json:"nama"`
+	Subjek string `json:"subjek"`
+	Pesan  string `json:"pesan"`
+}
+
+// handlePesanPreview mengisi template dengan peminjaman contoh:
+// GET /pesan/preview?nama=pinjam_peminjam. Tanpa nama, yang dikembalikan
+// adalah daftar nama template.
+func handlePesanPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	nama := r.URL.Query().Get("nama")
+	if nama == "" {
+		names := append([]string(nil), pesanTemplateNames...)
+		sort.Strings(names)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(names)
+		return
+	}
+	if strings.ContainsAny(nama, `/\.`) {
+		http.Error(w, "Nama template tidak valid", http.StatusBadRequest)
+		return
+	}
+	subjek, pesan, err := pesanTmpl.render(nama, samplePesanData())
+	if errors.Is(err, ErrTemplateNotFound) {
+		http.Error(w, "Template tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PesanPreview{Nama: nama, Subjek: subjek, Pesan: pesan})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestPesanTemplates memakai template di dir selama test.
+func useTestPesanTemplates(t *testing.T, dir string) *pesanTemplates {
+	t.Helper()
+	t.Setenv("PESAN_TEMPLATE_DIR", dir)
+	tmpl, err := newPesanTemplatesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := pesanTmpl
+	pesanTmpl = tmpl
+	t.Cleanup(func() { pesanTmpl = old })
+	return tmpl
+}
+
+func TestPesanTemplatesBawaan(t *testing.T) {
+	tmpl := useTestPesanTemplates(t, filepath.Join("templates", "pesan"))
+	data := samplePesanData()
+	for _, nama := range pesanTemplateNames {
+		t.Run(nama, func(t *testing.T) {
+			subjek, pesan, err := tmpl.render(nama, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subjek == "" || pesan == "" || strings.Contains(pesan, "<no value>") {
+				t.Errorf("subjek %q, pesan:\n%s", subjek, pesan)
+			}
+		})
+	}
+}
+
+func TestPesanTemplatesReload(t *testing.T) {
+	dir := t.TempDir()
+	tulis := func(isi string, mod time.Time) {
+		t.Helper()
+		path := filepath.Join(dir, "pinjam_peminjam.tmpl")
+		if err := os.WriteFile(path, []byte(isi), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mod, mod)
+	}
+	for _, nama := range pesanTemplateNames {
+		os.WriteFile(filepath.Join(dir, nama+".tmpl"), []byte("x"), 0644)
+	}
+	start := time.Now().Add(-time.Hour)
+	tulis(`{{define "subjek"}}Pengajuan {{.ID}}{{end}}Halo {{.Form.Nama}}`, start)
+	tmpl := useTestPesanTemplates(t, dir)
+	data := PesanData{ID: "0007", Form: FormData{Nama: "Budi"}}
+
+	tests := []struct {
+		name       string
+		isi        string // kosong berarti file dihapus
+		mod        time.Duration
+		wantSubjek string
+		wantPesan  string
+	}{
+		{"awal", "", 0, "Pengajuan 0007", "Halo Budi"},
+		{"diubah", `Hai {{.Form.Nama}}!`, time.Minute, "", "Hai Budi!"},
+		{"tidak valid memakai versi terakhir", `Hai {{.Form.Nama`, 2 * time.Minute, "", "Hai Budi!"},
+		{"diperbaiki", `Selamat {{.Form.Nama}}`, 3 * time.Minute, "", "Selamat Budi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.isi != "" {
+				tulis(tt.isi, start.Add(tt.mod))
+			}
+			subjek, pesan, err := tmpl.render(PesanPinjamPeminjam, data)
+			if err != nil || subjek != tt.wantSubjek || pesan != tt.wantPesan {
+				t.Errorf("render = %q, %q, %v, want %q, %q", subjek, pesan, err, tt.wantSubjek, tt.wantPesan)
+			}
+		})
+	}
+
+	os.Remove(filepath.Join(dir, "pinjam_peminjam.tmpl"))
+	if _, pesan, err := tmpl.render(PesanPinjamPeminjam, data); err != nil || pesan != "Selamat Budi" {
+		t.Errorf("setelah file dihapus = %q, %v, want versi terakhir", pesan, err)
+	}
+	if _, _, err := tmpl.render("tidak_ada", data); err == nil {
+		t.Error("render template yang tidak ada tidak error")
+	}
+}
+
+func TestNewPesanTemplatesFromEnvTidakLengkap(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, PesanPinjamPeminjam+".tmpl"), []byte("Halo"), 0644)
+	t.Setenv("PESAN_TEMPLATE_DIR", dir)
+	if _, err := newPesanTemplatesFromEnv(); err == nil {
+		t.Error("template yang kurang tidak membuat error saat start")
+	}
+}
+
+func TestHandlePesanPreview(t *testing.T) {
+	useTestPesanTemplates(t, filepath.Join("templates", "pesan"))
+	tests := []struct {
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{"", http.StatusOK, PesanPengingatApprover},
+		{"?nama=" + PesanKeputusanPeminjam, http.StatusOK, `"subjek"`},
+		{"?nama=../rahasia", http.StatusBadRequest, "tidak valid"},
+		{"?nama=tidak_ada", http.StatusNotFound, "tidak ditemukan"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handlePesanPreview(w, httptest.NewRequest(http.MethodGet, "/pesan/preview"+tt.query, nil))
+		if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("%s: kode %d %q, want %d berisi %q", tt.query, w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handlePesanPreview(w, httptest.NewRequest(http.MethodGet, "/pesan/preview?nama="+PesanPinjamPeminjam, nil))
+	var p PesanPreview
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil || !strings.Contains(p.Pesan, "Budi Santoso") {
+		t.Errorf("preview = %+v, %v", p, err)
+	}
+}
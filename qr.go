@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// qrVersion adalah susunan blok data dan koreksi error satu versi QR code
+// pada level koreksi M (sekitar 15% kerusakan masih terbaca).
+type qrVersion struct {
+	ecc    int    // codeword koreksi per blok
+	blocks [2]int // jumlah blok di grup 1 dan grup 2
+	data   [2]int // codeword data per blok di grup 1 dan grup 2
+	align  []int  // posisi tengah pola alignment
+}
+
+// qrVersions berisi versi 1-20 level M, cukup untuk link sampai 666 byte.
+var qrVersions = []qrVersion{
+	1:  {10, [2]int{1, 0}, [2]int{16, 0}, nil},
+	2:  {16, [2]int{1, 0}, [2]int{28, 0}, []int{6, 18}},
+	3:  {26, [2]int{1, 0}, [2]int{44, 0}, []int{6, 22}},
+	4:  {18, [2]int{2, 0}, [2]int{32, 0}, []int{6, 26}},
+	5:  {24, [2]int{2, 0}, [2]int{43, 0}, []int{6, 30}},
+	6:  {16, [2]int{4, 0}, [2]int{27, 0}, []int{6, 34}},
+	7:  {18, [2]int{4, 0}, [2]int{31, 0}, []int{6, 22, 38}},
+	8:  {22, [2]int{2, 2}, [2]int{38, 39}, []int{6, 24, 42}},
+	9:  {22, [2]int{3, 2}, [2]int{36, 37}, []int{6, 26, 46}},
+	10: {26, [2]int{4, 1}, [2]int{43, 44}, []int{6, 28, 50}},
+	11: {30, [2]int{1, 4}, [2]int{50, 51}, []int{6, 30, 54}},
+	12: {22, [2]int{6, 2}, [2]int{36, 37}, []int{6, 32, 58}},
+	13: {22, [2]int{8, 1}, [2]int{37, 38}, []int{6, 34, 62}},
+	14: {24, [2]int{4, 5}, [2]int{40, 41}, []int{6, 26, 46, 66}},
+	15: {24, [2]int{5, 5}, [2]int{41, 42}, []int{6, 26, 48, 70}},
+	16: {28, [2]int{7, 3}, [2]int{45, 46}, []int{6, 26, 50, 74}},
+	17: {28, [2]int{10, 1}, [2]int{46, 47}, []int{6, 30, 54, 78}},
+	18: {26, [2]int{9, 4}, [2]int{43, 44}, []int{6, 30, 56, 82}},
+	19: {26, [2]int{3, 11}, [2]int{44, 45}, []int{6, 30, 58, 86}},
+	20: {26, [2]int{3, 13}, [2]int{41, 42}, []int{6, 34, 62, 90}},
+}
+
+func (v qrVersion) dataLen() int {
+	return v.blocks[0]*v.data[0] + v.blocks[1]*v.data[1]
+}
+
+// qrCode adalah matriks modul QR code; true berarti modul gelap.
+type qrCode struct {
+	size    int
+	modules [][]bool
+	fixed   [][]bool // modul pola tetap yang tidak boleh terkena mask
+}
+
+// encodeQR membuat QR code mode byte level M dengan versi terkecil yang
+// cukup untuk text.
+func encodeQR(text string) (*qrCode, error) {
+	ver := 0
+	for v := 1; v < len(qrVersions); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(text) <= 8*qrVersions[v].dataLen() {
+			ver = v
+			break
+		}
+	}
+	if ver == 0 {
+		return nil, fmt.Errorf("teks terlalu panjang untuk QR code (%d byte)", len(text))
+	}
+	q := newQRCode(ver)
+	q.placeData(qrCodewords(ver, text))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask)
+	}
+	q.applyMask(best)
+	q.drawFormat(best)
+	return q, nil
+}
+
+// qrCodewords menyusun bit data, membaginya per blok, menambah codeword
+// Reed-Solomon, lalu menyilangkan semua blok.
+func qrCodewords(ver int, text string) []byte {
+	v := qrVersions[ver]
+	var bits qrBits
+	bits.add(0b0100, 4)
+	if ver >= 10 {
+		bits.add(len(text), 16)
+	} else {
+		bits.add(len(text), 8)
+	}
+	for i := 0; i < len(text); i++ {
+		bits.add(int(text[i]), 8)
+	}
+	capacity := v.dataLen() * 8
+	bits.add(0, min(4, capacity-len(bits)))
+	bits.add(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.add(pad, 8)
+	}
+	data := bits.bytes()
+
+	var dataBlocks, eccBlocks [][]byte
+	divisor := qrDivisor(v.ecc)
+	for g := 0; g < 2; g++ {
+		for b := 0; b < v.blocks[g]; b++ {
+			block := data[:v.data[g]]
+			data = data[v.data[g]:]
+			dataBlocks = append(dataBlocks, block)
+			eccBlocks = append(eccBlocks, qrRemainder(block, divisor))
+		}
+	}
+	var out []byte
+	for i := 0; i < max(v.data[0], v.data[1]); i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecc; i++ {
+		for _, block := range eccBlocks {
+			out = append(out, block[i])
+		}
+	}
+	return out
+}
+
+type qrBits []bool
+
+func (b *qrBits) add(val, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, val>>i&1 == 1)
+	}
+}
+
+func (b qrBits) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// qrMul mengalikan dua elemen GF(256) dengan polinom 0x11D.
+func qrMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// qrDivisor adalah polinom generator Reed-Solomon berderajat degree, tanpa
+// koefisien suku tertinggi.
+func qrDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrMul(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrMul(root, 2)
+	}
+	return result
+}
+
+func qrRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= qrMul(d, factor)
+		}
+	}
+	return result
+}
+
+// newQRCode menggambar pola finder, timing, alignment, dan info versi, serta
+// mencadangkan tempat info format.
+func newQRCode(ver int) *qrCode {
+	size := 17 + 4*ver
+	q := &qrCode{size: size, modules: make([][]bool, size), fixed: make([][]bool, size)}
+	for y := range q.modules {
+		q.modules[y] = make([]bool, size)
+		q.fixed[y] = make([]bool, size)
+	}
+	for i := 0; i < size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					d := max(abs(dx), abs(dy))
+					q.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	align := qrVersions[ver].align
+	for i, ax := range align {
+		for j, ay := range align {
+			if i == 0 && j == 0 || i == 0 && j == len(align)-1 || i == len(align)-1 && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(ax+dx, ay+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	q.drawFormat(0)
+	if ver >= 7 {
+		rem := ver
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1F25
+		}
+		bits := ver<<12 | rem
+		for i := 0; i < 18; i++ {
+			a, b := size-11+i%3, i/3
+			q.set(a, b, bits>>i&1 == 1)
+			q.set(b, a, bits>>i&1 == 1)
+		}
+	}
+	return q
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.fixed[y][x] = true
+}
+
+// drawFormat menulis level koreksi M dan nomor mask di kedua salinan info
+// format.
+func (q *qrCode) drawFormat(mask int) {
+	data := 0<<3 | mask // level M = 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// placeData mengisi modul bebas secara zig-zag dua kolom dari kanan bawah.
+func (q *qrCode) placeData(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.fixed[y][x] && i < len(data)*8 {
+					q.modules[y][x] = data[i/8]>>(7-i%8)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask membalik modul data menurut pola mask. Memanggilnya dua kali
+// mengembalikan matriks seperti semula.
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.fixed[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty menilai matriks menurut empat aturan penalti standar QR code; mask
+// dengan nilai terkecil paling mudah dibaca pemindai.
+func (q *qrCode) penalty() int {
+	n := q.size
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return q.modules[x][y]
+		}
+		return q.modules[y][x]
+	}
+	total := 0
+	for _, transpose := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			run := 0
+			for x := 0; x < n; x++ {
+				if x > 0 && at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+				} else {
+					if run >= 5 {
+						total += run - 2
+					}
+					run = 1
+				}
+				// Pola 1:1:3:1:1 dengan 4 modul terang di salah satu sisi.
+				if x+11 <= n {
+					var line [11]bool
+					for k := range line {
+						line[k] = at(x+k, y, transpose)
+					}
+					if line == [11]bool{true, false, true, true, true, false, true, false, false, false, false} ||
+						line == [11]bool{false, false, false, false, true, false, true, true, true, false, true} {
+						total += 40
+					}
+				}
+			}
+			if run >= 5 {
+				total += run - 2
+			}
+		}
+	}
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			c := q.modules[y][x]
+			if c {
+				dark++
+			}
+			if x+1 < n && y+1 < n && c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+				total += 3
+			}
+		}
+	}
+	percent := dark * 100 / (n * n)
+	total += abs(percent-50) / 5 * 10
+	return total
+}
+
+// png menggambar QR code dengan scale piksel per modul dan tepi kosong empat
+// modul.
+func (q *qrCode) png(scale int) ([]byte, error) {
+	const quiet = 4
+	width := (q.size + 2*quiet) * scale
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+quiet)*scale+dx, (y+quiet)*scale+dy, 1)
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// qrFormatM adalah info format level M untuk mask 0-7 dari tabel spesifikasi
+// QR code, setelah di-XOR 0x5412.
+var qrFormatM = []int{
+	0b101010000010010, 0b101000100100101, 0b101111001111100, 0b101101101001011,
+	0b100010111111001, 0b100000011001110, 0b100111110010111, 0b100101010100000,
+}
+
+// qrReadFormat membaca salinan info format di sekitar finder kiri atas.
+func qrReadFormat(q *qrCode) int {
+	var pos [15][2]int
+	for i := 0; i <= 5; i++ {
+		pos[i] = [2]int{8, i}
+	}
+	pos[6], pos[7], pos[8] = [2]int{8, 7}, [2]int{8, 8}, [2]int{7, 8}
+	for i := 9; i < 15; i++ {
+		pos[i] = [2]int{14 - i, 8}
+	}
+	bits := 0
+	for i, p := range pos {
+		if q.modules[p[1]][p[0]] {
+			bits |= 1 << i
+		}
+	}
+	return bits
+}
+
+func qrBit(dark bool) int {
+	if dark {
+		return 1
+	}
+	return 0
+}
+
+// qrDecode membaca ulang teks mode byte dari q tanpa koreksi error: mask
+// dilepas, codeword dibaca zig-zag, lalu blok data disusun kembali.
+func qrDecode(t *testing.T, q *qrCode) string {
+	t.Helper()
+	format := qrReadFormat(q)
+	mask := -1
+	for m, f := range qrFormatM {
+		if f == format {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("info format %015b bukan level M", format)
+	}
+	q.applyMask(mask)
+	defer q.applyMask(mask)
+
+	var raw []byte
+	var cur, n int
+	upward := true
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for k := 0; k < q.size; k++ {
+			y := k
+			if upward {
+				y = q.size - 1 - k
+			}
+			for j := 0; j < 2; j++ {
+				if x := right - j; !q.fixed[y][x] {
+					cur = cur<<1 | qrBit(q.modules[y][x])
+					if n++; n%8 == 0 {
+						raw = append(raw, byte(cur))
+						cur = 0
+					}
+				}
+			}
+		}
+		upward = !upward
+	}
+
+	ver := (q.size - 17) / 4
+	v := qrVersions[ver]
+	var blocks [][]byte
+	for g := 0; g < 2; g++ {
+		for b := 0; b < v.blocks[g]; b++ {
+			blocks = append(blocks, make([]byte, 0, v.data[g]))
+		}
+	}
+	for i := 0; i < max(v.data[0], v.data[1]); i++ {
+		for b := range blocks {
+			if len(blocks[b]) < cap(blocks[b]) {
+				blocks[b] = append(blocks[b], raw[0])
+				raw = raw[1:]
+			}
+		}
+	}
+	var data qrBits
+	for _, b := range blocks {
+		for _, c := range b {
+			data.add(int(c), 8)
+		}
+	}
+	read := func(n int) int {
+		v := 0
+		for _, bit := range data[:n] {
+			v = v<<1 | qrBit(bit)
+		}
+		data = data[n:]
+		return v
+	}
+	if mode := read(4); mode != 0b0100 {
+		t.Fatalf("mode %04b, want byte", mode)
+	}
+	length := read(8)
+	if ver >= 10 {
+		length = length<<8 | read(8)
+	}
+	var text strings.Builder
+	for i := 0; i < length; i++ {
+		text.WriteByte(byte(read(8)))
+	}
+	return text.String()
+}
+
+func TestEncodeQR(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantVer int
+		wantErr bool
+	}{
+		{"satu huruf", "A", 1, false},
+		{"penuh versi 1", strings.Repeat("x", 14), 1, false},
+		{"lewat versi 1", strings.Repeat("x", 15), 2, false},
+		{"link verifikasi", "https://peminjaman.smkn7semarang.sch.id/surat/verifikasi?t=eyJpZCI6NywiaiI6InBlcnNldHVqdWFuIn0.c2lnbmF0dXJl", 7, false},
+		{"panjang hitungan 16 bit", strings.Repeat("ab", 100), 10, false},
+		{"maksimum", strings.Repeat("z", 666), 20, false},
+		{"terlalu panjang", strings.Repeat("z", 667), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := encodeQR(tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("encodeQR harus gagal")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.size != 17+4*tt.wantVer {
+				t.Errorf("ukuran %d, want versi %d (%d)", q.size, tt.wantVer, 17+4*tt.wantVer)
+			}
+			if got := qrDecode(t, q); got != tt.text {
+				t.Errorf("dibaca ulang %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestQRPola(t *testing.T) {
+	q, err := encodeQR("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Finder di tiga sudut: cincin luar gelap, cincin kedua terang, inti gelap.
+	for _, c := range [][2]int{{0, 0}, {q.size - 7, 0}, {0, q.size - 7}} {
+		for y := 0; y < 7; y++ {
+			for x := 0; x < 7; x++ {
+				d := max(abs(x-3), abs(y-3))
+				if want := d != 2; q.modules[c[1]+y][c[0]+x] != want {
+					t.Fatalf("finder (%d,%d) modul (%d,%d) = %v", c[0], c[1], x, y, !want)
+				}
+			}
+		}
+	}
+	for i := 8; i < q.size-8; i++ {
+		if q.modules[6][i] != (i%2 == 0) || q.modules[i][6] != (i%2 == 0) {
+			t.Fatalf("pola timing salah di %d", i)
+		}
+	}
+	if !q.modules[q.size-8][8] {
+		t.Error("modul gelap tidak ada")
+	}
+}
+
+func TestQRRemainder(t *testing.T) {
+	// Contoh versi 1-M dari tutorial Reed-Solomon QR code.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := qrRemainder(data, qrDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("qrRemainder = %v, want %v", got, want)
+	}
+}
+
+func TestQRInfoVersi(t *testing.T) {
+	q := newQRCode(7)
+	bits := 0
+	for i := 0; i < 18; i++ {
+		if q.modules[i/3][q.size-11+i%3] {
+			bits |= 1 << i
+		}
+	}
+	if bits != 0x07C94 {
+		t.Errorf("info versi 7 = %018b, want %018b", bits, 0x07C94)
+	}
+}
+
+func TestQRPNG(t *testing.T) {
+	q, err := encodeQR("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := q.png(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Dx(); size != (21+8)*3 || img.Bounds().Dy() != size {
+		t.Errorf("ukuran PNG %v, want %d", img.Bounds(), (21+8)*3)
+	}
+	gelap := func(x, y int) bool { r, _, _, _ := img.At(x, y).RGBA(); return r == 0 }
+	if gelap(0, 0) || !gelap(4*3, 4*3) || gelap(4*3+3, 4*3+3) {
+		t.Error("tepi kosong atau finder tidak sesuai")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reminder adalah satu pengingat WA yang sudah terkirim. Riwayatnya disimpan
+// agar pengingat yang sama tidak dikirim ulang setelah server restart.
+type Reminder struct {
+	IDPinjam int
+	Jenis    string // lihat reminderStages
+	Tanggal  string
+	Penerima string
+}
+
+// ReminderRepository menyimpan riwayat pengingat di tempat yang sama dengan data peminjaman.
+type ReminderRepository interface {
+	ListReminders() ([]Reminder, error)
+	RecordReminder(r *Reminder) error
+}
+
+var reminderRepo ReminderRepository
+
+// reminderStage adalah satu tahap pengingat, dihitung dari selisih hari
+// terhadap TanggalKembali (negatif = sebelum jatuh tempo).
+type reminderStage struct {
+	Hari     int
+	Jenis    string
+	Approver bool // kirim salinan ke approver
+}
+
+// reminderStages berurutan dari yang paling awal. Setelah jatuh tempo nada
+// pesan makin tegas dan approver ikut diberi tahu.
+var reminderStages = []reminderStage{
+	{Hari: -1, Jenis: "H-1"},
+	{Hari: 0, Jenis: "H"},
+	{Hari: 1, Jenis: "H+1", Approver: true},
+	{Hari: 3, Jenis: "H+3", Approver: true},
+	{Hari: 7, Jenis: "H+7", Approver: true},
+}
+
+// stageFor mengembalikan tahap terakhir yang sudah tercapai pada hari ke-days.
+// Jika server mati saat sebuah tahap, tahap itu dilewati dan yang dikirim
+// langsung tahap berikutnya.
+func stageFor(days int) (reminderStage, bool) {
+	var found reminderStage
+	ok := false
+	for _, st := range reminderStages {
+		if st.Hari <= days {
+			found, ok = st, true
+		}
+	}
+	// H-1 dan H hanya berlaku pada harinya.
+	if ok && found.Hari <= 0 && found.Hari != days {
+		return found, false
+	}
+	return found, ok
+}
+
+// startReminderScheduler menjalankan runReminders saat server menyala lalu
+// setiap hari pada jam REMINDER_JAM (default 07:00, waktu server).
+// REMINDER_ENABLED=false mematikan pengingat.
+func startReminderScheduler() {
+	if getEnv("REMINDER_ENABLED", "true") != "true" {
+		log.Println("INFO: Pengingat pengembalian dimatikan (REMINDER_ENABLED)")
+		return
+	}
+	hour, min, err := parseJam(getEnv("REMINDER_JAM", "07:00"))
+	if err != nil {
+		log.Printf("⚠️ REMINDER_JAM tidak valid (%v), memakai 07:00", err)
+		hour, min = 7, 0
+	}
+	go func() {
+		runReminders(time.Now())
+		for {
+			next := nextRun(time.Now(), hour, min)
+			log.Printf("INFO: Pengingat pengembalian berikutnya: %s", next.Format("2006-01-02 15:04"))
+			time.Sleep(time.Until(next))
+			runReminders(time.Now())
+		}
+	}()
+}
+
+func parseJam(s string) (hour, min int, err error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("format jam harus HH:MM, bukan %q", s)
+	}
+	hour, errH := strconv.Atoi(parts[0])
+	min, errM := strconv.Atoi(parts[1])
+	if errH != nil || errM != nil || hour < 0 || hour > 23 || min < 0 || min > 59 {
+		return 0, 0, fmt.Errorf("format jam harus HH:MM, bukan %q", s)
+	}
+	return hour, min, nil
+}
+
+// nextRun adalah jam hour:min berikutnya setelah now.
+func nextRun(now time.Time, hour, min int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// runReminders memeriksa semua peminjaman yang sudah disetujui dan belum
+// kembali: yang lewat jatuh tempo ditandai Terlambat, lalu pengingat tahap
+// yang sedang berlaku dikirim jika belum pernah.
+func runReminders(now time.Time) {
+	loans, err := loanRepo.ListLoans()
+	if err != nil {
+		log.Println("❌ Pengingat: gagal membaca peminjaman:", err)
+		return
+	}
+	history, err := reminderRepo.ListReminders()
+	if err != nil {
+		log.Println("❌ Pengingat: gagal membaca riwayat pengingat:", err)
+		return
+	}
+	sent := map[string]bool{}
+	for _, r := range history {
+		sent[reminderKey(r.IDPinjam, r.Jenis)] = true
+	}
+
+	day := truncateDay(now)
+	for i := range loans {
+		loan := &loans[i]
+		switch loan.Status {
+		case StatusDisetujui, StatusDipinjam, StatusTerlambat:
+		default:
+			continue
+		}
+		due, err := time.Parse("2006-01-02", loan.Form.TanggalKembali)
+		if err != nil {
+			continue
+		}
+		days := int(day.Sub(due).Hours() / 24)
+		if days >= 1 && loan.Status != StatusTerlambat {
+			markOverdue(loan)
+		}
+
+		stage, ok := stageFor(days)
+		if !ok || sent[reminderKey(loan.ID, stage.Jenis)] {
+			continue
+		}
+		if err := sendReminder(loan, stage, days, now); err != nil {
+			log.Printf("⚠️ Pengingat %s untuk peminjaman %s gagal: %v", stage.Jenis, formatLoanID(loan.ID), err)
+		}
+	}
+}
+
+func reminderKey(id int, jenis string) string {
+	return formatLoanID(id) + "|" + jenis
+}
+
+// markOverdue menandai peminjaman Terlambat. Peminjaman yang masih Disetujui
+// dianggap sudah diambil, sama seperti saat pengembalian.
+func markOverdue(loan *Peminjaman) {
+	if loan.Status == StatusDisetujui {
+		if _, err := transitionLoan(loan.ID, StatusDipinjam, ""); err != nil {
+			log.Printf("⚠️ Gagal menandai peminjaman %s dipinjam: %v", formatLoanID(loan.ID), err)
+			return
+		}
+	}
+	if _, err := transitionLoan(loan.ID, StatusTerlambat, ""); err != nil {
+		log.Printf("⚠️ Gagal menandai peminjaman %s terlambat: %v", formatLoanID(loan.ID), err)
+		return
+	}
+	loan.Status = StatusTerlambat
+}
+
+// sendReminder mengirim pengingat ke peminjam (dan approver jika tahapnya
+// meminta), lalu mencatatnya. Riwayat hanya ditulis jika WA ke peminjam sudah
+// masuk outbox.
+func sendReminder(loan *Peminjaman, stage reminderStage, days int, now time.Time) error {
+	penerima := peminjamPenerima(loan.Form)
+	data := newPesanData(loan.ID, loan.Form)
+	data.Approver = loan.Approver
+	data.Alat = itemsWA(loan.sisa())
+	data.Hari, data.Tahap, data.TahapHari = days, stage.Jenis, stage.Hari
+	if err := kirimPesan(penerima, PesanPengingatPeminjam, data); err != nil {
+		return err
+	}
+	log.Printf("INFO: Pengingat %s peminjaman %s masuk antrean", stage.Jenis, formatLoanID(loan.ID))
+
+	if stage.Approver {
+		if err := kirimPesan(loanApproverPenerima(loan, now), PesanPengingatApprover, data); err != nil {
+			log.Println("⚠️ Gagal kirim salinan pengingat ke approver:", err)
+		}
+	}
+
+	return reminderRepo.RecordReminder(&Reminder{
+		IDPinjam: loan.ID,
+		Jenis:    stage.Jenis,
+		Tanggal:  now.Format("2006-01-02 15:04:05"),
+		Penerima: penerimaTujuan(penerima),
+	})
+}
+
+// penerimaTujuan adalah nomor WA dan/atau email penerima untuk riwayat pengingat.
+func penerimaTujuan(p Penerima) string {
+	tujuan := []string{}
+	if p.pakai(KanalWA) {
+		tujuan = append(tujuan, normalizePhoneNumber(p.NoWA))
+	}
+	if p.pakai(KanalEmail) {
+		tujuan = append(tujuan, p.Email)
+	}
+	return strings.Join(tujuan, ", ")
+}
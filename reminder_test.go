@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStageFor(t *testing.T) {
+	tests := []struct {
+		days   int
+		want   string
+		wantOK bool
+	}{
+		{-2, "", false},
+		{-1, "H-1", true},
+		{0, "H", true},
+		{1, "H+1", true},
+		{2, "H+1", true},
+		{3, "H+3", true},
+		{6, "H+3", true},
+		{30, "H+7", true},
+	}
+	for _, tt := range tests {
+		got, ok := stageFor(tt.days)
+		if ok != tt.wantOK || (ok && got.Jenis != tt.want) {
+			t.Errorf("stageFor(%d) = %s, %v, want %s, %v", tt.days, got.Jenis, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParseJamNextRun(t *testing.T) {
+	tests := []struct {
+		jam     string
+		now     string
+		want    string
+		wantErr bool
+	}{
+		{"07:00", "2026-03-01 06:59", "2026-03-01 07:00", false},
+		{"07:00", "2026-03-01 07:00", "2026-03-02 07:00", false},
+		{" 23:30 ", "2026-03-31 23:45", "2026-04-01 23:30", false},
+		{"24:00", "", "", true},
+		{"7", "", "", true},
+		{"jam:tujuh", "", "", true},
+	}
+	for _, tt := range tests {
+		hour, min, err := parseJam(tt.jam)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseJam(%q) err = %v", tt.jam, err)
+		}
+		if err != nil {
+			continue
+		}
+		now, _ := time.Parse("2006-01-02 15:04", tt.now)
+		if got := nextRun(now, hour, min).Format("2006-01-02 15:04"); got != tt.want {
+			t.Errorf("nextRun(%s, %s) = %s, want %s", tt.now, tt.jam, got, tt.want)
+		}
+	}
+}
+
+func TestRunRemindersOverdue(t *testing.T) {
+	newTestStorage(t)
+	useTestPesanTemplates(t, filepath.Join("templates", "pesan"))
+	outbox := newFileOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+	useTestOutbox(t, outbox, &fakeNotifier{name: "fake"})
+	now := time.Date(2026, 3, 10, 7, 0, 0, 0, time.UTC)
+	// Tanpa nomor WA pengingat tidak bisa dikirim dan tidak dicatat.
+	disetujui := createTestLoan(t, StatusDisetujui, "Kamera", 1, "2026-03-01", "2026-03-08")
+	dipinjam := createTestLoan(t, StatusDipinjam, "Kamera", 1, "2026-03-01", "2026-03-09")
+	jatuhTempo := createTestLoan(t, StatusDipinjam, "Kamera", 1, "2026-03-01", "2026-03-10")
+	diajukan := createTestLoan(t, StatusDiajukan, "Kamera", 1, "2026-03-01", "2026-03-05")
+	kembali := createTestLoan(t, StatusDikembalikan, "Kamera", 1, "2026-03-01", "2026-03-05")
+
+	runReminders(now)
+
+	tests := []struct {
+		loan *Peminjaman
+		want LoanStatus
+	}{
+		{disetujui, StatusTerlambat},
+		{dipinjam, StatusTerlambat},
+		{jatuhTempo, StatusDipinjam},
+		{diajukan, StatusDiajukan},
+		{kembali, StatusDikembalikan},
+	}
+	for _, tt := range tests {
+		if got, _ := loanRepo.FindLoan(tt.loan.ID); got.Status != tt.want {
+			t.Errorf("peminjaman %s berstatus %s, want %s", formatLoanID(tt.loan.ID), got.Status, tt.want)
+		}
+	}
+	if history, _ := reminderRepo.ListReminders(); len(history) != 0 {
+		t.Errorf("riwayat tercatat padahal WA tidak terkirim: %+v", history)
+	}
+
+	// Peminjam dengan nomor WA mendapat pengingat H sekali saja.
+	hariIni := &Peminjaman{Status: StatusDipinjam, Form: FormData{Nama: "Ani", NoWA: "0811", TanggalPinjam: "2026-03-08", TanggalKembali: "2026-03-10"}}
+	hariIni.Form.setItems([]ItemPinjam{{"Tripod", 1}})
+	if err := loanRepo.CreateLoan(hariIni); err != nil {
+		t.Fatal(err)
+	}
+	runReminders(now)
+	runReminders(now.Add(time.Hour))
+	history, _ := reminderRepo.ListReminders()
+	if len(history) != 1 || history[0].IDPinjam != hariIni.ID || history[0].Jenis != "H" || history[0].Penerima != "62811" {
+		t.Errorf("riwayat = %+v, want satu pengingat H", history)
+	}
+	if msgs, _ := outbox.ListMessages(""); len(msgs) != 1 || msgs[0].Tujuan != "62811" || !strings.Contains(msgs[0].Pesan, "Tripod") {
+		t.Errorf("outbox = %+v", msgs)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLoanNotFound dikembalikan repository jika ID peminjaman tidak ada.
+var ErrLoanNotFound = errors.New("id peminjaman tidak ditemukan")
+
+// ErrStatusChanged dikembalikan UpdateStatus jika status tersimpan sudah bukan from.
+var ErrStatusChanged = errors.New("status peminjaman sudah berubah")
+
+// Peminjaman adalah satu data pengajuan pinjam alat beserta dokumen dan status persetujuannya.
+type Peminjaman struct {
+	ID            int
+	TanggalAjuan  string
+	Form          FormData
+	PDFURL        string
+	DocURL        string
+	Status        LoanStatus
+	TanggalStatus string
+	Approver      string
+	// Kembali adalah jumlah tiap alat yang sudah dikembalikan, dari semua
+	// pengembalian sebagian.
+	Kembali []ItemPinjam
+}
+
+// Approval adalah satu keputusan approver atas sebuah peminjaman.
+type Approval struct {
+	ID           int
+	Tanggal      string
+	NamaPeminjam string
+	Approver     string
+	IDPinjam     int
+	Status       string
+	Tahap        string // nama tahap pada rantai persetujuan
+	Username     string // username akun yang memutuskan
+	TTD          string // link tanda tangan approver saat memutuskan
+}
+
+// Pengembalian adalah satu kali pengembalian alat. Satu peminjaman bisa punya
+// beberapa pengembalian jika alat dikembalikan sebagian-sebagian.
+type Pengembalian struct {
+	ID          int
+	IDPinjam    int
+	Nama        string
+	Tanggal     string
+	KondisiAlat string
+	Keterangan  string
+	FotoPath    string
+	PDFURL      string
+	Items       []ItemPinjam // alat yang dikembalikan kali ini
+	Sisa        []ItemPinjam // alat yang belum kembali setelah pengembalian ini
+}
+
+// LoanRepository memisahkan handler dari tempat penyimpanan data peminjaman.
+type LoanRepository interface {
+	// CreateLoan menyimpan peminjaman baru dan mengisi p.ID dengan nomor urut
+	// berikutnya. Data disimpan sebelum surat dibuat supaya nomor tidak terlewat
+	// walaupun pembuatan surat gagal.
+	CreateLoan(p *Peminjaman) error
+	// UpdateLoanDocuments menyimpan link PDF dan dokumen surat peminjaman.
+	UpdateLoanDocuments(id int, pdfURL, docURL string) error
+	FindLoan(id int) (*Peminjaman, error)
+	ListLoans() ([]Peminjaman, error)
+	// UpdateStatus mengganti status from menjadi to beserta tanggalnya. Nama
+	// approver ikut disimpan jika tidak kosong. Jangan dipanggil langsung, pakai
+	// transitionLoan agar perpindahan status diperiksa.
+	UpdateStatus(id int, from, to LoanStatus, approver string) error
+	// RecordApproval menyimpan riwayat keputusan approver dan mengisi a.ID.
+	RecordApproval(a *Approval) error
+	// FindApproval mengembalikan keputusan terakhir untuk sebuah peminjaman, atau nil jika belum ada.
+	FindApproval(idPinjam int) (*Approval, error)
+	// ListApprovals mengembalikan semua keputusan untuk sebuah peminjaman, urut dari yang pertama.
+	ListApprovals(idPinjam int) ([]Approval, error)
+	// ListAllApprovals mengembalikan keputusan semua peminjaman, urut dari yang
+	// pertama, untuk pemeriksaan berkala yang tidak boleh membaca per peminjaman.
+	ListAllApprovals() ([]Approval, error)
+	// RecordReturn menyimpan pengembalian beserta item-nya dan mengisi p.ID.
+	// Jangan dipanggil langsung, pakai recordReturn agar sisa alat diperiksa.
+	RecordReturn(p *Pengembalian) error
+	// UpdateReturnDocuments menyimpan link foto dan PDF surat pengembalian.
+	UpdateReturnDocuments(id int, fotoPath, pdfURL string) error
+}
+
+var loanRepo LoanRepository
+
+// Storage adalah semua repository yang disediakan satu backend penyimpanan.
+type Storage interface {
+	LoanRepository
+	AlatRepository
+	ReminderRepository
+}
+
+// newStorageFromEnv memilih penyimpanan saat server dinyalakan:
+//
+//	STORAGE_BACKEND=sheets (default) atau sqlite
+//	SQLITE_PATH=data/peminjaman.db
+//	SEQUENCE_PATH=data/sequence.json (nomor urut untuk backend sheets)
+//	SHEETS_MIRROR=true untuk tetap menyalin data sqlite ke Google Sheets
+func newStorageFromEnv() (Storage, error) {
+	switch backend := getEnv("STORAGE_BACKEND", "sheets"); backend {
+	case "sheets":
+		return newSheetsLoanRepository(spreadsheetID, sequencePath()), nil
+	case "sqlite":
+		repo, err := openSQLiteLoanRepository(getEnv("SQLITE_PATH", filepath.Join("data", "peminjaman.db")))
+		if err != nil {
+			return nil, err
+		}
+		if os.Getenv("SHEETS_MIRROR") == "true" {
+			return &mirrorLoanRepository{primary: repo, mirror: newSheetsLoanRepository(spreadsheetID, sequencePath())}, nil
+		}
+		return repo, nil
+	default:
+		return nil, fmt.Errorf("STORAGE_BACKEND tidak dikenal: %q", backend)
+	}
+}
+
+func sequencePath() string {
+	return getEnv("SEQUENCE_PATH", filepath.Join("data", "sequence.json"))
+}
+
+func getEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// parseLoanID menerima ID dengan atau tanpa nol di depan ("0007" atau "7").
+func parseLoanID(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("id peminjaman tidak valid: %q", s)
+	}
+	return id, nil
+}
+
+func formatLoanID(id int) string {
+	return fmt.Sprintf("%04d", id)
+}
+
+func lamaPinjam(form FormData) string {
+	return fmt.Sprintf("%d hari", int(parseTanggal(form.TanggalKembali).Sub(parseTanggal(form.TanggalPinjam)).Hours()/24))
+}
+
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
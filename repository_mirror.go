@@ -0,0 +1,117 @@
+package main
+
+import "log"
+
+// mirrorLoanRepository membaca dan menulis ke primary, lalu menyalin setiap
+// penulisan ke mirror. Kegagalan mirror hanya dicatat di log agar backend tetap
+// jalan saat koneksi ke Google terputus.
+type mirrorLoanRepository struct {
+	primary Storage
+	mirror  Storage
+}
+
+func (m *mirrorLoanRepository) CreateLoan(p *Peminjaman) error {
+	if err := m.primary.CreateLoan(p); err != nil {
+		return err
+	}
+	copy := *p
+	m.logMirror("CreateLoan", m.mirror.CreateLoan(&copy))
+	return nil
+}
+
+func (m *mirrorLoanRepository) UpdateLoanDocuments(id int, pdfURL, docURL string) error {
+	if err := m.primary.UpdateLoanDocuments(id, pdfURL, docURL); err != nil {
+		return err
+	}
+	m.logMirror("UpdateLoanDocuments", m.mirror.UpdateLoanDocuments(id, pdfURL, docURL))
+	return nil
+}
+
+func (m *mirrorLoanRepository) FindLoan(id int) (*Peminjaman, error) {
+	return m.primary.FindLoan(id)
+}
+
+func (m *mirrorLoanRepository) ListLoans() ([]Peminjaman, error) {
+	return m.primary.ListLoans()
+}
+
+func (m *mirrorLoanRepository) UpdateStatus(id int, from, to LoanStatus, approver string) error {
+	if err := m.primary.UpdateStatus(id, from, to, approver); err != nil {
+		return err
+	}
+	m.logMirror("UpdateStatus", m.mirror.UpdateStatus(id, from, to, approver))
+	return nil
+}
+
+func (m *mirrorLoanRepository) RecordApproval(a *Approval) error {
+	if err := m.primary.RecordApproval(a); err != nil {
+		return err
+	}
+	copy := *a
+	m.logMirror("RecordApproval", m.mirror.RecordApproval(&copy))
+	return nil
+}
+
+func (m *mirrorLoanRepository) FindApproval(idPinjam int) (*Approval, error) {
+	return m.primary.FindApproval(idPinjam)
+}
+
+func (m *mirrorLoanRepository) ListApprovals(idPinjam int) ([]Approval, error) {
+	return m.primary.ListApprovals(idPinjam)
+}
+
+func (m *mirrorLoanRepository) ListAllApprovals() ([]Approval, error) {
+	return m.primary.ListAllApprovals()
+}
+
+func (m *mirrorLoanRepository) RecordReturn(p *Pengembalian) error {
+	if err := m.primary.RecordReturn(p); err != nil {
+		return err
+	}
+	copy := *p
+	m.logMirror("RecordReturn", m.mirror.RecordReturn(&copy))
+	return nil
+}
+
+func (m *mirrorLoanRepository) UpdateReturnDocuments(id int, fotoPath, pdfURL string) error {
+	if err := m.primary.UpdateReturnDocuments(id, fotoPath, pdfURL); err != nil {
+		return err
+	}
+	m.logMirror("UpdateReturnDocuments", m.mirror.UpdateReturnDocuments(id, fotoPath, pdfURL))
+	return nil
+}
+
+func (m *mirrorLoanRepository) ListReminders() ([]Reminder, error) {
+	return m.primary.ListReminders()
+}
+
+func (m *mirrorLoanRepository) RecordReminder(r *Reminder) error {
+	if err := m.primary.RecordReminder(r); err != nil {
+		return err
+	}
+	m.logMirror("RecordReminder", m.mirror.RecordReminder(r))
+	return nil
+}
+
+func (m *mirrorLoanRepository) ListAlat() ([]Alat, error) {
+	return m.primary.ListAlat()
+}
+
+func (m *mirrorLoanRepository) FindAlat(kodeAtauNama string) (*Alat, error) {
+	return m.primary.FindAlat(kodeAtauNama)
+}
+
+func (m *mirrorLoanRepository) SaveAlat(a *Alat) error {
+	if err := m.primary.SaveAlat(a); err != nil {
+		return err
+	}
+	copy := *a
+	m.logMirror("SaveAlat", m.mirror.SaveAlat(&copy))
+	return nil
+}
+
+func (m *mirrorLoanRepository) logMirror(op string, err error) {
+	if err != nil {
+		log.Printf("⚠️ Gagal menyalin %s ke mirror: %v", op, err)
+	}
+}
@@ -0,0 +1,748 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+)
+
+const spreadsheetID = "1uULs6gLCAeLVeOI-qjdIcb4pRod-mC6g4Cu9TvtIVak"
+
+// sheetTable menjelaskan letak data pada satu tab.
+type sheetTable struct {
+	name     string // nama tab
+	firstRow int    // baris data pertama, di atasnya header
+	idCol    int    // kolom (0 = A) yang berisi nomor unik baris
+}
+
+var (
+	loanTable       = sheetTable{name: "Form Peminjam", firstRow: 5, idCol: 0}
+	approvalTable   = sheetTable{name: "Approval Peminjaman", firstRow: 6, idCol: 0}
+	returnTable     = sheetTable{name: "Form Pengembalian", firstRow: 5, idCol: 6}
+	alatTable       = sheetTable{name: "Data Alat", firstRow: 2, idCol: 0}
+	itemTable       = sheetTable{name: "Item Peminjaman", firstRow: 2, idCol: 0}
+	returnItemTable = sheetTable{name: "Item Pengembalian", firstRow: 2, idCol: 0}
+	reminderTable   = sheetTable{name: "Riwayat Pengingat", firstRow: 2, idCol: 0}
+)
+
+func (t sheetTable) dataRange() string {
+	return fmt.Sprintf("%s!A%d:Z", t.name, t.firstRow)
+}
+
+func (t sheetTable) rowRange(row int) string {
+	return fmt.Sprintf("%s!A%d:Z%d", t.name, row, row)
+}
+
+// sheetsLoanRepository menyimpan data di tab "Form Peminjam", "Item Peminjaman",
+// "Approval Peminjaman", "Form Pengembalian", "Item Pengembalian", "Data Alat",
+// dan "Riwayat Pengingat" pada spreadsheet yang sama.
+//
+// Kolom "Form Peminjam" (mulai baris 5):
+// A ID, B tanggal, C nama, D kelas, E NIS, F no WA, G alat, H jumlah, I tgl pinjam,
+// J tgl kembali, K keterangan, L lama pinjam, M foto, N PDF, O dokumen, Q status,
+// R tanggal status, S approver, T email, U kanal notifikasi. G dan H berisi
+// ringkasan semua item.
+//
+// Kolom "Item Peminjaman" (mulai baris 2): A ID pinjam, B no, C nama alat, D jumlah.
+//
+// Kolom "Approval Peminjaman" (mulai baris 6): A no approval, B tanggal, C nama
+// peminjam, D approver, E ID pinjam, F status, G tahap, H username approver,
+// I tanda tangan.
+//
+// Kolom "Form Pengembalian" (mulai baris 5): A ID pinjam, B nama, C tanggal,
+// D kondisi, E keterangan, F foto, G no pengembalian, H alat dikembalikan,
+// I sisa, J PDF.
+//
+// Kolom "Item Pengembalian" (mulai baris 2): A no pengembalian, B ID pinjam,
+// C nama alat, D jumlah.
+//
+// Kolom "Riwayat Pengingat" (mulai baris 2): A ID pinjam, B jenis, C tanggal,
+// D nomor penerima.
+type sheetsLoanRepository struct {
+	spreadsheetID string
+	ids           IDAllocator
+
+	mu  sync.Mutex
+	srv *sheets.Service
+}
+
+// newSheetsLoanRepository memakai file sequencePath untuk nomor urut sehingga
+// ID tidak lagi dihitung dari jumlah baris di sheet.
+func newSheetsLoanRepository(spreadsheetID, sequencePath string) *sheetsLoanRepository {
+	s := &sheetsLoanRepository{spreadsheetID: spreadsheetID}
+	s.ids = newFileIDAllocator(sequencePath, s.lastID)
+	return s
+}
+
+// service membuat sheets.Service saat pertama kali dipakai agar login Google
+// tidak terjadi ketika server baru dinyalakan.
+func (s *sheetsLoanRepository) service() (*sheets.Service, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv != nil {
+		return s.srv, nil
+	}
+	sheetsService, _, _, err := getServices()
+	if err != nil {
+		return nil, err
+	}
+	s.srv = sheetsService
+	return s.srv, nil
+}
+
+func (s *sheetsLoanRepository) get(readRange string) ([][]interface{}, error) {
+	srv, err := s.service()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := srv.Spreadsheets.Values.Get(s.spreadsheetID, readRange).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca %s: %v", readRange, err)
+	}
+	if resp == nil {
+		return nil, nil
+	}
+	return resp.Values, nil
+}
+
+func (s *sheetsLoanRepository) update(writeRange string, values []interface{}) error {
+	srv, err := s.service()
+	if err != nil {
+		return err
+	}
+	vr := &sheets.ValueRange{Values: [][]interface{}{values}}
+	_, err = srv.Spreadsheets.Values.Update(s.spreadsheetID, writeRange, vr).ValueInputOption("USER_ENTERED").Do()
+	if err != nil {
+		return fmt.Errorf("gagal menulis %s: %v", writeRange, err)
+	}
+	return nil
+}
+
+// appendRow menambah satu baris di bawah data yang ada lewat Values.Append
+// (INSERT_ROWS), jadi baris kosong atau baris yang disisipkan manual tidak
+// membuat data saling menimpa. Baris yang benar-benar ditulis dibaca ulang untuk
+// memastikan nomornya sesuai.
+//
+// Jika retry true, penulisan sebelumnya mungkin sudah sampai ke Sheets walaupun
+// API mengembalikan error, jadi baris dicari dulu supaya tidak tertulis dua kali.
+func (s *sheetsLoanRepository) appendRow(t sheetTable, values []interface{}, retry bool) error {
+	return s.appendRows(t, [][]interface{}{values}, retry)
+}
+
+// appendRows seperti appendRow untuk beberapa baris dengan nomor yang sama
+// (misalnya item satu peminjaman), ditulis dalam satu permintaan.
+func (s *sheetsLoanRepository) appendRows(t sheetTable, values [][]interface{}, retry bool) error {
+	key := cell(values[0], t.idCol)
+	if key == "" {
+		return fmt.Errorf("baris %s tanpa nomor", t.name)
+	}
+	if retry {
+		if row, _, err := s.findRow(t, key); err == nil {
+			log.Printf("INFO: %s %s ternyata sudah tertulis di baris %d", t.name, key, row)
+			return nil
+		}
+	}
+
+	srv, err := s.service()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNotWritten, err)
+	}
+	vr := &sheets.ValueRange{Values: values}
+	resp, err := srv.Spreadsheets.Values.Append(s.spreadsheetID, t.dataRange(), vr).
+		ValueInputOption("USER_ENTERED").
+		InsertDataOption("INSERT_ROWS").
+		Do()
+	if err != nil {
+		if rejected(err) {
+			return fmt.Errorf("gagal menambah baris %s: %w: %v", t.name, errNotWritten, err)
+		}
+		return fmt.Errorf("gagal menambah baris %s: %v", t.name, err)
+	}
+	if resp.Updates == nil {
+		return fmt.Errorf("respons append %s tidak berisi range yang ditulis", t.name)
+	}
+	row, err := rowFromRange(resp.Updates.UpdatedRange)
+	if err != nil {
+		return err
+	}
+
+	last := row + len(values) - 1
+	written, err := s.get(fmt.Sprintf("%s!A%d:Z%d", t.name, row, last))
+	if err != nil {
+		return err
+	}
+	if len(written) < len(values) {
+		return fmt.Errorf("baris %d-%d di %s tidak lengkap setelah ditulis", row, last, t.name)
+	}
+	for i, w := range written[:len(values)] {
+		if got := cell(w, t.idCol); !sameKey(got, cell(values[i], t.idCol)) {
+			return fmt.Errorf("baris %d di %s berisi nomor %q, seharusnya %s", row+i, t.name, got, key)
+		}
+	}
+	log.Printf("INFO: %s %s tertulis di baris %d", t.name, key, row)
+	return nil
+}
+
+// rowFromRange mengambil nomor baris dari range A1 seperti "'Form Peminjam'!A12:S12".
+func rowFromRange(a1 string) (int, error) {
+	ref := a1[strings.LastIndex(a1, "!")+1:]
+	if i := strings.Index(ref, ":"); i >= 0 {
+		ref = ref[:i]
+	}
+	row, err := strconv.Atoi(strings.TrimLeft(ref, "ABCDEFGHIJKLMNOPQRSTUVWXYZ$"))
+	if err != nil {
+		return 0, fmt.Errorf("range %q tidak valid", a1)
+	}
+	return row, nil
+}
+
+var (
+	// errNotWritten menandai penulisan yang pasti tidak sampai ke sheet:
+	// service tidak bisa dibuat atau permintaannya ditolak Sheets.
+	errNotWritten = errors.New("baris tidak tertulis")
+	// errMaybeWritten menandai penulisan gagal yang bisa saja tetap sampai ke
+	// sheet belakangan, misalnya Append yang timeout tetapi sudah diproses.
+	errMaybeWritten = errors.New("baris mungkin tetap tertulis")
+)
+
+// rejected melaporkan apakah Sheets menolak permintaan sebelum menjalankannya
+// (kode 4xx selain 408). Timeout, error jaringan, dan 5xx tidak pasti.
+func rejected(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code >= 400 && gerr.Code < 500 && gerr.Code != http.StatusRequestTimeout
+}
+
+// writeRetryDelay adalah jeda sebelum percobaan ulang pertama; jeda berikutnya
+// bertambah kelipatannya.
+var writeRetryDelay = time.Second
+
+// writeWithRetry mengulang penulisan baris yang nomornya sudah dialokasikan
+// supaya gangguan sesaat tidak membuat nomornya perlu dilepas. Jika ada
+// percobaan yang gagal tanpa kepastian tidak tertulis, error-nya membungkus
+// errMaybeWritten.
+func (s *sheetsLoanRepository) writeWithRetry(what string, write func(retry bool) error) error {
+	var err error
+	pasti := true
+	for attempt := 1; attempt <= 3; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * writeRetryDelay)
+		}
+		if err = write(attempt > 1); err == nil {
+			return nil
+		}
+		pasti = pasti && errors.Is(err, errNotWritten)
+		log.Printf("⚠️ Gagal menulis %s (percobaan %d): %v", what, attempt, err)
+	}
+	if !pasti {
+		return fmt.Errorf("%w: %v", errMaybeWritten, err)
+	}
+	return err
+}
+
+// releaseID mengembalikan nomor id urutan seq ke IDAllocator setelah datanya
+// gagal ditulis, supaya nomor itu dipakai data berikutnya dan tidak terlewat.
+// Jika err membungkus errMaybeWritten, nomor tetap dianggap terpakai karena
+// penulisan yang tiba belakangan akan membuat nomornya ganda.
+func (s *sheetsLoanRepository) releaseID(seq string, id int, err error) {
+	key := formatLoanID(id)
+	if errors.Is(err, errMaybeWritten) {
+		log.Printf("⚠️ Nomor %s %s tidak dilepas karena datanya mungkin tetap tertulis", seq, key)
+		return
+	}
+	if err := s.ids.Release(seq, id); err != nil {
+		log.Printf("❌ Gagal melepas nomor %s %s: %v", seq, key, err)
+		return
+	}
+	log.Printf("INFO: Nomor %s %s dilepas karena gagal ditulis ke sheet", seq, key)
+}
+
+// appendWithItems menulis baris utama row ke t lalu baris item-nya ke itemT.
+// Jika item gagal ditulis, baris utama dikosongkan lagi supaya tidak ada data
+// yang tersimpan tanpa item-nya.
+func (s *sheetsLoanRepository) appendWithItems(what string, t sheetTable, row []interface{}, itemT sheetTable, items [][]interface{}) error {
+	err := s.writeWithRetry(what, func(retry bool) error {
+		return s.appendRow(t, row, retry)
+	})
+	if err != nil || len(items) == 0 {
+		return err
+	}
+	err = s.writeWithRetry("item "+what, func(retry bool) error {
+		return s.appendRows(itemT, items, retry)
+	})
+	if err == nil {
+		return nil
+	}
+	if cerr := s.clearRow(t, cell(row, t.idCol)); cerr != nil {
+		log.Printf("❌ %s tersimpan tanpa item dan gagal dibatalkan: %v", what, cerr)
+		return fmt.Errorf("%w: %v", errMaybeWritten, err)
+	}
+	log.Printf("INFO: %s dibatalkan karena item-nya gagal ditulis", what)
+	return err
+}
+
+// clearRow mengosongkan baris bernomor key di t.
+func (s *sheetsLoanRepository) clearRow(t sheetTable, key string) error {
+	row, _, err := s.findRow(t, key)
+	if err != nil {
+		return err
+	}
+	srv, err := s.service()
+	if err != nil {
+		return err
+	}
+	_, err = srv.Spreadsheets.Values.Clear(s.spreadsheetID, t.rowRange(row), &sheets.ClearValuesRequest{}).Do()
+	if err != nil {
+		return fmt.Errorf("gagal mengosongkan %s: %v", t.rowRange(row), err)
+	}
+	return nil
+}
+
+// lastID adalah seed IDAllocator: nomor terbesar yang sudah ada di sheet.
+func (s *sheetsLoanRepository) lastID(seq string) (int, error) {
+	switch seq {
+	case seqPeminjaman:
+		return s.maxID(loanTable)
+	case seqApproval:
+		return s.maxID(approvalTable)
+	case seqPengembalian:
+		return s.maxID(returnTable)
+	}
+	return 0, fmt.Errorf("urutan tidak dikenal: %s", seq)
+}
+
+func (s *sheetsLoanRepository) maxID(t sheetTable) (int, error) {
+	rows, err := s.get(t.dataRange())
+	if err != nil {
+		return 0, err
+	}
+	max := 0
+	for _, row := range rows {
+		if id, err := parseLoanID(cell(row, t.idCol)); err == nil && id > max {
+			max = id
+		}
+	}
+	// Baris pengembalian lama belum punya nomor sendiri.
+	if t.idCol != 0 && len(rows) > max {
+		max = len(rows)
+	}
+	return max, nil
+}
+
+// sameKey membandingkan isi kolom nomor. Sheets bisa mengubah "0007" menjadi 7
+// karena USER_ENTERED, jadi nomor dibandingkan sebagai angka jika memungkinkan.
+func sameKey(a, b string) bool {
+	ia, errA := parseLoanID(a)
+	ib, errB := parseLoanID(b)
+	if errA == nil && errB == nil {
+		return ia == ib
+	}
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// findRow mengembalikan nomor baris sheet dan isinya untuk nomor key.
+func (s *sheetsLoanRepository) findRow(t sheetTable, key string) (int, []interface{}, error) {
+	rows, err := s.get(t.dataRange())
+	if err != nil {
+		return 0, nil, err
+	}
+	for i, row := range rows {
+		if sameKey(cell(row, t.idCol), key) {
+			return i + t.firstRow, row, nil
+		}
+	}
+	return 0, nil, errRowNotFound
+}
+
+var errRowNotFound = errors.New("baris tidak ditemukan")
+
+func (s *sheetsLoanRepository) findLoanRow(id int) (int, []interface{}, error) {
+	row, values, err := s.findRow(loanTable, formatLoanID(id))
+	if errors.Is(err, errRowNotFound) {
+		return 0, nil, ErrLoanNotFound
+	}
+	return row, values, err
+}
+
+func (s *sheetsLoanRepository) CreateLoan(p *Peminjaman) error {
+	// ID yang sudah terisi dipertahankan, misalnya saat sheet dipakai sebagai mirror.
+	allocated := p.ID == 0
+	if allocated {
+		id, err := s.ids.Next(seqPeminjaman)
+		if err != nil {
+			return err
+		}
+		p.ID = id
+	}
+	if p.TanggalAjuan == "" {
+		p.TanggalAjuan = today()
+	}
+	if p.Status == "" {
+		p.Status = StatusDiajukan
+	}
+
+	err := s.appendWithItems("peminjaman "+formatLoanID(p.ID), loanTable, loanRow(p), itemTable, itemRows(p))
+	if err != nil && allocated {
+		s.releaseID(seqPeminjaman, p.ID, err)
+		p.ID = 0
+	}
+	return err
+}
+
+// loadItems membaca tab "Item Peminjaman" dikelompokkan per ID pinjam. Jika tab
+// belum ada, peminjaman dibaca dari ringkasan kolom G/H saja.
+func (s *sheetsLoanRepository) loadItems() map[int][]ItemPinjam {
+	rows, err := s.get(itemTable.dataRange())
+	if err != nil {
+		log.Println("⚠️ Gagal membaca item peminjaman:", err)
+		return nil
+	}
+	items := map[int][]ItemPinjam{}
+	for _, row := range rows {
+		id, err := parseLoanID(cell(row, 0))
+		if err != nil {
+			continue
+		}
+		jumlah, _ := strconv.Atoi(cell(row, 3))
+		items[id] = append(items[id], ItemPinjam{NamaAlat: cell(row, 2), Jumlah: jumlah})
+	}
+	return items
+}
+
+// loadReturned menjumlahkan tab "Item Pengembalian" per ID pinjam. Pengembalian
+// lama tanpa item selalu mengembalikan semua alat, jadi tidak perlu dihitung.
+func (s *sheetsLoanRepository) loadReturned() map[int][]ItemPinjam {
+	rows, err := s.get(returnItemTable.dataRange())
+	if err != nil {
+		log.Println("⚠️ Gagal membaca item pengembalian:", err)
+		return nil
+	}
+	returned := map[int][]ItemPinjam{}
+	for _, row := range rows {
+		id, err := parseLoanID(cell(row, 1))
+		if err != nil {
+			continue
+		}
+		jumlah, _ := strconv.Atoi(cell(row, 3))
+		returned[id] = addItems(returned[id], []ItemPinjam{{NamaAlat: cell(row, 2), Jumlah: jumlah}})
+	}
+	return returned
+}
+
+func (s *sheetsLoanRepository) UpdateLoanDocuments(id int, pdfURL, docURL string) error {
+	row, _, err := s.findLoanRow(id)
+	if err != nil {
+		return err
+	}
+	return s.update(fmt.Sprintf("Form Peminjam!N%d:O%d", row, row), []interface{}{pdfURL, docURL})
+}
+
+func (s *sheetsLoanRepository) FindLoan(id int) (*Peminjaman, error) {
+	_, row, err := s.findLoanRow(id)
+	if err != nil {
+		return nil, err
+	}
+	p := loanFromRow(row)
+	p.Form.Items = s.loadItems()[id]
+	p.Kembali = s.loadReturned()[id]
+	return p, nil
+}
+
+func (s *sheetsLoanRepository) ListLoans() ([]Peminjaman, error) {
+	rows, err := s.get(loanTable.dataRange())
+	if err != nil {
+		return nil, err
+	}
+	items := s.loadItems()
+	returned := s.loadReturned()
+	var loans []Peminjaman
+	for _, row := range rows {
+		if _, err := parseLoanID(cell(row, 0)); err != nil {
+			continue
+		}
+		p := loanFromRow(row)
+		p.Form.Items = items[p.ID]
+		p.Kembali = returned[p.ID]
+		loans = append(loans, *p)
+	}
+	return loans, nil
+}
+
+func (s *sheetsLoanRepository) UpdateStatus(id int, from, to LoanStatus, approver string) error {
+	row, values, err := s.findLoanRow(id)
+	if err != nil {
+		return err
+	}
+	if loanStatusFromStorage(cell(values, 16)) != from {
+		return ErrStatusChanged
+	}
+	now := time.Now().Format("2006-01-02 15:04:05")
+	if approver == "" {
+		return s.update(fmt.Sprintf("Form Peminjam!Q%d:R%d", row, row), []interface{}{string(to), now})
+	}
+	return s.update(fmt.Sprintf("Form Peminjam!Q%d:S%d", row, row), []interface{}{string(to), now, approver})
+}
+
+func (s *sheetsLoanRepository) RecordApproval(a *Approval) error {
+	allocated := a.ID == 0
+	if allocated {
+		id, err := s.ids.Next(seqApproval)
+		if err != nil {
+			return err
+		}
+		a.ID = id
+	}
+	if a.Tanggal == "" {
+		a.Tanggal = today()
+	}
+	values := []interface{}{
+		formatLoanID(a.ID),
+		a.Tanggal,
+		a.NamaPeminjam,
+		a.Approver,
+		formatLoanID(a.IDPinjam),
+		a.Status,
+		a.Tahap,
+		a.Username,
+		a.TTD,
+	}
+
+	err := s.writeWithRetry("approval "+formatLoanID(a.ID), func(retry bool) error {
+		return s.appendRow(approvalTable, values, retry)
+	})
+	if err != nil && allocated {
+		s.releaseID(seqApproval, a.ID, err)
+		a.ID = 0
+	}
+	return err
+}
+
+func (s *sheetsLoanRepository) FindApproval(idPinjam int) (*Approval, error) {
+	list, err := s.ListApprovals(idPinjam)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return &list[len(list)-1], nil
+}
+
+func (s *sheetsLoanRepository) ListApprovals(idPinjam int) ([]Approval, error) {
+	all, err := s.ListAllApprovals()
+	if err != nil {
+		return nil, err
+	}
+	var list []Approval
+	for _, a := range all {
+		if a.IDPinjam == idPinjam {
+			list = append(list, a)
+		}
+	}
+	return list, nil
+}
+
+func (s *sheetsLoanRepository) ListAllApprovals() ([]Approval, error) {
+	rows, err := s.get(approvalTable.dataRange())
+	if err != nil {
+		return nil, err
+	}
+	var list []Approval
+	for _, row := range rows {
+		idPinjam, err := parseLoanID(cell(row, 4))
+		if err != nil {
+			continue
+		}
+		id, _ := parseLoanID(cell(row, 0))
+		list = append(list, Approval{
+			ID:           id,
+			Tanggal:      cell(row, 1),
+			NamaPeminjam: cell(row, 2),
+			Approver:     cell(row, 3),
+			IDPinjam:     idPinjam,
+			Status:       cell(row, 5),
+			Tahap:        cell(row, 6),
+			Username:     cell(row, 7),
+			TTD:          cell(row, 8),
+		})
+	}
+	return list, nil
+}
+
+func (s *sheetsLoanRepository) RecordReturn(p *Pengembalian) error {
+	allocated := p.ID == 0
+	if allocated {
+		id, err := s.ids.Next(seqPengembalian)
+		if err != nil {
+			return err
+		}
+		p.ID = id
+	}
+	if p.Tanggal == "" {
+		p.Tanggal = today()
+	}
+	values := []interface{}{
+		formatLoanID(p.IDPinjam), // Kolom A: ID PEMINJAM
+		p.Nama,                   // Kolom B: NAMA
+		p.Tanggal,                // Kolom C: TANGGAL PENGEMBALIAN
+		p.KondisiAlat,            // Kolom D: KONDISI ALAT
+		p.Keterangan,             // Kolom E: KETERANGAN
+		p.FotoPath,               // Kolom F: UP FOTO PENGEMBALIAN
+		formatLoanID(p.ID),       // Kolom G: NO PENGEMBALIAN
+		itemSummary(p.Items),     // Kolom H: ALAT DIKEMBALIKAN
+		itemSummary(p.Sisa),      // Kolom I: SISA
+		p.PDFURL,                 // Kolom J: PDF
+	}
+
+	items := make([][]interface{}, len(p.Items))
+	for i, it := range p.Items {
+		items[i] = []interface{}{formatLoanID(p.ID), formatLoanID(p.IDPinjam), it.NamaAlat, it.Jumlah}
+	}
+	err := s.appendWithItems("pengembalian "+formatLoanID(p.ID), returnTable, values, returnItemTable, items)
+	if err != nil && allocated {
+		s.releaseID(seqPengembalian, p.ID, err)
+		p.ID = 0
+	}
+	return err
+}
+
+func (s *sheetsLoanRepository) UpdateReturnDocuments(id int, fotoPath, pdfURL string) error {
+	row, _, err := s.findRow(returnTable, formatLoanID(id))
+	if err != nil {
+		return fmt.Errorf("pengembalian %s: %v", formatLoanID(id), err)
+	}
+	if err := s.update(fmt.Sprintf("%s!F%d", returnTable.name, row), []interface{}{fotoPath}); err != nil {
+		return err
+	}
+	return s.update(fmt.Sprintf("%s!J%d", returnTable.name, row), []interface{}{pdfURL})
+}
+
+func (s *sheetsLoanRepository) ListAlat() ([]Alat, error) {
+	rows, err := s.get(alatTable.dataRange())
+	if err != nil {
+		return nil, err
+	}
+	var list []Alat
+	for _, row := range rows {
+		if cell(row, 0) == "" {
+			continue
+		}
+		list = append(list, alatFromRow(row))
+	}
+	return list, nil
+}
+
+func (s *sheetsLoanRepository) FindAlat(kodeAtauNama string) (*Alat, error) {
+	list, err := s.ListAlat()
+	if err != nil {
+		return nil, err
+	}
+	return findAlatIn(list, kodeAtauNama)
+}
+
+// SaveAlat memperbarui baris dengan kode yang sama, atau menambah baris baru di
+// tab "Data Alat" (A kode, B nama, C jumlah, D lokasi, E kondisi, F kategori).
+func (s *sheetsLoanRepository) SaveAlat(a *Alat) error {
+	values := []interface{}{a.Kode, a.Nama, a.Jumlah, a.Lokasi, a.Kondisi, a.Kategori}
+	row, _, err := s.findRow(alatTable, a.Kode)
+	if errors.Is(err, errRowNotFound) {
+		return s.appendRow(alatTable, values, false)
+	}
+	if err != nil {
+		return err
+	}
+	return s.update(fmt.Sprintf("%s!A%d:F%d", alatTable.name, row, row), values)
+}
+
+func (s *sheetsLoanRepository) ListReminders() ([]Reminder, error) {
+	rows, err := s.get(reminderTable.dataRange())
+	if err != nil {
+		return nil, err
+	}
+	var list []Reminder
+	for _, row := range rows {
+		id, err := parseLoanID(cell(row, 0))
+		if err != nil {
+			continue
+		}
+		list = append(list, Reminder{IDPinjam: id, Jenis: cell(row, 1), Tanggal: cell(row, 2), Penerima: cell(row, 3)})
+	}
+	return list, nil
+}
+
+// RecordReminder tidak memakai retry appendRow karena satu ID pinjam punya
+// beberapa baris pengingat.
+func (s *sheetsLoanRepository) RecordReminder(r *Reminder) error {
+	return s.appendRow(reminderTable, []interface{}{formatLoanID(r.IDPinjam), r.Jenis, r.Tanggal, r.Penerima}, false)
+}
+
+func alatFromRow(row []interface{}) Alat {
+	jumlah, _ := strconv.Atoi(cell(row, 2))
+	return Alat{
+		Kode:     cell(row, 0),
+		Nama:     cell(row, 1),
+		Jumlah:   jumlah,
+		Lokasi:   cell(row, 3),
+		Kondisi:  cell(row, 4),
+		Kategori: cell(row, 5),
+	}
+}
+
+func loanRow(p *Peminjaman) []interface{} {
+	f := p.Form
+	return []interface{}{
+		formatLoanID(p.ID), p.TanggalAjuan, f.Nama, f.Kelas, f.NIS,
+		f.NoWA, f.NamaAlat, f.JumlahAlat, f.TanggalPinjam, f.TanggalKembali,
+		f.Keterangan, lamaPinjam(f), f.FotoPath, p.PDFURL, p.DocURL, "",
+		string(p.Status), p.TanggalStatus, p.Approver, f.Email, f.Kanal,
+	}
+}
+
+func itemRows(p *Peminjaman) [][]interface{} {
+	rows := make([][]interface{}, len(p.Form.Items))
+	for i, it := range p.Form.Items {
+		rows[i] = []interface{}{formatLoanID(p.ID), i + 1, it.NamaAlat, it.Jumlah}
+	}
+	return rows
+}
+
+func loanFromRow(row []interface{}) *Peminjaman {
+	id, _ := parseLoanID(cell(row, 0))
+	jumlah, _ := strconv.Atoi(cell(row, 7))
+	return &Peminjaman{
+		ID:           id,
+		TanggalAjuan: cell(row, 1),
+		Form: FormData{
+			Nama:               cell(row, 2),
+			Kelas:              cell(row, 3),
+			NIS:                cell(row, 4),
+			NoWA:               cell(row, 5),
+			NamaAlat:           cell(row, 6),
+			JumlahAlat:         jumlah,
+			TanggalPinjam:      cell(row, 8),
+			TanggalKembali:     cell(row, 9),
+			Keterangan:         cell(row, 10),
+			KeteranganPinjam:   cell(row, 10),
+			PeminjamanFotoPath: cell(row, 12),
+			Email:              cell(row, 19),
+			Kanal:              cell(row, 20),
+		},
+		PDFURL:        cell(row, 13),
+		DocURL:        cell(row, 14),
+		Status:        loanStatusFromStorage(cell(row, 16)),
+		TanggalStatus: cell(row, 17),
+		Approver:      cell(row, 18),
+	}
+}
+
+// cell membaca satu sel sebagai string; sel kosong di ujung baris tidak dikirim oleh Sheets API.
+func cell(row []interface{}, i int) string {
+	if i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprintf("%v", row[i]))
+}
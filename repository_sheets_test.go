@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+func TestRowFromRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"'Form Peminjam'!A12:S12", 12, false},
+		{"Approval Peminjaman!A6:Z6", 6, false},
+		{"'Data Alat'!$A$7", 7, false},
+		{"B103", 103, false},
+		{"'Form Peminjam'!AA5:AB5", 5, false},
+		{"'Form Peminjam'!A:S", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := rowFromRange(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("rowFromRange(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
+
+// fakeSheets meniru Values.Get, Values.Append dan Values.Clear dengan tab yang
+// disimpan di memori. Append ke tab yang ada di tolak dijawab dengan kode
+// status yang dicatat di sana.
+type fakeSheets struct {
+	mu    sync.Mutex
+	tabs  map[string][][]interface{} // baris sheet mulai dari baris 1
+	tolak map[string]int
+}
+
+func newFakeSheetsRepo(t *testing.T) (*sheetsLoanRepository, *fakeSheets) {
+	t.Helper()
+	old := writeRetryDelay
+	writeRetryDelay = 0
+	t.Cleanup(func() { writeRetryDelay = old })
+
+	f := &fakeSheets{tabs: map[string][][]interface{}{}, tolak: map[string]int{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	svc, err := sheets.NewService(context.Background(), option.WithEndpoint(srv.URL+"/"), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newSheetsLoanRepository("test", filepath.Join(t.TempDir(), "nomor.json"))
+	repo.srv = svc
+	return repo, f
+}
+
+func (f *fakeSheets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rng := strings.TrimPrefix(r.URL.Path, "/v4/spreadsheets/test/values/")
+	action := ""
+	for _, a := range []string{"append", "clear"} {
+		if trimmed, ok := strings.CutSuffix(rng, ":"+a); ok {
+			rng, action = trimmed, a
+		}
+	}
+	tab, ref, _ := strings.Cut(rng, "!")
+	from, _ := rowFromRange(ref)
+	to := 0
+	if _, end, ok := strings.Cut(ref, ":"); ok {
+		to, _ = rowFromRange(end)
+	}
+	rows := f.tabs[tab]
+
+	switch action {
+	case "append":
+		if code := f.tolak[tab]; code != 0 {
+			http.Error(w, `{"error":{"code":`+strconv.Itoa(code)+`,"message":"ditolak"}}`, code)
+			return
+		}
+		var vr sheets.ValueRange
+		json.NewDecoder(r.Body).Decode(&vr)
+		for len(rows) < from-1 {
+			rows = append(rows, nil)
+		}
+		first := len(rows) + 1
+		f.tabs[tab] = append(rows, vr.Values...)
+		json.NewEncoder(w).Encode(map[string]any{"updates": map[string]any{
+			"updatedRange": fmt.Sprintf("'%s'!A%d:Z%d", tab, first, first+len(vr.Values)-1),
+		}})
+	case "clear":
+		if from <= len(rows) {
+			rows[from-1] = nil
+		}
+		w.Write([]byte("{}"))
+	default:
+		var values [][]interface{}
+		for i := from; i <= len(rows) && (to == 0 || i <= to); i++ {
+			values = append(values, rows[i-1])
+		}
+		json.NewEncoder(w).Encode(map[string]any{"values": values})
+	}
+}
+
+// ids mengembalikan isi kolom nomor semua baris data t yang tidak kosong.
+func (f *fakeSheets) ids(t sheetTable) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for i, row := range f.tabs[t.name] {
+		if i+1 >= t.firstRow && cell(row, t.idCol) != "" {
+			ids = append(ids, cell(row, t.idCol))
+		}
+	}
+	return ids
+}
+
+func TestSheetsCreateLoanItemGagal(t *testing.T) {
+	newLoan := func() *Peminjaman {
+		p := &Peminjaman{Form: FormData{Nama: "Budi"}}
+		p.Form.setItems([]ItemPinjam{{"Kamera", 1}, {"Tripod", 2}})
+		return p
+	}
+	tests := []struct {
+		name      string
+		tab       string
+		code      int
+		wantNext  int // ID peminjaman berikutnya setelah yang gagal
+		wantLoans []string
+	}{
+		// Item ditolak: baris peminjaman dibatalkan dan nomornya dipakai lagi.
+		{"item ditolak", itemTable.name, http.StatusBadRequest, 2, []string{"0001", "0002"}},
+		// Item mungkin tiba belakangan: baris peminjaman dibatalkan tetapi
+		// nomornya tidak dibagikan lagi.
+		{"item error server", itemTable.name, http.StatusInternalServerError, 3, []string{"0001", "0003"}},
+		{"peminjaman ditolak", loanTable.name, http.StatusBadRequest, 2, []string{"0001", "0002"}},
+		{"peminjaman error server", loanTable.name, http.StatusInternalServerError, 3, []string{"0001", "0003"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, f := newFakeSheetsRepo(t)
+			if err := repo.CreateLoan(newLoan()); err != nil {
+				t.Fatal(err)
+			}
+
+			f.tolak[tt.tab] = tt.code
+			p := newLoan()
+			if err := repo.CreateLoan(p); err == nil || p.ID != 0 {
+				t.Fatalf("CreateLoan = ID %d, %v; want error", p.ID, err)
+			}
+			delete(f.tolak, tt.tab)
+
+			p = newLoan()
+			if err := repo.CreateLoan(p); err != nil || p.ID != tt.wantNext {
+				t.Fatalf("CreateLoan berikutnya = ID %d, %v; want %d", p.ID, err, tt.wantNext)
+			}
+			if got := f.ids(loanTable); !slices.Equal(got, tt.wantLoans) {
+				t.Errorf("baris peminjaman = %v, want %v", got, tt.wantLoans)
+			}
+			got, err := repo.FindLoan(p.ID)
+			if err != nil || len(got.Form.Items) != 2 {
+				t.Errorf("FindLoan(%d) = %+v, %v", p.ID, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,821 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations dijalankan berurutan; versi = index + 1. Jangan ubah migrasi
+// yang sudah dirilis, tambahkan migrasi baru di akhir.
+var sqliteMigrations = []string{
+	`CREATE TABLE peminjaman (
+		id              INTEGER PRIMARY KEY,
+		tanggal_ajuan   TEXT NOT NULL,
+		nama            TEXT NOT NULL DEFAULT '',
+		kelas           TEXT NOT NULL DEFAULT '',
+		nis             TEXT NOT NULL DEFAULT '',
+		no_wa           TEXT NOT NULL DEFAULT '',
+		nama_alat       TEXT NOT NULL DEFAULT '',
+		jumlah_alat     INTEGER NOT NULL DEFAULT 0,
+		tanggal_pinjam  TEXT NOT NULL DEFAULT '',
+		tanggal_kembali TEXT NOT NULL DEFAULT '',
+		keterangan      TEXT NOT NULL DEFAULT '',
+		foto_path       TEXT NOT NULL DEFAULT '',
+		pdf_url         TEXT NOT NULL DEFAULT '',
+		doc_url         TEXT NOT NULL DEFAULT '',
+		status          TEXT NOT NULL DEFAULT '',
+		tanggal_status  TEXT NOT NULL DEFAULT '',
+		approver        TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE approval (
+		id            INTEGER PRIMARY KEY,
+		tanggal       TEXT NOT NULL,
+		nama_peminjam TEXT NOT NULL DEFAULT '',
+		approver      TEXT NOT NULL DEFAULT '',
+		id_pinjam     INTEGER NOT NULL REFERENCES peminjaman(id),
+		status        TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX approval_id_pinjam ON approval(id_pinjam);
+	CREATE TABLE pengembalian (
+		id           INTEGER PRIMARY KEY,
+		id_pinjam    INTEGER NOT NULL REFERENCES peminjaman(id),
+		nama         TEXT NOT NULL DEFAULT '',
+		tanggal      TEXT NOT NULL,
+		kondisi_alat TEXT NOT NULL DEFAULT '',
+		keterangan   TEXT NOT NULL DEFAULT '',
+		foto_path    TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX pengembalian_id_pinjam ON pengembalian(id_pinjam);`,
+	`CREATE TABLE sequence (
+		name  TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	);
+	INSERT INTO sequence (name, value) SELECT 'peminjaman', COALESCE(MAX(id), 0) FROM peminjaman;
+	INSERT INTO sequence (name, value) SELECT 'approval', COALESCE(MAX(id), 0) FROM approval;
+	INSERT INTO sequence (name, value) SELECT 'pengembalian', COALESCE(MAX(id), 0) FROM pengembalian;`,
+	`CREATE TABLE alat (
+		kode    TEXT PRIMARY KEY COLLATE NOCASE,
+		nama    TEXT NOT NULL,
+		jumlah  INTEGER NOT NULL DEFAULT 0,
+		lokasi  TEXT NOT NULL DEFAULT '',
+		kondisi TEXT NOT NULL DEFAULT ''
+	);`,
+	`CREATE TABLE peminjaman_item (
+		id_pinjam INTEGER NOT NULL REFERENCES peminjaman(id),
+		no        INTEGER NOT NULL,
+		nama_alat TEXT NOT NULL,
+		jumlah    INTEGER NOT NULL,
+		PRIMARY KEY (id_pinjam, no)
+	);`,
+	`ALTER TABLE pengembalian ADD COLUMN pdf_url TEXT NOT NULL DEFAULT '';
+	CREATE TABLE pengembalian_item (
+		id_kembali INTEGER NOT NULL REFERENCES pengembalian(id),
+		no         INTEGER NOT NULL,
+		id_pinjam  INTEGER NOT NULL REFERENCES peminjaman(id),
+		nama_alat  TEXT NOT NULL,
+		jumlah     INTEGER NOT NULL,
+		PRIMARY KEY (id_kembali, no)
+	);
+	CREATE INDEX pengembalian_item_id_pinjam ON pengembalian_item(id_pinjam);`,
+	`CREATE TABLE reminder (
+		id_pinjam INTEGER NOT NULL REFERENCES peminjaman(id),
+		jenis     TEXT NOT NULL,
+		tanggal   TEXT NOT NULL,
+		penerima  TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (id_pinjam, jenis)
+	);`,
+	`CREATE TABLE outbox (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		tujuan     TEXT NOT NULL,
+		pesan      TEXT NOT NULL,
+		status     TEXT NOT NULL,
+		percobaan  INTEGER NOT NULL DEFAULT 0,
+		berikutnya TEXT NOT NULL,
+		error      TEXT NOT NULL DEFAULT '',
+		dibuat     TEXT NOT NULL,
+		terkirim   TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX outbox_status_berikutnya ON outbox(status, berikutnya);`,
+	`ALTER TABLE outbox ADD COLUMN kanal TEXT NOT NULL DEFAULT 'wa';
+	ALTER TABLE outbox ADD COLUMN subjek TEXT NOT NULL DEFAULT '';
+	ALTER TABLE peminjaman ADD COLUMN email TEXT NOT NULL DEFAULT '';
+	ALTER TABLE peminjaman ADD COLUMN kanal TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE pengguna (
+		username      TEXT PRIMARY KEY COLLATE NOCASE,
+		nama          TEXT NOT NULL,
+		role          TEXT NOT NULL,
+		no_wa         TEXT NOT NULL DEFAULT '',
+		email         TEXT NOT NULL DEFAULT '',
+		aktif         INTEGER NOT NULL DEFAULT 1,
+		password_hash TEXT NOT NULL
+	);`,
+	`ALTER TABLE alat ADD COLUMN kategori TEXT NOT NULL DEFAULT '';
+	ALTER TABLE approval ADD COLUMN tahap TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE delegasi (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		dari        TEXT NOT NULL COLLATE NOCASE,
+		kepada      TEXT NOT NULL COLLATE NOCASE,
+		mulai       TEXT NOT NULL,
+		selesai     TEXT NOT NULL,
+		alasan      TEXT NOT NULL DEFAULT '',
+		dibuat_oleh TEXT NOT NULL DEFAULT '',
+		dibuat      TEXT NOT NULL,
+		dibatalkan  INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE job (
+		id          TEXT PRIMARY KEY,
+		jenis       TEXT NOT NULL,
+		status      TEXT NOT NULL,
+		error       TEXT NOT NULL DEFAULT '',
+		peringatan  TEXT NOT NULL DEFAULT '',
+		id_pinjam   INTEGER NOT NULL DEFAULT 0,
+		dokumen_url TEXT NOT NULL DEFAULT '',
+		dibuat      TEXT NOT NULL,
+		diperbarui  TEXT NOT NULL
+	);
+	CREATE INDEX job_status ON job(status);`,
+	`ALTER TABLE pengguna ADD COLUMN ttd TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE approval ADD COLUMN username TEXT NOT NULL DEFAULT '';
+	ALTER TABLE approval ADD COLUMN ttd TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE pengguna ADD COLUMN kanal TEXT NOT NULL DEFAULT '';`,
+}
+
+// sqliteLoanRepository menyimpan data peminjaman di file SQLite lokal sehingga
+// backend bisa berjalan tanpa koneksi ke Google.
+type sqliteLoanRepository struct {
+	db *sql.DB
+}
+
+func openSQLiteLoanRepository(path string) (*sqliteLoanRepository, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		os.MkdirAll(dir, 0700)
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("gagal membuka database %s: %v", path, err)
+	}
+	// SQLite hanya mengizinkan satu penulis; satu koneksi menghindari SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteLoanRepository{db: db}, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL)`); err != nil {
+		return fmt.Errorf("gagal membuat tabel schema_migrations: %v", err)
+	}
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("gagal membaca versi skema: %v", err)
+	}
+	for i := current; i < len(sqliteMigrations); i++ {
+		version := i + 1
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrasi %d gagal: %v", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, version, time.Now().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrasi %d gagal dicatat: %v", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migrasi %d gagal: %v", version, err)
+		}
+		log.Printf("✅ Migrasi database versi %d diterapkan", version)
+	}
+	return nil
+}
+
+func (s *sqliteLoanRepository) Close() error {
+	return s.db.Close()
+}
+
+func nextSequence(tx *sql.Tx, seq string) (int, error) {
+	var id int
+	err := tx.QueryRow(`UPDATE sequence SET value = value + 1 WHERE name = ? RETURNING value`, seq).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("urutan tidak dikenal: %s", seq)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("gagal mengambil nomor urut %s: %v", seq, err)
+	}
+	return id, nil
+}
+
+// insertWithSequence menjalankan insert di satu transaksi dengan nomor urut baru
+// bila *id masih 0. Nomor dari luar (misalnya dari primary repository) dipakai
+// apa adanya dan urutan dinaikkan agar tidak pernah dibagikan ulang.
+func (s *sqliteLoanRepository) insertWithSequence(seq string, id *int, insert func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	allocated := *id == 0
+	if allocated {
+		if *id, err = nextSequence(tx, seq); err != nil {
+			tx.Rollback()
+			return err
+		}
+	} else if _, err := tx.Exec(`UPDATE sequence SET value = MAX(value, ?) WHERE name = ?`, *id, seq); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = insert(tx); err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil && allocated {
+		// Transaksi batal sehingga nomor belum terpakai.
+		*id = 0
+	}
+	return err
+}
+
+func (s *sqliteLoanRepository) CreateLoan(p *Peminjaman) error {
+	if p.TanggalAjuan == "" {
+		p.TanggalAjuan = today()
+	}
+	if p.Status == "" {
+		p.Status = StatusDiajukan
+	}
+	f := p.Form
+	err := s.insertWithSequence(seqPeminjaman, &p.ID, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO peminjaman (id, tanggal_ajuan, nama, kelas, nis, no_wa, nama_alat,
+			jumlah_alat, tanggal_pinjam, tanggal_kembali, keterangan, foto_path, pdf_url, doc_url, status,
+			tanggal_status, approver, email, kanal) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.ID, p.TanggalAjuan, f.Nama, f.Kelas, f.NIS, f.NoWA, f.NamaAlat, f.JumlahAlat,
+			f.TanggalPinjam, f.TanggalKembali, f.Keterangan, f.FotoPath, p.PDFURL, p.DocURL, string(p.Status),
+			p.TanggalStatus, p.Approver, f.Email, f.Kanal)
+		if err != nil {
+			return err
+		}
+		for i, it := range f.Items {
+			if _, err := tx.Exec(`INSERT INTO peminjaman_item (id_pinjam, no, nama_alat, jumlah) VALUES (?, ?, ?, ?)`,
+				p.ID, i+1, it.NamaAlat, it.Jumlah); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("gagal menyimpan peminjaman: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteLoanRepository) UpdateLoanDocuments(id int, pdfURL, docURL string) error {
+	return s.updateLoan(id, `UPDATE peminjaman SET pdf_url = ?, doc_url = ? WHERE id = ?`, pdfURL, docURL, id)
+}
+
+func (s *sqliteLoanRepository) UpdateStatus(id int, from, to LoanStatus, approver string) error {
+	res, err := s.db.Exec(`UPDATE peminjaman SET status = ?, tanggal_status = ?,
+		approver = CASE WHEN ? = '' THEN approver ELSE ? END
+		WHERE id = ? AND status = ?`,
+		string(to), time.Now().Format("2006-01-02 15:04:05"), approver, approver, id, string(from))
+	if err != nil {
+		return fmt.Errorf("gagal memperbarui status peminjaman %s: %v", formatLoanID(id), err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := s.FindLoan(id); err != nil {
+			return err
+		}
+		return ErrStatusChanged
+	}
+	return nil
+}
+
+func (s *sqliteLoanRepository) updateLoan(id int, query string, args ...interface{}) error {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("gagal memperbarui peminjaman %s: %v", formatLoanID(id), err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLoanNotFound
+	}
+	return nil
+}
+
+const sqliteLoanColumns = `id, tanggal_ajuan, nama, kelas, nis, no_wa, nama_alat, jumlah_alat, tanggal_pinjam,
+	tanggal_kembali, keterangan, foto_path, pdf_url, doc_url, status, tanggal_status, approver, email, kanal`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLoan(row rowScanner) (*Peminjaman, error) {
+	var p Peminjaman
+	f := &p.Form
+	err := row.Scan(&p.ID, &p.TanggalAjuan, &f.Nama, &f.Kelas, &f.NIS, &f.NoWA, &f.NamaAlat, &f.JumlahAlat,
+		&f.TanggalPinjam, &f.TanggalKembali, &f.Keterangan, &f.PeminjamanFotoPath, &p.PDFURL, &p.DocURL,
+		&p.Status, &p.TanggalStatus, &p.Approver, &f.Email, &f.Kanal)
+	if err != nil {
+		return nil, err
+	}
+	f.KeteranganPinjam = f.Keterangan
+	return &p, nil
+}
+
+func (s *sqliteLoanRepository) FindLoan(id int) (*Peminjaman, error) {
+	p, err := scanLoan(s.db.QueryRow(`SELECT `+sqliteLoanColumns+` FROM peminjaman WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrLoanNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca peminjaman %s: %v", formatLoanID(id), err)
+	}
+	items, err := s.loadItems(`WHERE id_pinjam = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	returned, err := s.loadReturned(`WHERE id_pinjam = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	p.Form.Items = items[id]
+	p.Kembali = returned[id]
+	return p, nil
+}
+
+// loadItems membaca peminjaman_item dikelompokkan per ID pinjam.
+func (s *sqliteLoanRepository) loadItems(where string, args ...interface{}) (map[int][]ItemPinjam, error) {
+	rows, err := s.db.Query(`SELECT id_pinjam, nama_alat, jumlah FROM peminjaman_item `+where+` ORDER BY id_pinjam, no`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca item peminjaman: %v", err)
+	}
+	defer rows.Close()
+	items := map[int][]ItemPinjam{}
+	for rows.Next() {
+		var id int
+		var it ItemPinjam
+		if err := rows.Scan(&id, &it.NamaAlat, &it.Jumlah); err != nil {
+			return nil, err
+		}
+		items[id] = append(items[id], it)
+	}
+	return items, rows.Err()
+}
+
+// loadReturned menjumlahkan pengembalian_item per ID pinjam dan nama alat.
+func (s *sqliteLoanRepository) loadReturned(where string, args ...interface{}) (map[int][]ItemPinjam, error) {
+	rows, err := s.db.Query(`SELECT id_pinjam, nama_alat, SUM(jumlah) FROM pengembalian_item `+where+`
+		GROUP BY id_pinjam, nama_alat COLLATE NOCASE ORDER BY id_pinjam, MIN(id_kembali), MIN(no)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca item pengembalian: %v", err)
+	}
+	defer rows.Close()
+	returned := map[int][]ItemPinjam{}
+	for rows.Next() {
+		var id int
+		var it ItemPinjam
+		if err := rows.Scan(&id, &it.NamaAlat, &it.Jumlah); err != nil {
+			return nil, err
+		}
+		returned[id] = append(returned[id], it)
+	}
+	return returned, rows.Err()
+}
+
+func (s *sqliteLoanRepository) ListLoans() ([]Peminjaman, error) {
+	rows, err := s.db.Query(`SELECT ` + sqliteLoanColumns + ` FROM peminjaman ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca daftar peminjaman: %v", err)
+	}
+	defer rows.Close()
+	var loans []Peminjaman
+	for rows.Next() {
+		p, err := scanLoan(rows)
+		if err != nil {
+			return nil, err
+		}
+		loans = append(loans, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	items, err := s.loadItems("")
+	if err != nil {
+		return nil, err
+	}
+	returned, err := s.loadReturned("")
+	if err != nil {
+		return nil, err
+	}
+	for i := range loans {
+		loans[i].Form.Items = items[loans[i].ID]
+		loans[i].Kembali = returned[loans[i].ID]
+	}
+	return loans, nil
+}
+
+func (s *sqliteLoanRepository) RecordApproval(a *Approval) error {
+	if a.Tanggal == "" {
+		a.Tanggal = today()
+	}
+	err := s.insertWithSequence(seqApproval, &a.ID, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO approval (id, tanggal, nama_peminjam, approver, id_pinjam, status, tahap, username, ttd)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, a.ID, a.Tanggal, a.NamaPeminjam, a.Approver, a.IDPinjam, a.Status, a.Tahap, a.Username, a.TTD)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("gagal menyimpan approval: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteLoanRepository) FindApproval(idPinjam int) (*Approval, error) {
+	var a Approval
+	err := s.db.QueryRow(`SELECT id, tanggal, nama_peminjam, approver, id_pinjam, status, tahap, username, ttd FROM approval
+		WHERE id_pinjam = ? ORDER BY id DESC LIMIT 1`, idPinjam).
+		Scan(&a.ID, &a.Tanggal, &a.NamaPeminjam, &a.Approver, &a.IDPinjam, &a.Status, &a.Tahap, &a.Username, &a.TTD)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca approval: %v", err)
+	}
+	return &a, nil
+}
+
+func (s *sqliteLoanRepository) ListApprovals(idPinjam int) ([]Approval, error) {
+	return s.queryApprovals(`WHERE id_pinjam = ? ORDER BY id`, idPinjam)
+}
+
+func (s *sqliteLoanRepository) ListAllApprovals() ([]Approval, error) {
+	return s.queryApprovals(`ORDER BY id`)
+}
+
+func (s *sqliteLoanRepository) queryApprovals(where string, args ...interface{}) ([]Approval, error) {
+	rows, err := s.db.Query(`SELECT id, tanggal, nama_peminjam, approver, id_pinjam, status, tahap, username, ttd FROM approval `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca approval: %v", err)
+	}
+	defer rows.Close()
+	var list []Approval
+	for rows.Next() {
+		var a Approval
+		if err := rows.Scan(&a.ID, &a.Tanggal, &a.NamaPeminjam, &a.Approver, &a.IDPinjam, &a.Status, &a.Tahap, &a.Username, &a.TTD); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqliteLoanRepository) RecordReturn(p *Pengembalian) error {
+	if p.Tanggal == "" {
+		p.Tanggal = today()
+	}
+	err := s.insertWithSequence(seqPengembalian, &p.ID, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO pengembalian (id, id_pinjam, nama, tanggal, kondisi_alat, keterangan,
+			foto_path, pdf_url) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.ID, p.IDPinjam, p.Nama, p.Tanggal, p.KondisiAlat, p.Keterangan, p.FotoPath, p.PDFURL)
+		if err != nil {
+			return err
+		}
+		for i, it := range p.Items {
+			if _, err := tx.Exec(`INSERT INTO pengembalian_item (id_kembali, no, id_pinjam, nama_alat, jumlah)
+				VALUES (?, ?, ?, ?, ?)`, p.ID, i+1, p.IDPinjam, it.NamaAlat, it.Jumlah); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("gagal menyimpan pengembalian: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteLoanRepository) UpdateReturnDocuments(id int, fotoPath, pdfURL string) error {
+	res, err := s.db.Exec(`UPDATE pengembalian SET foto_path = ?, pdf_url = ? WHERE id = ?`, fotoPath, pdfURL, id)
+	if err != nil {
+		return fmt.Errorf("gagal memperbarui pengembalian %s: %v", formatLoanID(id), err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("pengembalian %s tidak ditemukan", formatLoanID(id))
+	}
+	return nil
+}
+
+func (s *sqliteLoanRepository) ListAlat() ([]Alat, error) {
+	rows, err := s.db.Query(`SELECT kode, nama, jumlah, lokasi, kondisi, kategori FROM alat ORDER BY kode`)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca katalog alat: %v", err)
+	}
+	defer rows.Close()
+	var list []Alat
+	for rows.Next() {
+		var a Alat
+		if err := rows.Scan(&a.Kode, &a.Nama, &a.Jumlah, &a.Lokasi, &a.Kondisi, &a.Kategori); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqliteLoanRepository) FindAlat(kodeAtauNama string) (*Alat, error) {
+	list, err := s.ListAlat()
+	if err != nil {
+		return nil, err
+	}
+	return findAlatIn(list, kodeAtauNama)
+}
+
+func (s *sqliteLoanRepository) SaveAlat(a *Alat) error {
+	_, err := s.db.Exec(`INSERT INTO alat (kode, nama, jumlah, lokasi, kondisi, kategori) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(kode) DO UPDATE SET nama = excluded.nama, jumlah = excluded.jumlah,
+		lokasi = excluded.lokasi, kondisi = excluded.kondisi, kategori = excluded.kategori`,
+		a.Kode, a.Nama, a.Jumlah, a.Lokasi, a.Kondisi, a.Kategori)
+	if err != nil {
+		return fmt.Errorf("gagal menyimpan alat %s: %v", a.Kode, err)
+	}
+	return nil
+}
+
+func (s *sqliteLoanRepository) ListReminders() ([]Reminder, error) {
+	rows, err := s.db.Query(`SELECT id_pinjam, jenis, tanggal, penerima FROM reminder ORDER BY tanggal`)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca riwayat pengingat: %v", err)
+	}
+	defer rows.Close()
+	var list []Reminder
+	for rows.Next() {
+		var r Reminder
+		if err := rows.Scan(&r.IDPinjam, &r.Jenis, &r.Tanggal, &r.Penerima); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// RecordReminder mengabaikan pengingat yang sudah tercatat.
+func (s *sqliteLoanRepository) RecordReminder(r *Reminder) error {
+	_, err := s.db.Exec(`INSERT INTO reminder (id_pinjam, jenis, tanggal, penerima) VALUES (?, ?, ?, ?)
+		ON CONFLICT(id_pinjam, jenis) DO NOTHING`, r.IDPinjam, r.Jenis, r.Tanggal, r.Penerima)
+	if err != nil {
+		return fmt.Errorf("gagal menyimpan riwayat pengingat: %v", err)
+	}
+	return nil
+}
+
+// Waktu outbox disimpan sebagai RFC3339 UTC supaya bisa dibandingkan sebagai teks.
+func sqliteTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseSQLiteTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+const sqliteOutboxColumns = `id, kanal, tujuan, subjek, pesan, status, percobaan, berikutnya, error, dibuat, terkirim`
+
+func scanOutbox(row rowScanner) (*OutboxMessage, error) {
+	var m OutboxMessage
+	var berikutnya, dibuat, terkirim string
+	if err := row.Scan(&m.ID, &m.Kanal, &m.Tujuan, &m.Subjek, &m.Pesan, &m.Status, &m.Percobaan, &berikutnya, &m.Error, &dibuat, &terkirim); err != nil {
+		return nil, err
+	}
+	m.Berikutnya = parseSQLiteTime(berikutnya)
+	m.Dibuat = parseSQLiteTime(dibuat)
+	m.Terkirim = parseSQLiteTime(terkirim)
+	return &m, nil
+}
+
+func (s *sqliteLoanRepository) queryOutbox(query string, args ...interface{}) ([]OutboxMessage, error) {
+	rows, err := s.db.Query(`SELECT `+sqliteOutboxColumns+` FROM outbox `+query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca outbox: %v", err)
+	}
+	defer rows.Close()
+	var list []OutboxMessage
+	for rows.Next() {
+		m, err := scanOutbox(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *m)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqliteLoanRepository) EnqueueMessage(m *OutboxMessage) error {
+	res, err := s.db.Exec(`INSERT INTO outbox (kanal, tujuan, subjek, pesan, status, percobaan, berikutnya, error,
+		dibuat, terkirim) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, m.Kanal, m.Tujuan, m.Subjek, m.Pesan, m.Status, m.Percobaan, sqliteTime(m.Berikutnya),
+		m.Error, sqliteTime(m.Dibuat), sqliteTime(m.Terkirim))
+	if err != nil {
+		return fmt.Errorf("gagal menyimpan pesan outbox: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	m.ID = int(id)
+	return nil
+}
+
+func (s *sqliteLoanRepository) DueMessages(now time.Time, limit int) ([]OutboxMessage, error) {
+	return s.queryOutbox(`WHERE status = ? AND berikutnya <= ? ORDER BY id LIMIT ?`, OutboxMenunggu, sqliteTime(now), limit)
+}
+
+func (s *sqliteLoanRepository) UpdateMessage(m *OutboxMessage) error {
+	res, err := s.db.Exec(`UPDATE outbox SET status = ?, percobaan = ?, berikutnya = ?, error = ?, terkirim = ?
+		WHERE id = ?`, m.Status, m.Percobaan, sqliteTime(m.Berikutnya), m.Error, sqliteTime(m.Terkirim), m.ID)
+	if err != nil {
+		return fmt.Errorf("gagal memperbarui pesan outbox %d: %v", m.ID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+func (s *sqliteLoanRepository) FindMessage(id int) (*OutboxMessage, error) {
+	m, err := scanOutbox(s.db.QueryRow(`SELECT `+sqliteOutboxColumns+` FROM outbox WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca pesan outbox %d: %v", id, err)
+	}
+	return m, nil
+}
+
+func (s *sqliteLoanRepository) ListMessages(status string) ([]OutboxMessage, error) {
+	if status == "" {
+		return s.queryOutbox(`ORDER BY id DESC`)
+	}
+	return s.queryOutbox(`WHERE status = ? ORDER BY id DESC`, status)
+}
+
+const sqliteUserColumns = `username, nama, role, no_wa, email, kanal, aktif, password_hash, ttd`
+
+func scanUser(row rowScanner) (*User, error) {
+	var u User
+	if err := row.Scan(&u.Username, &u.Nama, &u.Role, &u.NoWA, &u.Email, &u.Kanal, &u.Aktif, &u.PasswordHash, &u.TTD); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *sqliteLoanRepository) ListUsers() ([]User, error) {
+	rows, err := s.db.Query(`SELECT ` + sqliteUserColumns + ` FROM pengguna ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca akun: %v", err)
+	}
+	defer rows.Close()
+	var list []User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *u)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqliteLoanRepository) FindUser(username string) (*User, error) {
+	u, err := scanUser(s.db.QueryRow(`SELECT `+sqliteUserColumns+` FROM pengguna WHERE username = ?`, username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca akun %s: %v", username, err)
+	}
+	return u, nil
+}
+
+func (s *sqliteLoanRepository) SaveUser(u *User) error {
+	_, err := s.db.Exec(`INSERT INTO pengguna (`+sqliteUserColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(username) DO UPDATE SET nama = excluded.nama, role = excluded.role, no_wa = excluded.no_wa,
+		email = excluded.email, kanal = excluded.kanal, aktif = excluded.aktif, password_hash = excluded.password_hash, ttd = excluded.ttd`,
+		u.Username, u.Nama, u.Role, u.NoWA, u.Email, u.Kanal, u.Aktif, u.PasswordHash, u.TTD)
+	if err != nil {
+		return fmt.Errorf("gagal menyimpan akun %s: %v", u.Username, err)
+	}
+	return nil
+}
+
+func (s *sqliteLoanRepository) ListDelegations() ([]Delegasi, error) {
+	rows, err := s.db.Query(`SELECT id, dari, kepada, mulai, selesai, alasan, dibuat_oleh, dibuat, dibatalkan
+		FROM delegasi ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca delegasi: %v", err)
+	}
+	defer rows.Close()
+	var list []Delegasi
+	for rows.Next() {
+		var d Delegasi
+		if err := rows.Scan(&d.ID, &d.Dari, &d.Kepada, &d.Mulai, &d.Selesai, &d.Alasan, &d.DibuatOleh, &d.Dibuat, &d.Dibatalkan); err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqliteLoanRepository) SaveDelegation(d *Delegasi) error {
+	if d.ID == 0 {
+		res, err := s.db.Exec(`INSERT INTO delegasi (dari, kepada, mulai, selesai, alasan, dibuat_oleh, dibuat, dibatalkan)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, d.Dari, d.Kepada, d.Mulai, d.Selesai, d.Alasan, d.DibuatOleh, d.Dibuat, d.Dibatalkan)
+		if err != nil {
+			return fmt.Errorf("gagal menyimpan delegasi: %v", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		d.ID = int(id)
+		return nil
+	}
+	res, err := s.db.Exec(`UPDATE delegasi SET dari = ?, kepada = ?, mulai = ?, selesai = ?, alasan = ?, dibatalkan = ?
+		WHERE id = ?`, d.Dari, d.Kepada, d.Mulai, d.Selesai, d.Alasan, d.Dibatalkan, d.ID)
+	if err != nil {
+		return fmt.Errorf("gagal memperbarui delegasi %d: %v", d.ID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDelegasiNotFound
+	}
+	return nil
+}
+
+const sqliteJobColumns = `id, jenis, status, error, peringatan, id_pinjam, dokumen_url, dibuat, diperbarui`
+
+func scanJob(row rowScanner) (*Job, error) {
+	var j Job
+	var peringatan, dibuat, diperbarui string
+	if err := row.Scan(&j.ID, &j.Jenis, &j.Status, &j.Error, &peringatan, &j.IDPinjam, &j.DokumenURL, &dibuat, &diperbarui); err != nil {
+		return nil, err
+	}
+	if peringatan != "" {
+		j.Peringatan = strings.Split(peringatan, "\n")
+	}
+	j.Dibuat = parseSQLiteTime(dibuat)
+	j.Diperbarui = parseSQLiteTime(diperbarui)
+	return &j, nil
+}
+
+// SaveJob menyimpan peringatan sebagai teks dipisah baris baru.
+func (s *sqliteLoanRepository) SaveJob(j *Job) error {
+	_, err := s.db.Exec(`INSERT INTO job (`+sqliteJobColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET status = excluded.status, error = excluded.error, peringatan = excluded.peringatan,
+		id_pinjam = excluded.id_pinjam, dokumen_url = excluded.dokumen_url, diperbarui = excluded.diperbarui`,
+		j.ID, j.Jenis, j.Status, j.Error, strings.Join(j.Peringatan, "\n"), j.IDPinjam, j.DokumenURL,
+		sqliteTime(j.Dibuat), sqliteTime(j.Diperbarui))
+	if err != nil {
+		return fmt.Errorf("gagal menyimpan job %s: %v", j.ID, err)
+	}
+	return nil
+}
+
+func (s *sqliteLoanRepository) FindJob(id string) (*Job, error) {
+	j, err := scanJob(s.db.QueryRow(`SELECT `+sqliteJobColumns+` FROM job WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca job %s: %v", id, err)
+	}
+	return j, nil
+}
+
+func (s *sqliteLoanRepository) UnfinishedJobs() ([]Job, error) {
+	rows, err := s.db.Query(`SELECT `+sqliteJobColumns+` FROM job WHERE status NOT IN (?, ?) ORDER BY dibuat`, JobSelesai, JobGagal)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca job: %v", err)
+	}
+	defer rows.Close()
+	var list []Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *j)
+	}
+	return list, rows.Err()
+}
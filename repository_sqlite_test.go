@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// newTestStorage memakai database SQLite baru di direktori sementara sebagai
+// loanRepo, alatRepo, reminderRepo, userRepo, dan delegationRepo selama test.
+func newTestStorage(t *testing.T) *sqliteLoanRepository {
+	t.Helper()
+	db := openTestSQLite(t, filepath.Join(t.TempDir(), "peminjaman.db"))
+	oldLoan, oldAlat, oldReminder, oldUser, oldDelegation := loanRepo, alatRepo, reminderRepo, userRepo, delegationRepo
+	loanRepo, alatRepo, reminderRepo, userRepo, delegationRepo = db, db, db, db, db
+	t.Cleanup(func() {
+		loanRepo, alatRepo, reminderRepo, userRepo, delegationRepo = oldLoan, oldAlat, oldReminder, oldUser, oldDelegation
+	})
+	return db
+}
+
+func openTestSQLite(t *testing.T, path string) *sqliteLoanRepository {
+	t.Helper()
+	db, err := openSQLiteLoanRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createTestLoan menyimpan peminjaman berstatus status dengan satu jenis alat.
+func createTestLoan(t *testing.T, status LoanStatus, alat string, jumlah int, from, to string) *Peminjaman {
+	t.Helper()
+	loan := &Peminjaman{Status: status, Form: FormData{Nama: "Budi", TanggalPinjam: from, TanggalKembali: to}}
+	loan.Form.setItems([]ItemPinjam{{NamaAlat: alat, Jumlah: jumlah}})
+	if err := loanRepo.CreateLoan(loan); err != nil {
+		t.Fatal(err)
+	}
+	return loan
+}
+
+func TestSQLiteLoans(t *testing.T) {
+	db := newTestStorage(t)
+	tests := []struct {
+		name string
+		loan Peminjaman
+	}{
+		{"baru", Peminjaman{Form: FormData{Nama: "Budi", Kelas: "XI TKJ 1", NamaAlat: "Kamera", JumlahAlat: 1, TanggalPinjam: "2026-01-05", TanggalKembali: "2026-01-06", Keterangan: "Lomba"}}},
+		{"dengan ID", Peminjaman{ID: 40, Form: FormData{Nama: "Ani", NamaAlat: "Tripod", JumlahAlat: 2}}},
+		{"setelah ID manual", Peminjaman{Form: FormData{Nama: "Citra", NamaAlat: "Proyektor", JumlahAlat: 1}}},
+	}
+	wantIDs := []int{1, 40, 41}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := tt.loan
+			if err := db.CreateLoan(&loan); err != nil {
+				t.Fatal(err)
+			}
+			if loan.ID != wantIDs[i] || loan.TanggalAjuan == "" || loan.Status != StatusDiajukan {
+				t.Errorf("ID %d tanggal %q status %s, want ID %d", loan.ID, loan.TanggalAjuan, loan.Status, wantIDs[i])
+			}
+			got, err := db.FindLoan(loan.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Form.Nama != tt.loan.Form.Nama || got.Form.NamaAlat != tt.loan.Form.NamaAlat || got.Form.KeteranganPinjam != tt.loan.Form.Keterangan {
+				t.Errorf("FindLoan = %+v", got.Form)
+			}
+		})
+	}
+
+	if loans, err := db.ListLoans(); err != nil || len(loans) != 3 || loans[2].ID != 41 {
+		t.Errorf("ListLoans = %d peminjaman, %v", len(loans), err)
+	}
+	multi := &Peminjaman{Form: FormData{Nama: "Dewi"}}
+	multi.Form.setItems([]ItemPinjam{{"Kamera", 2}, {"Tripod", 1}})
+	if err := db.CreateLoan(multi); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.FindLoan(multi.ID); len(got.Form.Items) != 2 || got.Form.Items[1] != (ItemPinjam{"Tripod", 1}) || got.Form.JumlahAlat != 3 {
+		t.Errorf("item tersimpan = %+v, jumlah %d", got.Form.Items, got.Form.JumlahAlat)
+	}
+	if loans, _ := db.ListLoans(); len(loans[len(loans)-1].Form.Items) != 2 {
+		t.Errorf("ListLoans tidak membaca item: %+v", loans[len(loans)-1].Form)
+	}
+	if _, err := db.FindLoan(99); !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("FindLoan(99) err = %v, want ErrLoanNotFound", err)
+	}
+	if err := db.UpdateLoanDocuments(99, "pdf", "doc"); !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("UpdateLoanDocuments(99) err = %v, want ErrLoanNotFound", err)
+	}
+	if err := db.UpdateLoanDocuments(1, "https://pdf", "https://doc"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.FindLoan(1); got.PDFURL != "https://pdf" || got.DocURL != "https://doc" {
+		t.Errorf("dokumen = %q, %q", got.PDFURL, got.DocURL)
+	}
+}
+
+func TestSQLiteApprovals(t *testing.T) {
+	db := newTestStorage(t)
+	loan := &Peminjaman{Form: FormData{Nama: "Budi", NamaAlat: "Kamera", JumlahAlat: 1}}
+	if err := db.CreateLoan(loan); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := db.FindApproval(loan.ID); a != nil || err != nil {
+		t.Errorf("FindApproval sebelum diputuskan = %+v, %v", a, err)
+	}
+	for _, status := range []string{"Ditolak", "Disetujui"} {
+		a := &Approval{NamaPeminjam: "Budi", Approver: "Pak Guru", IDPinjam: loan.ID, Status: status}
+		if err := db.RecordApproval(a); err != nil || a.ID == 0 {
+			t.Fatalf("RecordApproval = %d, %v", a.ID, err)
+		}
+	}
+	a, err := db.FindApproval(loan.ID)
+	if err != nil || a == nil || a.Status != "Disetujui" || a.Tanggal == "" {
+		t.Errorf("FindApproval = %+v, %v, want keputusan terakhir", a, err)
+	}
+	other := createTestLoan(t, StatusDiajukan, "Tripod", 1, "2026-01-05", "2026-01-06")
+	if err := db.RecordApproval(&Approval{IDPinjam: other.ID, Approver: "Bu Guru", Status: "Disetujui", Tahap: "Wakasek", Username: "wakasek", TTD: "ttd-wakasek.png"}); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := db.ListApprovals(loan.ID); err != nil || len(list) != 2 || list[0].Status != "Ditolak" {
+		t.Errorf("ListApprovals(%d) = %+v, %v", loan.ID, list, err)
+	}
+	if all, err := db.ListAllApprovals(); err != nil || len(all) != 3 || all[2].IDPinjam != other.ID || all[2].Tahap != "Wakasek" ||
+		all[2].Username != "wakasek" || all[2].TTD != "ttd-wakasek.png" {
+		t.Errorf("ListAllApprovals = %+v, %v", all, err)
+	}
+	if err := db.UpdateStatus(loan.ID, StatusDiajukan, StatusDisetujui, "Pak Guru"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.FindLoan(loan.ID); got.Status != StatusDisetujui || got.Approver != "Pak Guru" || got.TanggalStatus == "" {
+		t.Errorf("status peminjaman = %q oleh %q pada %q", got.Status, got.Approver, got.TanggalStatus)
+	}
+	// Status tersimpan sudah bukan from: perubahan ditolak dan approver tetap.
+	if err := db.UpdateStatus(loan.ID, StatusDiajukan, StatusDitolak, "Bu Guru"); !errors.Is(err, ErrStatusChanged) {
+		t.Errorf("UpdateStatus dari status lama err = %v, want ErrStatusChanged", err)
+	}
+	if err := db.UpdateStatus(99, StatusDiajukan, StatusDitolak, ""); !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("UpdateStatus(99) err = %v, want ErrLoanNotFound", err)
+	}
+	if err := db.UpdateStatus(loan.ID, StatusDisetujui, StatusDipinjam, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.FindLoan(loan.ID); got.Status != StatusDipinjam || got.Approver != "Pak Guru" {
+		t.Errorf("approver kosong menimpa approver lama: %q", got.Approver)
+	}
+	if err := db.RecordReturn(&Pengembalian{IDPinjam: loan.ID, Nama: "Budi", KondisiAlat: "Baik"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteMigrasiUlang(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peminjaman.db")
+	db := openTestSQLite(t, path)
+	loan := &Peminjaman{Form: FormData{Nama: "Budi"}}
+	if err := db.CreateLoan(loan); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	// Membuka database yang sudah dimigrasi tidak menjalankan migrasi lagi
+	// dan data lama tetap ada.
+	again := openTestSQLite(t, path)
+	if got, err := again.FindLoan(loan.ID); err != nil || got.Form.Nama != "Budi" {
+		t.Errorf("FindLoan setelah dibuka ulang = %+v, %v", got, err)
+	}
+}
+
+func TestMirrorLoanRepository(t *testing.T) {
+	primary := openTestSQLite(t, filepath.Join(t.TempDir(), "primary.db"))
+	mirror := openTestSQLite(t, filepath.Join(t.TempDir(), "mirror.db"))
+	repo := &mirrorLoanRepository{primary: primary, mirror: mirror}
+
+	loan := &Peminjaman{Form: FormData{Nama: "Budi", NamaAlat: "Kamera"}}
+	if err := repo.CreateLoan(loan); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateStatus(loan.ID, StatusDiajukan, StatusDisetujui, "Pak Guru"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := mirror.FindLoan(loan.ID)
+	if err != nil || got.Status != StatusDisetujui {
+		t.Errorf("mirror = %+v, %v", got, err)
+	}
+
+	// Kegagalan mirror tidak menggagalkan penulisan ke primary.
+	mirror.Close()
+	second := &Peminjaman{Form: FormData{Nama: "Ani"}}
+	if err := repo.CreateLoan(second); err != nil {
+		t.Errorf("CreateLoan dengan mirror rusak: %v", err)
+	}
+	if _, err := repo.FindLoan(second.ID); err != nil {
+		t.Errorf("FindLoan dari primary: %v", err)
+	}
+}
+
+func TestSQLiteAlat(t *testing.T) {
+	db := newTestStorage(t)
+	for _, a := range []Alat{
+		{Kode: "KAM", Nama: "Kamera", Jumlah: 2, Lokasi: "Lemari 1"},
+		{Kode: "TRP", Nama: "Tripod", Jumlah: 1},
+		{Kode: "KAM", Nama: "Kamera", Jumlah: 3, Lokasi: "Lemari 2"},
+	} {
+		if err := db.SaveAlat(&a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if list, err := db.ListAlat(); err != nil || len(list) != 2 {
+		t.Errorf("ListAlat = %+v, %v", list, err)
+	}
+	tests := []struct {
+		key     string
+		want    string
+		wantErr error
+	}{
+		{"KAM", "Kamera", nil},
+		{" kamera ", "Kamera", nil},
+		{"trp", "Tripod", nil},
+		{"Drone", "", ErrAlatNotFound},
+	}
+	for _, tt := range tests {
+		a, err := db.FindAlat(tt.key)
+		if !errors.Is(err, tt.wantErr) || (err == nil && a.Nama != tt.want) {
+			t.Errorf("FindAlat(%q) = %+v, %v", tt.key, a, err)
+		}
+	}
+	if a, _ := db.FindAlat("KAM"); a.Jumlah != 3 || a.Lokasi != "Lemari 2" {
+		t.Errorf("SaveAlat tidak memperbarui kode yang sama: %+v", a)
+	}
+}
+
+func TestSQLiteReminders(t *testing.T) {
+	db := newTestStorage(t)
+	loan := createTestLoan(t, StatusDipinjam, "Kamera", 1, "2026-03-01", "2026-03-08")
+	for _, r := range []Reminder{
+		{IDPinjam: loan.ID, Jenis: "H-1", Tanggal: "2026-03-07 07:00:00", Penerima: "62811"},
+		{IDPinjam: loan.ID, Jenis: "H", Tanggal: "2026-03-08 07:00:00", Penerima: "62811"},
+	} {
+		if err := db.RecordReminder(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := db.ListReminders()
+	if err != nil || len(history) != 2 || history[1].Jenis != "H" || history[1].Penerima != "62811" {
+		t.Errorf("ListReminders = %+v, %v", history, err)
+	}
+}
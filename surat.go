@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// LetterDefinition menjelaskan satu jenis surat. Pembuat surat (Google Docs,
+// .docx lokal, dan PDF lokal) hanya membaca definisi ini, jadi jenis surat
+// baru cukup ditambahkan ke letterDefinitions.
+type LetterDefinition struct {
+	Jenis string
+	// Judul adalah nama dokumen; placeholder di dalamnya ikut diganti.
+	Judul string
+
+	GoogleTemplate string // ID template Google Docs
+	DocFolder      string // folder Drive untuk dokumen hasil salinan
+	PDFFolder      string // folder Drive untuk PDF
+	DocxTemplate   string // file template di DOCX_TEMPLATE_DIR
+
+	// Tabel menentukan isi tabel yang menggantikan <<NMALT>> jika alatnya
+	// lebih dari satu: TabelAlat atau TabelPengembalian.
+	Tabel string
+	// Gambar mengatur placeholder gambar yang namanya tidak mengikuti pola
+	// <<JENIS:nama>> (misalnya <<FOTO>> pada template lama) atau yang
+	// ukurannya berbeda dari gambarDefault. Placeholder <<FOTO:nama>>,
+	// <<TTD:nama>>, dan <<QR:nama>> lain di template diisi otomatis dari
+	// imageSources; <<TTD:tahap>> diisi tanda tangan tahap itu.
+	Gambar []ImageSlot
+	// Isian adalah baris "Label : nilai" pada PDF lokal, urut seperti template.
+	Isian []suratField
+}
+
+// Jenis tabel alat pada surat.
+const (
+	TabelAlat         = "alat"
+	TabelPengembalian = "pengembalian"
+)
+
+// ImageSlot adalah placeholder yang diganti gambar dari imageSources[Sumber].
+// Lebar dan Tinggi (point) adalah kotak tempat gambar; salah satunya boleh 0
+// agar mengikuti rasio gambar.
+type ImageSlot struct {
+	Placeholder string
+	Sumber      string // kunci imageSources, misalnya "FOTO:peminjaman"
+	Lebar       float64
+	Tinggi      float64
+	Ukuran      string // UkuranMuat (default) atau UkuranTetap
+}
+
+// Cara gambar mengisi kotak ImageSlot. UkuranMuat memperkecil atau
+// memperbesar gambar sampai pas di dalam kotak tanpa mengubah rasionya;
+// UkuranTetap memaksa gambar seukuran kotak.
+const (
+	UkuranMuat  = "muat"
+	UkuranTetap = "tetap"
+)
+
+// reImagePlaceholder mencocokkan placeholder gambar bernama seperti
+// <<FOTO:peminjaman>>, <<TTD:approver>>, atau <<QR:verifikasi>>.
+var reImagePlaceholder = regexp.MustCompile(`<<(FOTO|TTD|QR):([A-Za-z0-9_-]+)>>`)
+
+// gambarDefault adalah ukuran placeholder gambar bernama per jenis.
+var gambarDefault = map[string]ImageSlot{
+	"FOTO": {Lebar: suratFotoLebar, Tinggi: suratFotoTinggi},
+	"TTD":  {Lebar: 150, Tinggi: 60},
+	"QR":   {Lebar: 72, Tinggi: 72},
+}
+
+// imageSources mengembalikan lokasi gambar (URL atau path lokal) untuk setiap
+// Sumber. Lokasi kosong berarti gambar tidak ada dan placeholder dikosongkan.
+var imageSources = map[string]func(def *LetterDefinition, form FormData, nomorUrut int) string{
+	"FOTO:peminjaman": func(_ *LetterDefinition, form FormData, _ int) string { return form.PeminjamanFotoPath },
+	"FOTO:pengembalian": func(_ *LetterDefinition, form FormData, _ int) string {
+		if form.NoPengembalian == 0 {
+			return ""
+		}
+		return form.FotoPath
+	},
+	"TTD:approver": func(_ *LetterDefinition, form FormData, _ int) string { return form.ApproverTTD },
+	"QR:verifikasi": func(def *LetterDefinition, _ FormData, nomorUrut int) string {
+		if suratVerifikasi == nil {
+			return ""
+		}
+		return suratVerifikasi.qrLink(nomorUrut, def.Jenis)
+	},
+}
+
+func (s ImageSlot) src(def *LetterDefinition, form FormData, nomorUrut int) string {
+	if f, ok := imageSources[s.Sumber]; ok {
+		return f(def, form, nomorUrut)
+	}
+	if jenis, nama, _ := strings.Cut(s.Sumber, ":"); jenis == "TTD" {
+		return form.ttdTahap(nama)
+	}
+	return ""
+}
+
+// jenis adalah bagian Sumber sebelum titik dua: FOTO, TTD, atau QR.
+func (s ImageSlot) jenis() string {
+	jenis, _, _ := strings.Cut(s.Sumber, ":")
+	return jenis
+}
+
+// size menghitung ukuran gambar berukuran px (lebar) x py (tinggi) piksel di
+// dalam kotak slot, dalam point. Tanpa kotak sama sekali, 1 piksel = 0,75 point.
+func (s ImageSlot) size(px, py int) (float64, float64) {
+	w, h := float64(px), float64(py)
+	if w <= 0 || h <= 0 {
+		return s.Lebar, s.Tinggi
+	}
+	switch {
+	case s.Lebar == 0 && s.Tinggi == 0:
+		return w * 0.75, h * 0.75
+	case s.Tinggi == 0:
+		return s.Lebar, s.Lebar * h / w
+	case s.Lebar == 0:
+		return s.Tinggi * w / h, s.Tinggi
+	case s.Ukuran == UkuranTetap:
+		return s.Lebar, s.Tinggi
+	}
+	scale := min(s.Lebar/w, s.Tinggi/h)
+	return w * scale, h * scale
+}
+
+// fit adalah size untuk gambar img. Jika ukuran piksel img tidak terbaca,
+// kotak slot dipakai apa adanya.
+func (s ImageSlot) fit(img []byte) (float64, float64) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(img))
+	if err != nil {
+		return s.size(0, 0)
+	}
+	return s.size(cfg.Width, cfg.Height)
+}
+
+// imageSlots adalah Gambar pada def ditambah placeholder gambar bernama yang
+// ditemukan di template (found) dan belum diatur di Gambar.
+func (def *LetterDefinition) imageSlots(found []string) []ImageSlot {
+	slots := append([]ImageSlot(nil), def.Gambar...)
+	for _, p := range found {
+		m := reImagePlaceholder.FindStringSubmatch(p)
+		if m == nil || slices.ContainsFunc(slots, func(s ImageSlot) bool { return s.Placeholder == p }) {
+			continue
+		}
+		slots = append(slots, gambar(p, m[1]+":"+m[2]))
+	}
+	return slots
+}
+
+// suratField adalah satu baris "Label : nilai" pada surat; nilainya diambil
+// dari teks pengganti placeholder yang sama dengan template.
+type suratField struct {
+	Label, Placeholder string
+}
+
+// Ukuran foto pada surat.
+const (
+	suratFotoLebar  = 400
+	suratFotoTinggi = 225
+)
+
+const (
+	folderDokumen = "1Y3cvxCOy4M0GtRPe7A1DrAg1iji5O0lQ"
+	folderPDF     = "1HhZncgqeqEzgTkMQZOBC9HAsPTIB0zTv"
+)
+
+var isianPeminjaman = []suratField{
+	{"Nama", "<<NAMA>>"},
+	{"Kelas", "<<KLS>>"},
+	{"NIS", "<<NIS>>"},
+	{"NO.WA", "<<NO>>"},
+	{"Nama Alat", "<<NMALT>>"},
+	{"Jumlah Alat", "<<JML>>"},
+	{"Tanggal Peminjam", "<<TGLPMJ>>"},
+	{"Tanggal Pengembalian", "<<TGLPGN>>"},
+	{"Lama Peminjaman", "<<LMPJM>>"},
+	{"Keterangan", "<<KET>>"},
+}
+
+var (
+	suratPeminjaman = &LetterDefinition{
+		Jenis:          "peminjaman",
+		Judul:          "Formulir Peminjaman <<NMR>> - <<NAMA>>",
+		GoogleTemplate: "1RK2I4oAUvPFTlv98Hp5bDlassulBFvrASuhs5-riVUM",
+		DocFolder:      folderDokumen,
+		PDFFolder:      folderPDF,
+		DocxTemplate:   "TEMPLATE FORM PEMINJAMAN.docx",
+		Tabel:          TabelAlat,
+		Gambar:         []ImageSlot{gambar("<<FOTO>>", "FOTO:peminjaman")},
+		Isian:          isianPeminjaman,
+	}
+	// Template Google Docs persetujuan harus diubah manual mengikuti template
+	// .docx: <<TTD>> di atas baris tanda tangan, <<YNG>> kedua di bawahnya
+	// sebagai nama approver, dan <<QR>> untuk QR code verifikasi. Selama
+	// <<TTD>> atau <<QR>> belum ada, googleLetterRenderer membuat surat ini
+	// sebagai PDF lokal.
+	suratPersetujuan = &LetterDefinition{
+		Jenis:          "persetujuan",
+		Judul:          "Formulir Approval <<NMR>> - <<NAMA>>",
+		GoogleTemplate: "1NVr2LHlDrrqEJJTrCJed3AnQTncs5ZMU6Lu0wO1RlRs",
+		DocFolder:      folderDokumen,
+		PDFFolder:      folderPDF,
+		DocxTemplate:   "SURAT PENGANTAR PERSETUJUAN (1).docx",
+		Tabel:          TabelAlat,
+		Gambar: []ImageSlot{
+			gambar("<<FOTO>>", "FOTO:peminjaman"),
+			gambar("<<TTD>>", "TTD:approver"),
+			gambar("<<QR>>", "QR:verifikasi"),
+		},
+		Isian: append(append([]suratField(nil), isianPeminjaman...),
+			suratField{"Tanggal Persetujuan", "<<TGLPS>>"},
+			suratField{"Status Persetujuan", "<<STS>>"},
+			suratField{"Yang Menyetujui", "<<YNG>>"},
+		),
+	}
+	suratPengembalian = &LetterDefinition{
+		Jenis:          "pengembalian",
+		Judul:          "Formulir Pengembalian <<NMR>>-<<NMRKMB>> - <<NAMA>>",
+		GoogleTemplate: "1aBpU0yBFFjVdMjYtuB5skHY4m5pCKlVlMCdzq5Ib9Y0",
+		DocFolder:      folderDokumen,
+		PDFFolder:      folderPDF,
+		DocxTemplate:   "SURAT PENGANTAR PENGEMBALIAN (2).docx",
+		Tabel:          TabelPengembalian,
+		Gambar: []ImageSlot{
+			gambar("<<FOTO>>", "FOTO:peminjaman"),
+			gambar("<<FOTO2>>", "FOTO:pengembalian"),
+		},
+		Isian: []suratField{
+			{"Nama", "<<NAMA>>"},
+			{"Kelas", "<<KLS>>"},
+			{"NIS", "<<NIS>>"},
+			{"NO.WA", "<<NO>>"},
+			{"Nama Alat", "<<NMALT>>"},
+			{"Jumlah Alat", "<<JML>>"},
+			{"Tanggal Peminjaman", "<<TGLPMJ>>"},
+			{"Tanggal Harus Kembali", "<<TGLPGN>>"},
+			{"Lama Peminjaman", "<<LMPJM>>"},
+			{"Keterangan Peminjam", "<<KET>>"},
+			{"Tanggal Persetujuan", "<<TGLPS>>"},
+			{"Status Persetujuan", "<<STS>>"},
+			{"Yang Menyetujui", "<<YNG>>"},
+			{"Tanggal Kembali", "<<TGLBALI>>"},
+			{"Kondisi Alat", "<<KNDS>>"},
+			{"Keterangan Alat", "<<KETALT>>"},
+			{"Dikembalikan", "<<KMB>>"},
+			{"Belum Kembali", "<<SISA>>"},
+		},
+	}
+)
+
+// gambar adalah slot placeholder untuk sumber dengan ukuran default jenisnya.
+func gambar(placeholder, sumber string) ImageSlot {
+	jenis, _, _ := strings.Cut(sumber, ":")
+	slot := gambarDefault[jenis]
+	slot.Placeholder, slot.Sumber = placeholder, sumber
+	return slot
+}
+
+// letterDefinitions adalah semua jenis surat berdasarkan Jenis.
+var letterDefinitions = map[string]*LetterDefinition{
+	suratPeminjaman.Jenis:   suratPeminjaman,
+	suratPersetujuan.Jenis:  suratPersetujuan,
+	suratPengembalian.Jenis: suratPengembalian,
+}
+
+// suratReplacements adalah teks pengganti semua placeholder teks. Keputusan
+// persetujuan diambil dari ApprovalDate, ApprovalStatus, dan ApproverName,
+// dan pengembalian dari field pengembalian di form. Placeholder gambar tidak
+// termasuk.
+func suratReplacements(def *LetterDefinition, form FormData, nomorUrut int, now time.Time) map[string]string {
+	ket := form.Keterangan
+	if ket == "" {
+		ket = form.KeteranganPinjam
+	}
+	repl := map[string]string{
+		"<<NMR>>":     fmt.Sprintf("%04d", nomorUrut),
+		"<<TGL>>":     now.Format("02 January 2006"),
+		"<<NAMA>>":    form.Nama,
+		"<<KLS>>":     form.Kelas,
+		"<<NIS>>":     form.NIS,
+		"<<NO>>":      form.NoWA,
+		"<<TGLPMJ>>":  form.TanggalPinjam,
+		"<<TGLPGN>>":  form.TanggalKembali,
+		"<<LMPJM>>":   lamaPinjam(form),
+		"<<KET>>":     ket,
+		"<<TGLPS>>":   form.ApprovalDate,
+		"<<STS>>":     form.ApprovalStatus,
+		"<<YNG>>":     form.ApproverName,
+		"<<TGLBALI>>": now.Format("02 January 2006"),
+		"<<KNDS>>":    form.KondisiAlat,
+		"<<KETALT>>":  form.KeteranganPengembalian,
+		"<<NMRKMB>>":  fmt.Sprintf("%04d", form.NoPengembalian),
+	}
+	if def.Tabel == TabelPengembalian {
+		replaceReturnPlaceholders(repl, form)
+	} else {
+		replaceItemPlaceholders(repl, form)
+	}
+	return repl
+}
+
+// judul mengisi placeholder pada Judul.
+func (def *LetterDefinition) judul(repl map[string]string) string {
+	title := def.Judul
+	for k, v := range repl {
+		title = strings.ReplaceAll(title, k, v)
+	}
+	return title
+}
+
+// tableRows mengembalikan isi tabel pengganti <<NMALT>>, atau nil jika
+// <<NMALT>> cukup diisi nama alat.
+func (def *LetterDefinition) tableRows(form FormData) [][]string {
+	switch {
+	case def.Tabel == TabelPengembalian && (len(form.items()) > 1 || len(form.ItemSisa) > 0):
+		return returnTableRows(form)
+	case def.Tabel == TabelAlat && len(form.items()) > 1:
+		return itemTableRows(form.items())
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxFotoSurat membatasi ukuran foto yang diunduh untuk surat.
+const maxFotoSurat = 10 << 20
+
+var fotoClient = &http.Client{Timeout: 20 * time.Second}
+
+func docxTemplatePath(name string) string {
+	return filepath.Join(getEnv("DOCX_TEMPLATE_DIR", "."), name)
+}
+
+// renderSuratDocx mengisi DocxTemplate def: gambar dulu, lalu teks, lalu tabel
+// alat di tempat <<NMALT>>. Selain def.Gambar, setiap placeholder gambar
+// bernama di template ikut diisi. Gambar yang kosong atau gagal dimuat hanya
+// dicatat di log dan placeholder-nya dikosongkan.
+func renderSuratDocx(w io.Writer, def *LetterDefinition, form FormData, nomorUrut int, now time.Time) error {
+	doc, err := openDocx(docxTemplatePath(def.DocxTemplate))
+	if err != nil {
+		return err
+	}
+	repl := suratReplacements(def, form, nomorUrut, now)
+	for _, slot := range def.imageSlots(doc.findText(reImagePlaceholder)) {
+		if src := slot.src(def, form, nomorUrut); src != "" {
+			img, err := loadImage(src)
+			if err == nil {
+				lebar, tinggi := slot.fit(img)
+				err = doc.replaceImage(slot.Placeholder, img, lebar, tinggi)
+			}
+			if err != nil && !errors.Is(err, ErrPlaceholderNotFound) {
+				log.Printf("⚠️ Gagal memasang gambar %s pada %s: %v", slot.Placeholder, def.DocxTemplate, err)
+			}
+		}
+		repl[slot.Placeholder] = ""
+	}
+	doc.replaceText(repl)
+	if rows := def.tableRows(form); rows != nil {
+		if err := doc.replaceTable("<<NMALT>>", rows); err != nil {
+			log.Printf("⚠️ Gagal membuat tabel alat pada %s: %v", def.DocxTemplate, err)
+		}
+	}
+	return doc.write(w)
+}
+
+// loadImage membaca foto dari URL http(s), misalnya link Drive yang disimpan
+// di sheet, atau dari file lokal di folder uploads. QR code verifikasi dibuat
+// langsung tanpa mengunduh dari server sendiri.
+func loadImage(src string) ([]byte, error) {
+	if suratVerifikasi != nil {
+		if img, ok, err := suratVerifikasi.qrImage(src); ok {
+			return img, err
+		}
+	}
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.ReadFile(src)
+	}
+	resp, err := fotoClient.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gagal mengunduh foto: %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxFotoSurat+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxFotoSurat {
+		return nil, fmt.Errorf("foto lebih dari %d MB", maxFotoSurat>>20)
+	}
+	return b, nil
+}
+
+// handleSuratDocx membuat ulang surat dari data yang tersimpan dan mengirimnya
+// sebagai file .docx: GET /surat/docx?jenis=peminjaman&id=0007. jenis adalah
+// salah satu letterDefinitions selain pengembalian, karena rincian tiap
+// pengembalian hanya ada di suratnya.
+func handleSuratDocx(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	jenis := r.URL.Query().Get("jenis")
+	if jenis == "" {
+		jenis = suratPeminjaman.Jenis
+	}
+	def, ok := letterDefinitions[jenis]
+	if !ok || def.Tabel == TabelPengembalian {
+		http.Error(w, "Jenis surat tidak dikenal", http.StatusBadRequest)
+		return
+	}
+	id, err := parseLoanID(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "ID Pinjam tidak valid", http.StatusBadRequest)
+		return
+	}
+	loan, err := loanRepo.FindLoan(id)
+	if errors.Is(err, ErrLoanNotFound) {
+		http.Error(w, "ID Pinjam tidak ditemukan", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Find loan error:", err)
+		http.Error(w, "Gagal membaca data peminjaman", http.StatusInternalServerError)
+		return
+	}
+	approvals, err := loanRepo.ListApprovals(id)
+	if err != nil {
+		log.Println("List approvals error:", err)
+		http.Error(w, "Gagal membaca data persetujuan", http.StatusInternalServerError)
+		return
+	}
+	if len(approvals) == 0 && def == suratPersetujuan {
+		http.Error(w, "Peminjaman ini belum diputuskan", http.StatusConflict)
+		return
+	}
+
+	form := loan.Form
+	if len(approvals) > 0 {
+		approval := approvals[len(approvals)-1]
+		form.ApprovalDate = approval.Tanggal
+		form.ApprovalStatus = approval.Status
+		form.ApproverName = approval.Approver
+		form.setTTD(approvals)
+	}
+	now := time.Now()
+	var buf bytes.Buffer
+	if err := renderSuratDocx(&buf, def, form, id, now); err != nil {
+		log.Println("❌ Gagal membuat surat .docx:", err)
+		http.Error(w, "Gagal membuat surat", http.StatusInternalServerError)
+		return
+	}
+	title := def.judul(suratReplacements(def, form, id, now))
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", title+".docx"))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/drive/v3"
+)
+
+// errTemplateGoogleLama dikembalikan renderSuratGoogle jika template Google
+// Docs belum punya placeholder gambar dari LetterDefinition.Gambar yang
+// gambarnya tersedia, misalnya <<TTD>> dan <<QR>> yang ditambahkan ke template
+// .docx persetujuan tetapi harus dipasang manual di Google Docs.
+var errTemplateGoogleLama = errors.New("template Google Docs belum memuat placeholder")
+
+// renderSuratGoogle membuat surat dari template Google Docs def: salin
+// template ke DocFolder, ganti placeholder teks, sisipkan tabel alat dan foto,
+// lalu ekspor PDF ke PDFFolder. Dokumen dan PDF bisa dibaca siapa saja yang
+// punya link.
+func renderSuratGoogle(def *LetterDefinition, form FormData, nomorUrut int, driveService *drive.Service, docsService *docs.Service) (*Surat, error) {
+	repl := suratReplacements(def, form, nomorUrut, time.Now())
+	title := def.judul(repl)
+
+	copy, err := driveService.Files.Copy(def.GoogleTemplate, &drive.File{Name: title}).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gagal menyalin template: %v", err)
+	}
+	docID := copy.Id
+	docURL := fmt.Sprintf("https://docs.google.com/document/d/%s/edit", docID)
+
+	// Gambar yang tidak punya tempat di template tidak boleh hilang diam-diam
+	// dari surat, misalnya tanda tangan approver.
+	doc, err := docsService.Documents.Get(docID).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca dokumen: %v", err)
+	}
+	if missing := missingGoogleImages(doc, def, form, nomorUrut); len(missing) > 0 {
+		if err := driveService.Files.Delete(docID).Do(); err != nil {
+			log.Println("⚠️ Gagal menghapus salinan template:", err)
+		}
+		return nil, fmt.Errorf("%w %s (surat %s)", errTemplateGoogleLama, strings.Join(missing, ", "), def.Jenis)
+	}
+
+	_, err = driveService.Files.Update(docID, nil).
+		AddParents(def.DocFolder).
+		RemoveParents("root").
+		Do()
+	if err != nil {
+		log.Println("⚠️ Gagal memindahkan file ke folder Dokumen:", err)
+	}
+
+	var reqs []*docs.Request
+	for key, val := range repl {
+		reqs = append(reqs, &docs.Request{
+			ReplaceAllText: &docs.ReplaceAllTextRequest{
+				ContainsText: &docs.SubstringMatchCriteria{Text: key, MatchCase: true},
+				ReplaceText:  val,
+			},
+		})
+	}
+	if _, err := docsService.Documents.BatchUpdate(docID, &docs.BatchUpdateDocumentRequest{Requests: reqs}).Do(); err != nil {
+		return nil, fmt.Errorf("gagal mengganti isi dokumen: %v", err)
+	}
+	if rows := def.tableRows(form); rows != nil {
+		if err := insertTable(docsService, docID, "<<NMALT>>", rows); err != nil {
+			log.Println("⚠️ Gagal membuat tabel alat:", err)
+		}
+	}
+	var found []string
+	if doc, err := docsService.Documents.Get(docID).Do(); err == nil {
+		found = googleImagePlaceholders(doc)
+	} else {
+		log.Println("⚠️ Gagal membaca placeholder gambar:", err)
+	}
+	for _, slot := range def.imageSlots(found) {
+		if err := insertGoogleImage(docsService, docID, slot, slot.src(def, form, nomorUrut)); err != nil {
+			log.Printf("⚠️ Gagal memasang gambar %s pada %s: %v", slot.Placeholder, title, err)
+		}
+	}
+
+	pdfURL, err := exportGooglePDF(driveService, docID, title, def.PDFFolder)
+	if err != nil {
+		return nil, err
+	}
+	driveService.Permissions.Create(docID, &drive.Permission{Role: "reader", Type: "anyone"}).Do()
+	log.Printf("✅ Surat %s dibuat: %s", def.Jenis, pdfURL)
+	return &Surat{PDFURL: pdfURL, DocURL: docURL}, nil
+}
+
+// missingGoogleImages mengembalikan placeholder def.Gambar yang gambarnya
+// tersedia tetapi tidak ada di doc.
+func missingGoogleImages(doc *docs.Document, def *LetterDefinition, form FormData, nomorUrut int) []string {
+	var missing []string
+	for _, slot := range def.Gambar {
+		if slot.src(def, form, nomorUrut) == "" {
+			continue
+		}
+		if _, index := findGoogleText(doc, slot.Placeholder); index < 0 {
+			missing = append(missing, slot.Placeholder)
+		}
+	}
+	return missing
+}
+
+// insertGoogleImage mengganti placeholder slot dengan gambar dari src, baik di
+// isi dokumen, tabel, header, maupun footer. Jika src kosong atau gambar gagal
+// disisipkan, placeholder dihapus supaya tidak ikut tercetak. Placeholder yang
+// tidak ada di dokumen dilewati.
+//
+// Google Docs selalu memuat gambar di dalam kotak slot tanpa mengubah
+// rasionya, jadi UkuranTetap diperlakukan sama dengan UkuranMuat.
+func insertGoogleImage(docsService *docs.Service, docID string, slot ImageSlot, src string) error {
+	doc, err := docsService.Documents.Get(docID).Do()
+	if err != nil {
+		return fmt.Errorf("gagal membaca dokumen: %v", err)
+	}
+	segment, index := findGoogleText(doc, slot.Placeholder)
+	if index < 0 {
+		if src != "" {
+			return fmt.Errorf("placeholder %s tidak ditemukan", slot.Placeholder)
+		}
+		return nil
+	}
+	del := &docs.Request{DeleteContentRange: &docs.DeleteContentRangeRequest{
+		Range: &docs.Range{SegmentId: segment, StartIndex: index, EndIndex: index + utf16Len(slot.Placeholder)},
+	}}
+	if src != "" {
+		size := &docs.Size{}
+		if slot.Lebar > 0 {
+			size.Width = &docs.Dimension{Magnitude: slot.Lebar, Unit: "PT"}
+		}
+		if slot.Tinggi > 0 {
+			size.Height = &docs.Dimension{Magnitude: slot.Tinggi, Unit: "PT"}
+		}
+		_, err = docsService.Documents.BatchUpdate(docID, &docs.BatchUpdateDocumentRequest{Requests: []*docs.Request{
+			del,
+			{InsertInlineImage: &docs.InsertInlineImageRequest{
+				Location:   &docs.Location{SegmentId: segment, Index: index},
+				Uri:        src,
+				ObjectSize: size,
+			}},
+		}}).Do()
+		if err == nil {
+			return nil
+		}
+		err = fmt.Errorf("gagal menyisipkan gambar: %v", err)
+	}
+	if _, derr := docsService.Documents.BatchUpdate(docID, &docs.BatchUpdateDocumentRequest{Requests: []*docs.Request{del}}).Do(); derr != nil && err == nil {
+		err = fmt.Errorf("gagal menghapus placeholder: %v", derr)
+	}
+	return err
+}
+
+// googleSegments mengembalikan isi dokumen, header, lalu footer beserta
+// SegmentId-nya. Isi dokumen memakai SegmentId kosong.
+func googleSegments(doc *docs.Document) (ids []string, contents [][]*docs.StructuralElement) {
+	ids = append(ids, "")
+	contents = append(contents, doc.Body.Content)
+	for _, id := range slices.Sorted(maps.Keys(doc.Headers)) {
+		ids = append(ids, id)
+		contents = append(contents, doc.Headers[id].Content)
+	}
+	for _, id := range slices.Sorted(maps.Keys(doc.Footers)) {
+		ids = append(ids, id)
+		contents = append(contents, doc.Footers[id].Content)
+	}
+	return ids, contents
+}
+
+// findGoogleText mencari text di semua segmen dokumen dan mengembalikan
+// SegmentId serta indeksnya, atau indeks -1 jika tidak ada.
+func findGoogleText(doc *docs.Document, text string) (string, int64) {
+	ids, contents := googleSegments(doc)
+	for i, content := range contents {
+		if index := findTextIndex(content, text); index >= 0 {
+			return ids[i], index
+		}
+	}
+	return "", -1
+}
+
+// googleImagePlaceholders mengembalikan placeholder gambar bernama
+// (reImagePlaceholder) di semua segmen dokumen, tanpa duplikat.
+func googleImagePlaceholders(doc *docs.Document) []string {
+	var b strings.Builder
+	var collect func(content []*docs.StructuralElement)
+	collect = func(content []*docs.StructuralElement) {
+		for _, c := range content {
+			if c.Paragraph != nil {
+				for _, e := range c.Paragraph.Elements {
+					if e.TextRun != nil {
+						b.WriteString(e.TextRun.Content)
+					}
+				}
+			}
+			if c.Table != nil {
+				for _, row := range c.Table.TableRows {
+					for _, tc := range row.TableCells {
+						collect(tc.Content)
+					}
+				}
+			}
+		}
+	}
+	_, contents := googleSegments(doc)
+	for _, content := range contents {
+		collect(content)
+	}
+	var found []string
+	for _, p := range reImagePlaceholder.FindAllString(b.String(), -1) {
+		if !slices.Contains(found, p) {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+// exportGooglePDF mengekspor dokumen ke PDF di folder dan mengembalikan link-nya.
+func exportGooglePDF(driveService *drive.Service, docID, title, folder string) (string, error) {
+	export, err := driveService.Files.Export(docID, "application/pdf").Download()
+	if err != nil {
+		return "", fmt.Errorf("gagal export PDF: %v", err)
+	}
+	defer export.Body.Close()
+	b, err := io.ReadAll(export.Body)
+	if err != nil {
+		return "", fmt.Errorf("gagal export PDF: %v", err)
+	}
+	return uploadGooglePDF(driveService, b, title, folder)
+}
+
+// uploadGooglePDF menyimpan PDF b di folder Drive dan mengembalikan link-nya.
+func uploadGooglePDF(driveService *drive.Service, b []byte, title, folder string) (string, error) {
+	pdf, err := driveService.Files.Create(&drive.File{
+		Name:     title + ".pdf",
+		Parents:  []string{folder},
+		MimeType: "application/pdf",
+	}).Media(bytes.NewReader(b)).Do()
+	if err != nil {
+		return "", fmt.Errorf("gagal upload PDF: %v", err)
+	}
+	driveService.Permissions.Create(pdf.Id, &drive.Permission{Role: "reader", Type: "anyone"}).Do()
+	return fmt.Sprintf("https://drive.google.com/uc?id=%s", pdf.Id), nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// Tata letak surat PDF dalam point, dihitung dari kiri atas halaman.
+const (
+	pdfMarginX    = 72.0
+	pdfMarginTop  = 60.0
+	pdfMarginBot  = 60.0
+	pdfFontSize   = 11.0
+	pdfLineHeight = 15.0
+	pdfLabelWidth = 150.0
+)
+
+// suratPDF menulis surat dari atas ke bawah dan pindah halaman jika penuh.
+type suratPDF struct {
+	doc  *pdfDocument
+	page *pdfPage
+	y    float64
+}
+
+func (s *suratPDF) newPage() {
+	s.page = s.doc.addPage()
+	s.y = pdfMarginTop
+}
+
+// need memindahkan tulisan ke halaman baru jika sisa halaman kurang dari h.
+func (s *suratPDF) need(h float64) {
+	if s.y+h > pdfPageHeight-pdfMarginBot {
+		s.newPage()
+	}
+}
+
+func (s *suratPDF) line(x float64, bold bool, text string) {
+	s.need(pdfLineHeight)
+	s.y += pdfLineHeight
+	s.page.text(x, s.y, pdfFontSize, bold, text)
+}
+
+// renderSuratPDF menyusun surat def dengan kop dan tujuan yang sama seperti
+// template .docx, lalu Isian, tabel alat jika ada (menggantikan baris Nama
+// Alat), tanda tangan, dan foto. Foto yang kosong atau gagal dimuat hanya
+// dicatat di log.
+func renderSuratPDF(w io.Writer, def *LetterDefinition, form FormData, nomorUrut int, now time.Time) error {
+	repl := suratReplacements(def, form, nomorUrut, now)
+	table := def.tableRows(form)
+	s := &suratPDF{doc: newPDF()}
+	s.newPage()
+	right := pdfPageWidth - pdfMarginX
+
+	// Kop surat.
+	s.line(pdfMarginX, true, "KOTA SEMARANG")
+	s.page.text(right-pdfTextWidth("SMKN 7 SEMARANG", pdfFontSize, true), s.y, pdfFontSize, true, "SMKN 7 SEMARANG")
+	s.line(pdfMarginX, false, "KECAMATAN SEMARANG.SEL")
+	s.line(pdfMarginX, false, "KELURAHAN MUGASSARI")
+	s.y += 8
+	s.page.line(pdfMarginX, s.y, right, s.y, 1.2)
+	s.y += 12
+
+	// Nomor surat di kiri, tanggal dan tujuan di kanan.
+	tujuanX := pdfMarginX + 270
+	kiri := [][2]string{{"Nomor", repl["<<NMR>>"]}, {"Lampiran", "–"}, {"Hal", "Surat Pengantar"}}
+	kanan := []string{"Semarang, " + repl["<<TGL>>"], "Kepada", "Yth. Kepala Penanggung Jawab", "Peminjaman Alat/Barang", "di", "S E M A R A N G"}
+	for i, k := range kanan {
+		s.line(tujuanX, false, k)
+		if i < len(kiri) {
+			s.page.text(pdfMarginX, s.y, pdfFontSize, false, kiri[i][0])
+			s.page.text(pdfMarginX+60, s.y, pdfFontSize, false, ": "+kiri[i][1])
+		}
+	}
+	s.y += pdfLineHeight
+	s.line(pdfMarginX, false, "Bersama ini menerangkan bahwa :")
+	s.y += 4
+
+	valueX := pdfMarginX + pdfLabelWidth + 10
+	for _, f := range def.Isian {
+		val, ok := repl[f.Placeholder]
+		if f.Placeholder == "<<NMALT>>" && table != nil {
+			s.line(pdfMarginX, false, f.Label)
+			s.page.text(pdfMarginX+pdfLabelWidth, s.y, pdfFontSize, false, ":")
+			s.table(table)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		lines := pdfWrap(val, pdfFontSize, false, right-valueX)
+		for i, l := range lines {
+			s.line(valueX, false, l)
+			if i == 0 {
+				s.page.text(pdfMarginX, s.y, pdfFontSize, false, f.Label)
+				s.page.text(pdfMarginX+pdfLabelWidth, s.y, pdfFontSize, false, ":")
+			}
+		}
+	}
+
+	s.y += pdfLineHeight
+	s.line(pdfMarginX+30, false, "Demikian untuk menjadikan periksa dan guna seperlunya.")
+
+	// Tanda tangan: penanggung jawab di kiri, peminjam di kanan. Tanda tangan
+	// approver dan QR code verifikasi mengisi ruang tanda tangan, foto
+	// dilampirkan di bawahnya.
+	stempel := map[string]ImageSlot{}
+	var foto []ImageSlot
+	for _, slot := range def.Gambar {
+		if jenis := slot.jenis(); jenis == "FOTO" {
+			foto = append(foto, slot)
+		} else if _, ok := stempel[jenis]; !ok {
+			stempel[jenis] = slot
+		}
+	}
+	if slot, ok := stempel["TTD"]; ok && len(form.TTDTahap) > 0 {
+		s.ttdTahap(form.TTDTahap, slot)
+	}
+	s.need(pdfLineHeight * 8)
+	s.y += pdfLineHeight
+	ttdX := right - 150
+	s.line(pdfMarginX, false, "Mengetahui")
+	top := s.y - pdfFontSize
+	s.line(pdfMarginX, false, "Kepala Penanggung Jawab")
+	s.page.text(ttdX, s.y, pdfFontSize, false, "Peminjam")
+	ruang := pdfLineHeight * 4
+	if slot, ok := stempel["TTD"]; ok {
+		s.stamp(slot, slot.src(def, form, nomorUrut), pdfMarginX, s.y+2, ruang)
+	}
+	if slot, ok := stempel["QR"]; ok {
+		s.stamp(slot, slot.src(def, form, nomorUrut), (pdfMarginX+150+ttdX)/2-slot.Lebar/2, top, ruang+pdfLineHeight*2)
+	}
+	s.y += ruang
+	nama := "……….."
+	if yng := repl["<<YNG>>"]; yng != "" {
+		nama = yng
+	}
+	s.line(pdfMarginX, false, nama)
+	s.page.text(ttdX, s.y, pdfFontSize, false, repl["<<NAMA>>"])
+
+	for _, slot := range foto {
+		src := slot.src(def, form, nomorUrut)
+		if src == "" {
+			continue
+		}
+		if err := s.foto(src, slot); err != nil {
+			log.Printf("⚠️ Gagal memasang foto %s pada surat PDF: %v", slot.Placeholder, err)
+		}
+	}
+	return s.doc.write(w)
+}
+
+// table menggambar tabel alat bergaris. Baris pertama dicetak tebal.
+func (s *suratPDF) table(rows [][]string) {
+	cols := 0
+	for _, r := range rows {
+		cols = max(cols, len(r))
+	}
+	if cols == 0 {
+		return
+	}
+	x0 := pdfMarginX + 20
+	total := pdfPageWidth - pdfMarginX - x0
+	widths := make([]float64, cols)
+	widths[0] = 30
+	for c := 1; c < cols; c++ {
+		widths[c] = (total - widths[0]) / float64(cols-1)
+	}
+	if cols == 1 {
+		widths[0] = total
+	}
+	size := pdfFontSize - 1
+	s.y += 6
+	for r, row := range rows {
+		cells := make([][]string, cols)
+		n := 1
+		for c := range cells {
+			if c < len(row) {
+				cells[c] = pdfWrap(row[c], size, r == 0, widths[c]-8)
+				n = max(n, len(cells[c]))
+			}
+		}
+		h := float64(n)*pdfLineHeight + 4
+		s.need(h)
+		x := x0
+		for c := 0; c < cols; c++ {
+			s.page.rect(x, s.y, widths[c], h, 0.6)
+			for i, l := range cells[c] {
+				s.page.text(x+4, s.y+float64(i+1)*pdfLineHeight-2, size, r == 0, l)
+			}
+			x += widths[c]
+		}
+		s.y += h
+	}
+	s.y += 2
+}
+
+// ttdTahap menggambar tanda tangan tahap sebelum keputusan akhir berjajar,
+// tiga per baris: nama tahap, tanda tangan, lalu nama approver.
+func (s *suratPDF) ttdTahap(list []TTDTahap, slot ImageSlot) {
+	const lebar = 150.0
+	ruang := pdfLineHeight * 3
+	for i := 0; i < len(list); i += 3 {
+		s.need(ruang + pdfLineHeight*3)
+		y := s.y + pdfLineHeight
+		for j, t := range list[i:min(i+3, len(list))] {
+			x := pdfMarginX + float64(j)*lebar
+			s.page.text(x, y+pdfLineHeight, pdfFontSize, false, "Tahap "+t.Tahap)
+			s.stamp(slot, t.TTD, x, y+pdfLineHeight+2, ruang)
+			s.page.text(x, y+pdfLineHeight*2+ruang, pdfFontSize, false, t.Nama)
+		}
+		s.y = y + pdfLineHeight*2 + ruang
+	}
+}
+
+// stamp menggambar gambar slot dengan sudut kiri atas di (x, y) tanpa
+// memindahkan tulisan. Tingginya dibatasi maxH supaya tidak menimpa baris
+// berikutnya. Gambar yang kosong atau gagal dimuat hanya dicatat di log.
+func (s *suratPDF) stamp(slot ImageSlot, src string, x, y, maxH float64) {
+	if src == "" {
+		return
+	}
+	img, err := loadImage(src)
+	var index int
+	if err == nil {
+		index, err = s.doc.addImage(img)
+	}
+	if err != nil {
+		log.Printf("⚠️ Gagal memasang gambar %s pada surat PDF: %v", slot.Placeholder, err)
+		return
+	}
+	w, h := slot.fit(img)
+	if h > maxH {
+		w, h = w*maxH/h, maxH
+	}
+	s.page.drawImage(index, x, y, w, h)
+}
+
+// foto menggambar foto di tengah halaman dengan ukuran menurut slot.
+func (s *suratPDF) foto(src string, slot ImageSlot) error {
+	img, err := loadImage(src)
+	if err != nil {
+		return err
+	}
+	w, h := slot.fit(img)
+	index, err := s.doc.addImage(img)
+	if err != nil {
+		return err
+	}
+	s.y += pdfLineHeight
+	s.need(h)
+	s.page.drawImage(index, (pdfPageWidth-w)/2, s.y, w, h)
+	s.y += h
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageSlotFit(t *testing.T) {
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, image.NewGray(image.Rect(0, 0, 300, 600)), nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		slot         ImageSlot
+		img          []byte
+		wantW, wantH float64
+	}{
+		{"lebih lebar dari kotak", ImageSlot{Lebar: 400, Tinggi: 225}, testPNG(t, 800, 200), 400, 100},
+		{"lebih tinggi dari kotak", ImageSlot{Lebar: 400, Tinggi: 225}, testPNG(t, 200, 450), 100, 225},
+		{"kecil diperbesar", ImageSlot{Lebar: 150, Tinggi: 60}, testPNG(t, 50, 10), 150, 30},
+		{"jpeg", ImageSlot{Lebar: 72, Tinggi: 72}, jpg.Bytes(), 36, 72},
+		{"ukuran tetap", ImageSlot{Lebar: 150, Tinggi: 60, Ukuran: UkuranTetap}, testPNG(t, 50, 50), 150, 60},
+		{"hanya lebar", ImageSlot{Lebar: 200}, testPNG(t, 100, 50), 200, 100},
+		{"hanya tinggi", ImageSlot{Tinggi: 30}, testPNG(t, 100, 50), 60, 30},
+		{"tanpa kotak", ImageSlot{}, testPNG(t, 100, 40), 75, 30},
+		{"bukan gambar", ImageSlot{Lebar: 150, Tinggi: 60}, []byte("bukan gambar"), 150, 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w, h := tt.slot.fit(tt.img); w != tt.wantW || h != tt.wantH {
+				t.Errorf("fit = %v x %v, want %v x %v", w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestImageSlots(t *testing.T) {
+	def := &LetterDefinition{Gambar: []ImageSlot{gambar("<<FOTO>>", "FOTO:peminjaman"), gambar("<<TTD>>", "TTD:approver")}}
+	slots := def.imageSlots([]string{"<<FOTO>>", "<<QR:verifikasi>>", "<<TTD:Wali_Kelas>>", "<<NAMA>>", "<<QR:verifikasi>>"})
+	var got []string
+	for _, s := range slots {
+		got = append(got, s.Placeholder+"="+s.Sumber)
+	}
+	want := []string{"<<FOTO>>=FOTO:peminjaman", "<<TTD>>=TTD:approver", "<<QR:verifikasi>>=QR:verifikasi", "<<TTD:Wali_Kelas>>=TTD:Wali_Kelas"}
+	if len(got) != len(want) {
+		t.Fatalf("imageSlots = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("imageSlots[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if qr := slots[2]; qr.Lebar != 72 || qr.Tinggi != 72 {
+		t.Errorf("ukuran QR = %v x %v, want gambarDefault", qr.Lebar, qr.Tinggi)
+	}
+}
+
+func TestLetterDefinitions(t *testing.T) {
+	now := time.Date(2026, 5, 10, 9, 0, 0, 0, time.Local)
+	form := FormData{Nama: "Budi", NoPengembalian: 3, ApprovalStatus: "Disetujui", ApproverName: "Pak Guru"}
+	form.setItems([]ItemPinjam{{"Kamera", 2}})
+
+	for jenis, def := range letterDefinitions {
+		t.Run(jenis, func(t *testing.T) {
+			if def.Jenis != jenis || def.DocxTemplate == "" || def.GoogleTemplate == "" {
+				t.Errorf("definisi tidak lengkap: %+v", def)
+			}
+			repl := suratReplacements(def, form, 7, now)
+			// Setiap baris PDF harus punya teks pengganti, kalau tidak
+			// placeholder-nya tercetak apa adanya.
+			for _, f := range def.Isian {
+				if _, ok := repl[f.Placeholder]; !ok {
+					t.Errorf("isian %s: %s tidak punya teks pengganti", f.Label, f.Placeholder)
+				}
+			}
+			if rows := def.tableRows(form); rows != nil {
+				t.Errorf("tabel untuk satu alat = %v, want nil", rows)
+			}
+		})
+	}
+
+	tests := []struct {
+		def  *LetterDefinition
+		want string
+	}{
+		{suratPeminjaman, "Formulir Peminjaman 0007 - Budi"},
+		{suratPersetujuan, "Formulir Approval 0007 - Budi"},
+		{suratPengembalian, "Formulir Pengembalian 0007-0003 - Budi"},
+	}
+	for _, tt := range tests {
+		if got := tt.def.judul(suratReplacements(tt.def, form, 7, now)); got != tt.want {
+			t.Errorf("judul %s = %q, want %q", tt.def.Jenis, got, tt.want)
+		}
+	}
+
+	multi := form
+	multi.setItems([]ItemPinjam{{"Kamera", 2}, {"Tripod", 1}})
+	if rows := suratPeminjaman.tableRows(multi); len(rows) != 3 {
+		t.Errorf("tabel alat = %v, want header dan 2 baris", rows)
+	}
+	sebagian := form
+	sebagian.ItemSisa = []ItemPinjam{{"Kamera", 1}}
+	if rows := suratPengembalian.tableRows(sebagian); rows == nil {
+		t.Error("pengembalian sebagian tidak memakai tabel")
+	}
+	if repl := suratReplacements(suratPersetujuan, form, 7, now); repl["<<YNG>>"] != "Pak Guru" || repl["<<STS>>"] != "Disetujui" {
+		t.Errorf("keputusan = %q, %q", repl["<<YNG>>"], repl["<<STS>>"])
+	}
+}
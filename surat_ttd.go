@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// suratClaims adalah isi token verifikasi: surat jenis Jenis untuk
+// peminjaman ID. Token tidak kedaluwarsa karena surat tetap dipakai setelah
+// peminjaman selesai.
+type suratClaims struct {
+	ID    int    `json:"id"`
+	Jenis string `json:"j"`
+}
+
+// suratVerifier membuat link halaman verifikasi surat yang dicetak sebagai QR
+// code. Link ditandatangani supaya data peminjam tidak bisa dibuka dengan
+// menebak nomor peminjaman.
+type suratVerifier struct {
+	secret  []byte
+	baseURL string
+}
+
+var suratVerifikasi *suratVerifier
+
+// newSuratVerifierFromEnv membaca konfigurasi verifikasi surat:
+//
+//	SURAT_SECRET (jika kosong dibuat acak dan disimpan di SURAT_SECRET_PATH, default data/surat_secret)
+//	PUBLIC_URL, alamat backend yang dibuka dari QR code (default http://localhost:8080)
+func newSuratVerifierFromEnv() (*suratVerifier, error) {
+	secret := os.Getenv("SURAT_SECRET")
+	if secret == "" {
+		var err error
+		secret, err = loadOrCreateSecret(getEnv("SURAT_SECRET_PATH", filepath.Join("data", "surat_secret")))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &suratVerifier{
+		secret:  []byte(secret),
+		baseURL: strings.TrimRight(getEnv("PUBLIC_URL", "http://localhost:8080"), "/"),
+	}, nil
+}
+
+func (v *suratVerifier) token(id int, jenis string) string {
+	token, err := signToken(v.secret, suratClaims{ID: id, Jenis: jenis})
+	if err != nil {
+		log.Println("⚠️ Gagal membuat token verifikasi surat:", err)
+		return ""
+	}
+	return token
+}
+
+// link adalah alamat halaman verifikasi surat yang dicetak sebagai QR code.
+func (v *suratVerifier) link(token string) string {
+	return v.baseURL + "/surat/verifikasi?token=" + url.QueryEscape(token)
+}
+
+// qrLink adalah alamat gambar QR code surat. Google Docs mengunduh gambar ini
+// saat menyisipkannya; renderer lokal membuatnya langsung lewat qrImage.
+func (v *suratVerifier) qrLink(id int, jenis string) string {
+	token := v.token(id, jenis)
+	if token == "" {
+		return ""
+	}
+	return v.baseURL + "/surat/qr?token=" + url.QueryEscape(token)
+}
+
+// qrImage membuat PNG QR code jika src adalah qrLink; ok bernilai false untuk
+// alamat lain.
+func (v *suratVerifier) qrImage(src string) (img []byte, ok bool, err error) {
+	rest, ok := strings.CutPrefix(src, v.baseURL+"/surat/qr?")
+	if !ok {
+		return nil, false, nil
+	}
+	q, err := url.ParseQuery(rest)
+	if err != nil {
+		return nil, true, ErrTokenInvalid
+	}
+	img, err = v.qrPNG(q.Get("token"))
+	return img, true, err
+}
+
+func (v *suratVerifier) qrPNG(token string) ([]byte, error) {
+	var c suratClaims
+	if err := verifyToken(v.secret, token, &c); err != nil {
+		return nil, err
+	}
+	qr, err := encodeQR(v.link(token))
+	if err != nil {
+		return nil, err
+	}
+	return qr.png(8)
+}
+
+// handleSuratQR mengirim QR code verifikasi surat sebagai PNG:
+// GET /surat/qr?token=...
+func handleSuratQR(w http.ResponseWriter, r *http.Request) {
+	img, err := suratVerifikasi.qrPNG(r.URL.Query().Get("token"))
+	if errors.Is(err, ErrTokenInvalid) {
+		http.Error(w, "❌ Token surat tidak valid", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Println("Buat QR code error:", err)
+		http.Error(w, "Gagal membuat QR code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(img)
+}
+
+var verifikasiPage = template.Must(template.New("verifikasi").Parse(`<!DOCTYPE html>
+<html lang="id">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Verifikasi Surat {{.ID}}</title></head>
+<body style="font-family: sans-serif; max-width: 32rem; margin: 2rem auto; padding: 0 1rem">
+<h2>✅ Surat {{.Jenis}} {{.ID}} terdaftar</h2>
+<p>Surat ini diterbitkan oleh sistem peminjaman alat SMKN 7 Semarang. Cocokkan isinya dengan data di bawah.</p>
+<table>
+<tr><td>Nama</td><td>: {{.Loan.Form.Nama}} ({{.Loan.Form.Kelas}})</td></tr>
+<tr><td>NIS</td><td>: {{.Loan.Form.NIS}}</td></tr>
+<tr><td>Alat</td><td>: {{.Alat}}</td></tr>
+<tr><td>Tgl Pinjam</td><td>: {{.Loan.Form.TanggalPinjam}}</td></tr>
+<tr><td>Tgl Kembali</td><td>: {{.Loan.Form.TanggalKembali}}</td></tr>
+{{with .Approval}}<tr><td>Keputusan</td><td>: {{.Status}} oleh {{.Approver}}</td></tr>
+<tr><td>Tgl Keputusan</td><td>: {{.Tanggal}}</td></tr>{{end}}
+<tr><td>Status sekarang</td><td>: {{.Loan.Status}}</td></tr>
+</table>
+</body>
+</html>
+`))
+
+// handleSuratVerifikasi menampilkan data peminjaman dari surat yang QR
+// code-nya dipindai: GET /surat/verifikasi?token=...
+func handleSuratVerifikasi(w http.ResponseWriter, r *http.Request) {
+	var c suratClaims
+	if err := verifyToken(suratVerifikasi.secret, r.URL.Query().Get("token"), &c); err != nil {
+		http.Error(w, "❌ Surat tidak dikenali; kemungkinan bukan surat asli", http.StatusForbidden)
+		return
+	}
+	loan, err := loanRepo.FindLoan(c.ID)
+	if errors.Is(err, ErrLoanNotFound) {
+		http.Error(w, "❌ Data peminjaman surat ini sudah tidak ada", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Find loan error:", err)
+		http.Error(w, "Gagal membaca data peminjaman", http.StatusInternalServerError)
+		return
+	}
+	approval, err := loanRepo.FindApproval(c.ID)
+	if err != nil {
+		log.Println("Find approval error:", err)
+		http.Error(w, "Gagal membaca data persetujuan", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = verifikasiPage.Execute(w, struct {
+		ID       string
+		Jenis    string
+		Loan     *Peminjaman
+		Alat     string
+		Approval *Approval
+	}{formatLoanID(loan.ID), c.Jenis, loan, itemSummary(loan.Form.items()), approval})
+	if err != nil {
+		log.Println("Render halaman verifikasi error:", err)
+	}
+}
+
+// ttdMaks membatasi ukuran gambar tanda tangan yang diupload.
+const ttdMaks = 2 << 20
+
+// handleTTD menyimpan gambar tanda tangan approver yang sedang login untuk
+// dicap di <<TTD>> surat persetujuan. POST dengan file ttd (PNG atau JPEG,
+// sebaiknya berlatar transparan atau putih) mengganti tanda tangan lama;
+// DELETE menghapusnya.
+func handleTTD(w http.ResponseWriter, r *http.Request) {
+	u := userFrom(r)
+	switch r.Method {
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, ttdMaks+(1<<20))
+		r.ParseMultipartForm(ttdMaks)
+		file, handler, err := r.FormFile("ttd")
+		if err != nil {
+			http.Error(w, "File tanda tangan (ttd) harus diupload", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		if handler.Size > ttdMaks {
+			http.Error(w, fmt.Sprintf("Tanda tangan maksimal %d MB", ttdMaks>>20), http.StatusBadRequest)
+			return
+		}
+		head := make([]byte, 512)
+		n, _ := file.Read(head)
+		ext := map[string]string{"image/png": ".png", "image/jpeg": ".jpg"}[http.DetectContentType(head[:n])]
+		if ext == "" {
+			http.Error(w, "Tanda tangan harus berupa gambar PNG atau JPEG", http.StatusBadRequest)
+			return
+		}
+		if _, err := file.Seek(0, 0); err != nil {
+			http.Error(w, "Gagal membaca tanda tangan", http.StatusInternalServerError)
+			return
+		}
+		localPath, err := saveFileLocally(file, "ttd-"+safeFileName(u.Username)+ext)
+		if err != nil {
+			log.Println("Save TTD error:", err)
+			http.Error(w, "Gagal menyimpan tanda tangan", http.StatusInternalServerError)
+			return
+		}
+		link, err := letterRenderer.UploadFoto(localPath)
+		os.Remove(localPath)
+		if err != nil {
+			log.Println("❌ Gagal upload tanda tangan:", err)
+			http.Error(w, "Gagal menyimpan tanda tangan", http.StatusInternalServerError)
+			return
+		}
+		u.TTD = link
+	case http.MethodDelete:
+		u.TTD = ""
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := userRepo.SaveUser(u); err != nil {
+		log.Println("Save user error:", err)
+		http.Error(w, "Gagal menyimpan tanda tangan", http.StatusInternalServerError)
+		return
+	}
+	if u.TTD == "" {
+		w.Write([]byte("✅ Tanda tangan dihapus"))
+		return
+	}
+	log.Printf("INFO: Tanda tangan %s diperbarui: %s", u.Username, u.TTD)
+	w.Write([]byte("✅ Tanda tangan disimpan"))
+}
+
+// TTDTahap adalah tanda tangan satu tahap rantai persetujuan yang disetujui
+// sebelum keputusan akhir.
+type TTDTahap struct {
+	Tahap string
+	Nama  string
+	TTD   string
+}
+
+// setTTD mengisi tanda tangan surat persetujuan dari riwayat approvals satu
+// peminjaman: ApproverTTD dari keputusan terakhir dan TTDTahap dari tahap
+// yang disetujui sebelumnya. Tanda tangan diambil dari riwayat, bukan dari
+// akun, supaya surat yang dibuat ulang tetap memakai tanda tangan saat
+// keputusan diambil.
+func (f *FormData) setTTD(approvals []Approval) {
+	f.ApproverTTD, f.TTDTahap = "", nil
+	if len(approvals) == 0 {
+		return
+	}
+	last := len(approvals) - 1
+	f.ApproverTTD = approvals[last].TTD
+	for _, a := range approvals[:last] {
+		if loanStatusFromStorage(a.Status) == StatusDisetujui {
+			f.TTDTahap = append(f.TTDTahap, TTDTahap{Tahap: a.Tahap, Nama: a.Approver, TTD: a.TTD})
+		}
+	}
+}
+
+// ttdTahap mengembalikan tanda tangan tahap bernama nama untuk <<TTD:nama>>.
+// Spasi pada nama tahap ditulis "_" di placeholder.
+func (f FormData) ttdTahap(nama string) string {
+	for _, t := range f.TTDTahap {
+		if strings.EqualFold(strings.ReplaceAll(t.Tahap, " ", "_"), nama) {
+			return t.TTD
+		}
+	}
+	return ""
+}
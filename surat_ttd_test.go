@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/docs/v1"
+)
+
+func TestSetTTD(t *testing.T) {
+	var f FormData
+	f.setTTD([]Approval{
+		{Tahap: "Wali Kelas", Approver: "Pak Wali", Status: "Disetujui", TTD: "ttd-wali.png"},
+		{Tahap: "Guru Lab", Approver: "Pak Lab", Status: "Ditolak", TTD: "ttd-lab-lama.png"},
+		{Tahap: "Kaprog", Approver: "Bu Kaprog", Status: "Disetujui", TTD: "ttd-kaprog.png"},
+	})
+	if f.ApproverTTD != "ttd-kaprog.png" || len(f.TTDTahap) != 1 {
+		t.Fatalf("ApproverTTD = %q, TTDTahap = %+v", f.ApproverTTD, f.TTDTahap)
+	}
+	tests := []struct {
+		nama string
+		want string
+	}{
+		{"Wali_Kelas", "ttd-wali.png"},
+		{"wali_kelas", "ttd-wali.png"},
+		{"Guru_Lab", ""},
+		{"Kaprog", ""},
+	}
+	for _, tt := range tests {
+		if got := f.ttdTahap(tt.nama); got != tt.want {
+			t.Errorf("ttdTahap(%q) = %q, want %q", tt.nama, got, tt.want)
+		}
+	}
+	f.setTTD(nil)
+	if f.ApproverTTD != "" || f.TTDTahap != nil {
+		t.Errorf("setTTD(nil) tidak mengosongkan: %+v", f)
+	}
+}
+
+func TestSuratVerifikasi(t *testing.T) {
+	newTestStorage(t)
+	old := suratVerifikasi
+	suratVerifikasi = &suratVerifier{secret: []byte("rahasia"), baseURL: "http://backend"}
+	t.Cleanup(func() { suratVerifikasi = old })
+	loan := createTestLoan(t, StatusDisetujui, "Kamera", 1, "2026-05-11", "2026-05-12")
+
+	qrLink := suratVerifikasi.qrLink(loan.ID, "persetujuan")
+	img, ok, err := suratVerifikasi.qrImage(qrLink)
+	if !ok || err != nil || !bytes.HasPrefix(img, []byte("\x89PNG")) {
+		t.Fatalf("qrImage(%q) = %d byte, %v, %v", qrLink, len(img), ok, err)
+	}
+	if _, ok, _ := suratVerifikasi.qrImage("https://drive/foto"); ok {
+		t.Error("qrImage menganggap link lain sebagai QR code")
+	}
+	if _, _, err := suratVerifikasi.qrImage("http://backend/surat/qr?token=palsu"); err == nil {
+		t.Error("qrImage menerima token palsu")
+	}
+
+	u, _ := url.Parse(qrLink)
+	token := u.Query().Get("token")
+	palsu := (&suratVerifier{secret: []byte("rahasia lain")}).token(loan.ID, "persetujuan")
+	hilang := suratVerifikasi.token(99, "persetujuan")
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{"asli", token, http.StatusOK, "Kamera"},
+		{"palsu", palsu, http.StatusForbidden, "bukan surat asli"},
+		{"peminjaman dihapus", hilang, http.StatusNotFound, "sudah tidak ada"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleSuratVerifikasi(rec, httptest.NewRequest(http.MethodGet, "/surat/verifikasi?token="+url.QueryEscape(tt.token), nil))
+			if rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("kode %d %q, want %d berisi %q", rec.Code, rec.Body.String(), tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	handleSuratQR(rec, httptest.NewRequest(http.MethodGet, "/surat/qr?token="+url.QueryEscape(palsu), nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("GET /surat/qr token palsu = %d, want 403", rec.Code)
+	}
+}
+
+func TestHandleTTD(t *testing.T) {
+	newTestStorage(t)
+	useTestSessions(t)
+	t.Chdir(t.TempDir())
+	l := &localLetterRenderer{dir: t.TempDir(), baseURL: "http://backend/surat/file/"}
+	old := letterRenderer
+	letterRenderer = l
+	t.Cleanup(func() { letterRenderer = old })
+	guru := saveTestUser(t, "guru1", RoleApprover)
+
+	upload := func(method string, data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		if data != nil {
+			fw, _ := mw.CreateFormFile("ttd", "ttd.png")
+			fw.Write(data)
+		}
+		mw.Close()
+		r := httptest.NewRequest(method, "/ttd", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		requireRole(handleTTD, RoleApprover)(rec, withSession(t, r, guru))
+		return rec
+	}
+
+	if rec := upload(http.MethodPost, []byte("bukan gambar")); rec.Code != http.StatusBadRequest {
+		t.Errorf("upload bukan gambar = %d, want 400", rec.Code)
+	}
+	if rec := upload(http.MethodPost, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("upload tanpa file = %d, want 400", rec.Code)
+	}
+	if rec := upload(http.MethodPost, testPNG(t, 30, 10)); rec.Code != http.StatusOK {
+		t.Fatalf("upload PNG = %d %s", rec.Code, rec.Body)
+	}
+	u, _ := userRepo.FindUser("guru1")
+	if !strings.HasPrefix(u.TTD, l.baseURL) || !strings.HasSuffix(u.TTD, ".png") {
+		t.Errorf("TTD = %q", u.TTD)
+	}
+	if rec := upload(http.MethodDelete, nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", rec.Code, rec.Body)
+	}
+	if u, _ := userRepo.FindUser("guru1"); u.TTD != "" {
+		t.Errorf("TTD setelah dihapus = %q", u.TTD)
+	}
+}
+
+func TestMissingGoogleImages(t *testing.T) {
+	old := suratVerifikasi
+	suratVerifikasi = &suratVerifier{secret: []byte("rahasia"), baseURL: "http://backend"}
+	t.Cleanup(func() { suratVerifikasi = old })
+	paragraf := func(text string) *docs.StructuralElement {
+		return &docs.StructuralElement{Paragraph: &docs.Paragraph{Elements: []*docs.ParagraphElement{
+			{StartIndex: 1, TextRun: &docs.TextRun{Content: text}},
+		}}}
+	}
+	lama := &docs.Document{Body: &docs.Body{Content: []*docs.StructuralElement{paragraf("Yang Menyetujui: <<YNG>>\n"), paragraf("<<FOTO>>\n")}}}
+	baru := &docs.Document{
+		Body:    &docs.Body{Content: []*docs.StructuralElement{paragraf("<<TTD>>\n"), paragraf("<<YNG>>\n"), paragraf("<<FOTO>>\n")}},
+		Footers: map[string]docs.Footer{"f1": {Content: []*docs.StructuralElement{paragraf("<<QR>>\n")}}},
+	}
+	form := FormData{ApproverTTD: "https://drive/ttd"}
+
+	if got := missingGoogleImages(lama, suratPersetujuan, form, 7); strings.Join(got, ",") != "<<TTD>>,<<QR>>" {
+		t.Errorf("template lama: missing = %v, want <<TTD>> dan <<QR>>", got)
+	}
+	if got := missingGoogleImages(baru, suratPersetujuan, form, 7); len(got) != 0 {
+		t.Errorf("template baru: missing = %v", got)
+	}
+	// Tanpa tanda tangan dan QR code, template lama masih cukup.
+	suratVerifikasi = nil
+	if got := missingGoogleImages(lama, suratPersetujuan, FormData{}, 7); len(got) != 0 {
+		t.Errorf("tanpa gambar baru: missing = %v", got)
+	}
+}